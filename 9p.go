@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"sync"
+	"time"
 )
 
 var errConnShutdown = errors.New("connection shutdown")
@@ -26,14 +28,24 @@ func (h *msgHeader) serialize() (out [7]byte) {
 	return out
 }
 
-func (h *msgHeader) readerFrom(r io.Reader) io.Reader {
+// check returns an error if the message size is out of bounds
+// for the given msize.
+func (h *msgHeader) check(msize uint32) error {
+	if h.size < 7 || h.size > msize {
+		return fmt.Errorf("message size %d out of bounds (msize %d)", h.size, msize)
+	}
+	return nil
+}
+
+// readerFrom returns a reader for the full message, including the
+// header.  The returned reader is bounded to the message size.
+func (h *msgHeader) readerFrom(r io.Reader) *io.LimitedReader {
 	hdrBuf := h.serialize()
 	hdrReader := bytes.NewBuffer(hdrBuf[:])
-	bodyReader := io.LimitReader(r, int64(h.size-7))
-	return io.MultiReader(hdrReader, bodyReader)
+	return &io.LimitedReader{R: io.MultiReader(hdrReader, r), N: int64(h.size)}
 }
 
-type callback func(d msgHeader)
+type callback func(d msgHeader) error
 
 // ClientConn represents a connection to a 9p server.
 type ClientConn struct {
@@ -47,14 +59,26 @@ type ClientConn struct {
 	reqReaders map[uint16]callback
 
 	// Connection preferences
-	msize uint32
+	msize  uint32
+	logger *slog.Logger
+
+	// RPC entry point, including interceptors
+	invoke Invoker
 
 	// Shutdown helpers
 	cancel func(error)
 	wg     sync.WaitGroup
 
+	// done is closed when the connection broke down;
+	// err is the reason for it.
+	done chan struct{}
+	err  error
+
 	// Thread-safe pool of FIDs to use
 	fidPool fidPool
+
+	// RPC statistics
+	stats connStats
 }
 
 func readHeader(r io.Reader) (hdr msgHeader, err error) {
@@ -83,31 +107,40 @@ func (c *ClientConn) run(ctx context.Context) error {
 		}
 
 		hdr, err := readHeader(c.conn)
-		// TODO: Use limit reader
 		if err != nil {
 			if context.Cause(ctx) == errConnShutdown {
 				return nil
 			}
 			return fmt.Errorf("peek error when expecting next message: %w", err)
 		}
+		if err := hdr.check(c.msize); err != nil {
+			return err
+		}
+		c.stats.received(hdr.size)
 
-		c.getReqReader(hdr.tag)(hdr) // blocking
+		if err := c.getReqReader(hdr.tag)(hdr); err != nil { // blocking
+			return err
+		}
 	}
 }
 
+// fail marks the connection as broken down with the given error.
+// Pending and future requests return that error.
+func (c *ClientConn) fail(err error) {
+	c.err = err
+	close(c.done)
+	c.conn.Close()
+}
+
 func (c *ClientConn) getReqReader(tag uint16) callback {
 	c.rrmux.Lock()
 	defer c.rrmux.Unlock()
 
 	rr, ok := c.reqReaders[tag]
 	if !ok {
-		// Skip message and log, nothing is registered for the tag.
-		return func(hdr msgHeader) {
-			// TODO: handle errors correctly
-			err := skip(c.conn, int(hdr.size-7))
-			if err != nil {
-				return
-			}
+		// Skip message, nothing is registered for the tag.
+		return func(hdr msgHeader) error {
+			return skip(c.conn, int(hdr.size-7))
 		}
 	}
 
@@ -142,46 +175,53 @@ func (c *ClientConn) Close() error {
 
 type tagHandle struct {
 	tag uint16
-	// Reader run loop sends a msg header for that tag if found.
-	readyToRead chan msgHeader
+	// Reader run loop sends a reader for the message for that tag
+	// if found.
+	readyToRead chan io.Reader
 	// The handling function replies back to the reader run loop
 	// through this channel.
 	doneReading chan struct{}
+	// Closed when the handling function stops waiting for the
+	// message, e.g. on context cancelation.
+	abandoned chan struct{}
 	// Parent ClientConn
 	conn *ClientConn
 }
 
-func (h *tagHandle) awaitHdr(ctx context.Context) (msgHeader, error) {
-	select {
-	case hdr := <-h.readyToRead:
-		return hdr, nil
-	case <-ctx.Done():
-		return msgHeader{}, ctx.Err()
-	}
-}
-
 // Await the response for the given tag. On success, returns a reader
 // for the response message (bounded to size). Returns ctx.Err() on
 // early cancelation.
 func (h *tagHandle) await(ctx context.Context) (io.Reader, error) {
-	hdr, err := h.awaitHdr(ctx)
-	if err != nil {
-		return nil, err
+	select {
+	case r := <-h.readyToRead:
+		return r, nil
+	case <-ctx.Done():
+		close(h.abandoned)
+		return nil, ctx.Err()
+	case <-h.conn.done:
+		return nil, h.conn.err
 	}
-	return hdr.readerFrom(h.conn.conn), nil
 }
 
 func (c *ClientConn) acquireTag() *tagHandle {
 	h := &tagHandle{
 		conn:        c,
 		tag:         <-c.tags,
-		readyToRead: make(chan msgHeader),
+		readyToRead: make(chan io.Reader),
 		doneReading: make(chan struct{}),
+		abandoned:   make(chan struct{}),
 	}
-	c.setReqReader(h.tag, func(hdr msgHeader) {
+	c.setReqReader(h.tag, func(hdr msgHeader) error {
 		// Invoked by reader run loop to read the given message.
-		h.readyToRead <- hdr
-		<-h.doneReading
+		r := hdr.readerFrom(c.conn)
+		select {
+		case h.readyToRead <- r:
+			<-h.doneReading
+		case <-h.abandoned:
+			// Late reply to a flushed request.
+		}
+		// Skip whatever the handler did not read.
+		return skip(r, int(r.N))
 	})
 	return h
 }
@@ -192,93 +232,107 @@ func (c *ClientConn) releaseTag(h *tagHandle) {
 	c.tags <- h.tag
 }
 
-// Read from an open fid.
-//
-// offset indicates the offset into the file where to read.
-// buf is the buffer to read into and may not be larger than
-// the fid's iounit as returned by Open().
-func (c *ClientConn) Read(ctx context.Context, fid uint32, offset uint64, buf []byte) (n uint32, err error) {
-	tag := c.acquireTag()
-	defer c.releaseTag(tag)
-
-	c.wmux.Lock()
-	err = writeTread(c.conn, tag.tag, fid, offset, uint32(len(buf)))
-	c.wmux.Unlock()
-
+// rpc sends the request req through the interceptors
+// and returns the reply.
+func (c *ClientConn) rpc(ctx context.Context, req Message) (Message, error) {
+	resp, err := c.invoke(ctx, req)
 	if err != nil {
-		return
+		return nil, err
 	}
-
-	r, err := tag.await(ctx)
-	if err != nil {
-		c.Flush(tag.tag)
-		return
+	if resp.Type() != req.Type()+1 {
+		return nil, errUnexpectedMsg
 	}
-
-	return readRread(r, buf)
+	return resp, nil
 }
 
-func (c *ClientConn) Write(ctx context.Context, fid uint32, offset uint64, data []byte) (n uint32, err error) {
+// roundTrip sends the request req under a fresh tag and returns the
+// reply.
+//
+// Rerror replies are returned as *Error.  If ctx is done before the
+// reply arrives, the request is flushed and ctx.Err() is returned.
+func (c *ClientConn) roundTrip(ctx context.Context, req Message) (Message, error) {
 	tag := c.acquireTag()
 	defer c.releaseTag(tag)
+	req.setTag(tag.tag)
+
+	start := time.Now()
+	logRequest(ctx, c.logger, req)
 
+	buf, err := Marshal(req)
+	if err != nil {
+		return nil, err
+	}
 	c.wmux.Lock()
-	err = writeTwrite(c.conn, tag.tag, fid, offset, data)
+	_, err = c.conn.Write(buf)
 	c.wmux.Unlock()
 
 	if err != nil {
-		return
+		return nil, err
 	}
+	c.stats.sent(req.Type(), len(buf))
 
 	r, err := tag.await(ctx)
 	if err != nil {
-		c.Flush(tag.tag)
-		return
+		c.stats.done(nil, 0)
+		if req.Type() != MsgTflush {
+			c.Flush(tag.tag)
+		}
+		return nil, err
 	}
 
-	return readRwrite(r)
-}
-
-func (c *ClientConn) Walk(ctx context.Context, fid, newfid uint32, wname []string) (qids []QID, err error) {
-	tag := c.acquireTag()
-	defer c.releaseTag(tag)
+	resp, err := readMessage(r, c.msize)
+	latency := time.Since(start)
+	c.stats.done(resp, latency)
+	if err != nil {
+		return nil, err
+	}
+	logReply(ctx, c.logger, req, resp, latency)
 
-	c.wmux.Lock()
-	err = writeTwalk(c.conn, tag.tag, fid, newfid, wname)
-	c.wmux.Unlock()
+	if e, ok := resp.(*Rerror); ok {
+		return nil, &Error{Ename: e.Ename}
+	}
+	return resp, nil
+}
 
+// Read from an open fid.
+//
+// offset indicates the offset into the file where to read.
+// buf is the buffer to read into and may not be larger than
+// the fid's iounit as returned by Open().
+func (c *ClientConn) Read(ctx context.Context, fid uint32, offset uint64, buf []byte) (n uint32, err error) {
+	resp, err := c.rpc(ctx, &Tread{FID: fid, Offset: offset, Count: uint32(len(buf))})
 	if err != nil {
-		return
+		return 0, err
+	}
+	data := resp.(*Rread).Data
+	if len(data) > len(buf) {
+		return 0, errors.New("server returned more data than requested")
 	}
+	return uint32(copy(buf, data)), nil
+}
 
-	r, err := tag.await(ctx)
+func (c *ClientConn) Write(ctx context.Context, fid uint32, offset uint64, data []byte) (n uint32, err error) {
+	resp, err := c.rpc(ctx, &Twrite{FID: fid, Offset: offset, Data: data})
 	if err != nil {
-		c.Flush(tag.tag)
-		return
+		return 0, err
 	}
-
-	return readRwalk(r)
+	return resp.(*Rwrite).Count, nil
 }
 
-func (c *ClientConn) Stat(ctx context.Context, fid uint32) (stat Stat, err error) {
-	tag := c.acquireTag()
-	defer c.releaseTag(tag)
-
-	c.wmux.Lock()
-	err = writeTstat(c.conn, tag.tag, fid)
-	c.wmux.Unlock()
-
+func (c *ClientConn) Walk(ctx context.Context, fid, newfid uint32, wname []string) (qids []QID, err error) {
+	resp, err := c.rpc(ctx, &Twalk{FID: fid, NewFID: newfid, Wnames: wname})
 	if err != nil {
-		return
+		return nil, err
 	}
+	return resp.(*Rwalk).QIDs, nil
+}
 
-	r, err := tag.await(ctx)
+func (c *ClientConn) Stat(ctx context.Context, fid uint32) (stat Stat, err error) {
+	resp, err := c.rpc(ctx, &Tstat{FID: fid})
 	if err != nil {
-		c.Flush(tag.tag)
-		return
+		return Stat{}, err
 	}
-
-	return readRstat(r)
+	return resp.(*Rstat).Stat, nil
 }
 
 // Modes for opening and creating files, as defined in open(9p).
@@ -292,104 +346,63 @@ const (
 )
 
 func (c *ClientConn) Open(ctx context.Context, fid uint32, mode uint8) (qid QID, iounit uint32, err error) {
-	tag := c.acquireTag()
-	defer c.releaseTag(tag)
-
-	c.wmux.Lock()
-	err = writeTopen(c.conn, tag.tag, fid, mode)
-	c.wmux.Unlock()
-
+	resp, err := c.rpc(ctx, &Topen{FID: fid, Mode: mode})
 	if err != nil {
-		return
+		return QID{}, 0, err
 	}
+	r := resp.(*Ropen)
+	return r.QID, r.IOUnit, nil
+}
 
-	r, err := tag.await(ctx)
+// Create creates the file name in the directory fid and opens it.
+// On success, fid refers to the new file.
+func (c *ClientConn) Create(ctx context.Context, fid uint32, name string, perm uint32, mode uint8) (qid QID, iounit uint32, err error) {
+	resp, err := c.rpc(ctx, &Tcreate{FID: fid, Name: name, Perm: perm, Mode: mode})
 	if err != nil {
-		c.Flush(tag.tag)
-		return
+		return QID{}, 0, err
 	}
-
-	return readRopen(r)
+	r := resp.(*Rcreate)
+	return r.QID, r.IOUnit, nil
 }
 
-func (c *ClientConn) Clunk(ctx context.Context, fid uint32) (err error) {
-	tag := c.acquireTag()
-	defer c.releaseTag(tag)
-
-	c.wmux.Lock()
-	err = writeTclunk(c.conn, tag.tag, fid)
-	c.wmux.Unlock()
-
-	if err != nil {
-		return
-	}
+// Remove removes the file fid and clunks the fid, even if the removal
+// fails.
+func (c *ClientConn) Remove(ctx context.Context, fid uint32) (err error) {
+	_, err = c.rpc(ctx, &Tremove{FID: fid})
+	return err
+}
 
-	r, err := tag.await(ctx)
-	if err != nil {
-		c.Flush(tag.tag)
-		return
-	}
+// Wstat changes the metadata of fid.  Fields which are not to be
+// changed must have their "don't touch" values, as in NullStat.
+func (c *ClientConn) Wstat(ctx context.Context, fid uint32, stat Stat) (err error) {
+	_, err = c.rpc(ctx, &Twstat{FID: fid, Stat: stat})
+	return err
+}
 
-	return readRclunk(r)
+func (c *ClientConn) Clunk(ctx context.Context, fid uint32) (err error) {
+	_, err = c.rpc(ctx, &Tclunk{FID: fid})
+	return err
 }
 
 // TODO: Do callers need to check the error?
 func (c *ClientConn) Flush(oldtag uint16) (err error) {
-	tag := c.acquireTag()
-	defer c.releaseTag(tag)
-
-	c.wmux.Lock()
-	err = writeTflush(c.conn, tag.tag, oldtag)
-	c.wmux.Unlock()
-
-	if err != nil {
-		return
-	}
-
-	// Note: This may not error. Servers must repond to flush.
-	r, _ := tag.await(context.Background())
-
-	return readRflush(r)
+	// Note: This may not time out. Servers must repond to flush.
+	_, err = c.rpc(context.Background(), &Tflush{OldTag: oldtag})
+	return err
 }
 
 func (c *ClientConn) Attach(ctx context.Context, fid uint32, afid uint32, uname string, aname string) (qid QID, err error) {
-	tag := c.acquireTag()
-	defer c.releaseTag(tag)
-
-	c.wmux.Lock()
-	err = writeTattach(c.conn, tag.tag, fid, afid, uname, aname)
-	c.wmux.Unlock()
-
-	if err != nil {
-		return
-	}
-
-	r, err := tag.await(context.Background())
+	resp, err := c.rpc(ctx, &Tattach{FID: fid, AFID: afid, Uname: uname, Aname: aname})
 	if err != nil {
-		c.Flush(tag.tag)
-		return
+		return QID{}, err
 	}
-
-	return readRattach(r)
+	return resp.(*Rattach).QID, nil
 }
 
 func (c *ClientConn) Auth(ctx context.Context, afid uint32, uname, aname string) (qid QID, err error) {
-	tag := c.acquireTag()
-	defer c.releaseTag(tag)
-
-	c.wmux.Lock()
-	err = writeTauth(c.conn, tag.tag, afid, uname, aname)
-	c.wmux.Unlock()
-
+	resp, err := c.rpc(ctx, &Tauth{AFID: afid, Uname: uname, Aname: aname})
 	if err != nil {
-		return
+		return QID{}, err
 	}
-
-	r, err := tag.await(context.Background())
-	if err != nil {
-		c.Flush(tag.tag)
-		return
-	}
-
-	return readRauth(r)
+	return resp.(*Rauth).AQID, nil
 }
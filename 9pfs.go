@@ -1,7 +1,7 @@
 package ninep
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -18,15 +18,34 @@ type file struct {
 	offset int64
 	iounit uint32
 	QID    QID
+	name   string
+	closed bool
+
+	// State for reading directories
+	dir dirState
+}
+
+// dirState keeps track of reading a directory.
+//
+// In 9p, directory reads return whole stat records and may only
+// continue at the offset where the previous read ended.
+type dirState struct {
+	buf    []byte // Stat records read but not returned yet
+	offset uint64 // Offset for the next read
+	eof    bool
 }
 
 func (f *file) Read(p []byte) (n int, err error) {
-	n, err = f.ReadAt(p, f.offset)
+	n, err = f.read(p, f.offset)
 	f.offset += int64(n)
 	return n, err
 }
 
-func (f *file) ReadAt(p []byte, off int64) (n int, err error) {
+// read does a single read RPC at the given offset.
+func (f *file) read(p []byte, off int64) (n int, err error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
 	// Truncate read to iounit size if necessary.
 	if uint32(len(p)) > f.iounit {
 		p = p[:f.iounit]
@@ -41,6 +60,22 @@ func (f *file) ReadAt(p []byte, off int64) (n int, err error) {
 	return int(count), nil
 }
 
+// ReadAt reads len(p) bytes at offset off, as long as the file is
+// long enough.  Directories can not be read at arbitrary offsets.
+func (f *file) ReadAt(p []byte, off int64) (n int, err error) {
+	if f.QID.IsDirectory() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	for n < len(p) {
+		nn, err := f.read(p[n:], off+int64(n))
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
 func (f *file) Write(p []byte) (n int, err error) {
 	n, err = f.WriteAt(p, f.offset)
 	f.offset += int64(n)
@@ -48,6 +83,9 @@ func (f *file) Write(p []byte) (n int, err error) {
 }
 
 func (f *file) WriteAt(p []byte, off int64) (n int, err error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
 	// Truncate write to iounit size if necessary.
 	if uint32(len(p)) > f.iounit {
 		p = p[:f.iounit]
@@ -57,30 +95,80 @@ func (f *file) WriteAt(p []byte, off int64) (n int, err error) {
 }
 
 func (f *file) Stat() (info os.FileInfo, err error) {
+	if f.closed {
+		return nil, fs.ErrClosed
+	}
 	stat, err := f.cc.Stat(context.TODO(), f.FID)
-	return &statFileInfo{s: stat}, err
+	if err != nil {
+		return nil, err
+	}
+	return &statFileInfo{s: stat}, nil
 }
 
+// ReadDir reads the contents of the directory, as described in
+// fs.ReadDirFile.
 func (f *file) ReadDir(n int) (entries []fs.DirEntry, err error) {
 	if !f.QID.IsDirectory() {
-		return nil, errors.New("not a directory")
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	if f.closed {
+		return nil, fs.ErrClosed
 	}
-	br := bufio.NewReader(f)
 	unlimited := n <= 0
-	for i := 0; i < n || unlimited; i++ {
-		var stat Stat
-		if err := readStat(br, &stat); err != nil {
-			if unlimited && err == io.EOF {
-				err = nil
+	for unlimited || len(entries) < n {
+		if len(f.dir.buf) == 0 {
+			if f.dir.eof {
+				break
+			}
+			if err := f.fillDirBuf(); err != nil {
+				return entries, &fs.PathError{Op: "readdir", Path: f.name, Err: err}
 			}
-			return entries, err
+			continue
+		}
+
+		var stat Stat
+		r := bytes.NewReader(f.dir.buf)
+		if err := readStat(r, &stat); err != nil {
+			f.dir.buf = nil
+			return entries, &fs.PathError{Op: "readdir", Path: f.name, Err: fmt.Errorf("bad directory entry: %w", err)}
 		}
+		f.dir.buf = f.dir.buf[len(f.dir.buf)-r.Len():]
 		entries = append(entries, &statFileInfo{s: stat})
 	}
+	if !unlimited && len(entries) == 0 {
+		return nil, io.EOF
+	}
 	return entries, nil
 }
 
+// fillDirBuf reads the next batch of stat records from the server.
+func (f *file) fillDirBuf() error {
+	buf := make([]byte, f.iounit)
+	count, err := f.cc.Read(context.TODO(), f.FID, f.dir.offset, buf)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		f.dir.eof = true
+	}
+	f.dir.offset += uint64(count)
+	f.dir.buf = buf[:count]
+	return nil
+}
+
+// Seek sets the offset for the next Read or Write.
+//
+// Directories can only be rewound to the start.
 func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.QID.IsDirectory() {
+		if offset != 0 || whence != io.SeekStart {
+			return f.offset, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+		}
+		f.offset = 0
+		f.dir = dirState{}
+		return 0, nil
+	}
+
 	var absOffset int64
 
 	switch whence {
@@ -106,17 +194,20 @@ func (f *file) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (f *file) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
 	defer f.cc.fidPool.Release(f.FID)
 	return f.cc.Clunk(context.TODO(), f.FID)
 }
 
-// TODO: Double check that the mode bits match.
 type statFileInfo struct{ s Stat }
 
 func (fi *statFileInfo) Name() string               { return fi.s.Name }
 func (fi *statFileInfo) Size() int64                { return int64(fi.s.Length) }
-func (fi *statFileInfo) Mode() fs.FileMode          { return os.FileMode(fi.s.Mode) }
-func (fi *statFileInfo) ModTime() time.Time         { return time.Unix(int64(fi.s.Mtime), 0) }
+func (fi *statFileInfo) Mode() fs.FileMode          { return FileMode(fi.s.Mode) }
+func (fi *statFileInfo) ModTime() time.Time         { return fi.s.ModTime() }
 func (fi *statFileInfo) IsDir() bool                { return (fi.s.Mode & ModeDir) != 0 }
 func (fi *statFileInfo) Sys() interface{}           { return fi.s }
 func (fi *statFileInfo) Type() fs.FileMode          { return fi.Mode().Type() }
@@ -133,31 +224,34 @@ func (f *FS) Open(name string) (filp fs.File, openErr error) {
 }
 
 // OpenFile is the generalized open call.
+// The name must be a valid path as described by fs.ValidPath.
 //
 // Remark: This is not part of io/fs.FS.
 func (f *FS) OpenFile(name string, mode uint8) (filp fs.File, openErr error) {
-	// TODO: Verify name format.
-	components := strings.Split(name, "/")
-	if len(name) == 0 {
-		components = nil
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	var components []string
+	if name != "." {
+		components = strings.Split(name, "/")
 	}
 
 	fid := f.cc.fidPool.Acquire()
 	defer func() {
-		if filp == nil {
+		if filp != nil {
 			return
 		}
 		f.cc.fidPool.Release(fid)
 	}()
 
-	_, err := f.cc.Walk(context.TODO(), f.rootFID, fid, components)
-	if err != nil {
-		return nil, fmt.Errorf("9p walk: %w", err)
+	if err := f.walk(fid, components); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
 	}
 
 	qid, iounit, err := f.cc.Open(context.TODO(), fid, mode)
 	if err != nil {
-		return nil, fmt.Errorf("9p open: %w", err)
+		f.cc.Clunk(context.TODO(), fid)
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
 	}
 	// If iounit is 0, we need to fall back to connection message
 	// size - 24.
@@ -165,7 +259,38 @@ func (f *FS) OpenFile(name string, mode uint8) (filp fs.File, openErr error) {
 		iounit = f.cc.msize - 24
 	}
 
-	return &file{FID: fid, cc: f.cc, iounit: iounit, QID: qid}, nil
+	return &file{FID: fid, cc: f.cc, iounit: iounit, QID: qid, name: name}, nil
+}
+
+// maxWalkElem is the maximum number of path elements per walk(5).
+const maxWalkElem = 16
+
+// walk walks fid from the root along the given path components.
+// On error, fid is not in use.
+func (f *FS) walk(fid uint32, components []string) error {
+	from := f.rootFID
+	for first := true; first || len(components) > 0; first = false {
+		names := components[:min(len(components), maxWalkElem)]
+		components = components[len(names):]
+
+		qids, err := f.cc.Walk(context.TODO(), from, fid, names)
+		if err != nil {
+			if !first {
+				f.cc.Clunk(context.TODO(), fid)
+			}
+			return err
+		}
+		if len(qids) < len(names) {
+			// Partial walk, the file does not exist.
+			// The newfid was not affected by it.
+			if !first {
+				f.cc.Clunk(context.TODO(), fid)
+			}
+			return fs.ErrNotExist
+		}
+		from = fid
+	}
+	return nil
 }
 
 // Close closes the underlying file system connection.
@@ -0,0 +1,151 @@
+package ninep_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/ninetest"
+)
+
+func dialFS(t *testing.T, files map[string]ninetest.File) *ninep.FS {
+	t.Helper()
+	srv := &ninetest.Server{Files: files}
+	fsys, err := srv.DialFS()
+	if err != nil {
+		t.Fatalf("DialFS: %v", err)
+	}
+	t.Cleanup(func() { fsys.Close() })
+	return fsys
+}
+
+var treeFiles = map[string]ninetest.File{
+	"NOTICE":               {Data: []byte("Copyright © 2002 Lucent Technologies Inc.\n"), Mode: 0444},
+	"empty":                {Mode: ninep.ModeDir | 0755},
+	"lib/font/README":      {Data: []byte("fonts\n"), Mode: 0644},
+	"lib/namespace":        {Data: []byte("mount -a #s/boot /\n"), Mode: 0644},
+	"sys/src/cmd/cat.c":    {Data: []byte("void\nmain(int argc, char *argv[])\n{\n}\n"), Mode: 0664},
+	"sys/src/cmd/ls.c":     {Data: make([]byte, 20000), Mode: 0664},
+	"sys/src/cmd/mkfile":   {Data: []byte("</$objtype/mkfile\n"), Mode: 0664},
+	"sys/src/cmd/tail.c":   {Data: []byte("tail"), Mode: 0664},
+	"sys/src/cmd/wc.c":     {Data: []byte("wc"), Mode: 0664},
+	"sys/src/cmd/xd.c":     {Data: []byte("xd"), Mode: 0664},
+	"usr/glenda/lib/prof":  {Data: []byte("bind -a $home/bin/rc /bin\n"), Mode: 0644},
+	"usr/glenda/tmp/a.txt": {Data: []byte("a"), Mode: ninep.ModeAppend | 0644},
+}
+
+func TestFSConformance(t *testing.T) {
+	fsys := dialFS(t, treeFiles)
+	if err := fstest.TestFS(fsys, "NOTICE", "lib/font/README", "sys/src/cmd/ls.c", "usr/glenda/tmp/a.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenNotExist(t *testing.T) {
+	fsys := dialFS(t, treeFiles)
+	for _, name := range []string{"nonexistent", "lib/nonexistent", "NOTICE/foo", "a/b/c/d/e/f/g/h/i/j/k/l/m/n/o/p/q/r"} {
+		_, err := fsys.Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q): got err %v, want %v", name, err, fs.ErrNotExist)
+		}
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	fsys := dialFS(t, treeFiles)
+	for _, name := range []string{"/NOTICE", "lib/", "lib/../NOTICE", ""} {
+		_, err := fsys.Open(name)
+		if !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Open(%q): got err %v, want %v", name, err, fs.ErrInvalid)
+		}
+	}
+}
+
+// bigDirFiles returns a directory with enough entries that listing it
+// takes several reads.
+func bigDirFiles() map[string]ninetest.File {
+	files := make(map[string]ninetest.File)
+	for i := 0; i < 500; i++ {
+		files[fmt.Sprintf("big/file%03d", i)] = ninetest.File{Mode: 0644}
+	}
+	return files
+}
+
+func readDirNames(t *testing.T, f fs.ReadDirFile, n int) []string {
+	t.Helper()
+	var names []string
+	for {
+		entries, err := f.ReadDir(n)
+		if n > 0 && len(entries) > n {
+			t.Fatalf("ReadDir(%d) returned %d entries", n, len(entries))
+		}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if err == io.EOF {
+			if len(entries) != 0 {
+				t.Fatalf("ReadDir(%d) returned io.EOF with %d entries", n, len(entries))
+			}
+			return names
+		}
+		if err != nil {
+			t.Fatalf("ReadDir(%d): %v", n, err)
+		}
+		if n <= 0 {
+			return names
+		}
+		if len(entries) == 0 {
+			t.Fatalf("ReadDir(%d) returned no entries and no error", n)
+		}
+	}
+}
+
+func TestReadDirPaging(t *testing.T) {
+	fsys := dialFS(t, bigDirFiles())
+	var want []string
+	for i := 0; i < 500; i++ {
+		want = append(want, fmt.Sprintf("file%03d", i))
+	}
+	for _, n := range []int{-1, 1, 3, 7, 64, 1000} {
+		f, err := fsys.Open("big")
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		got := readDirNames(t, f.(fs.ReadDirFile), n)
+		if !slices.Equal(got, want) {
+			t.Errorf("ReadDir(%d) loop: got %d entries %v, want %d entries", n, len(got), got, len(want))
+		}
+		f.Close()
+	}
+}
+
+func TestReadDirRewind(t *testing.T) {
+	fsys := dialFS(t, bigDirFiles())
+	f, err := fsys.Open("big")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	d := f.(fs.ReadDirFile)
+
+	first, err := d.ReadDir(5)
+	if err != nil {
+		t.Fatalf("ReadDir(5): %v", err)
+	}
+	if _, err := f.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek(0, io.SeekStart): %v", err)
+	}
+	again := readDirNames(t, d, 11)
+	if len(again) != 500 || again[0] != first[0].Name() {
+		t.Errorf("after rewind: got %d entries starting with %q, want 500 starting with %q", len(again), again[0], first[0].Name())
+	}
+
+	if _, err := f.(io.Seeker).Seek(1, io.SeekStart); err == nil {
+		t.Errorf("Seek(1, io.SeekStart) on directory: got nil error")
+	}
+}
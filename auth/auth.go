@@ -0,0 +1,379 @@
+// Package auth implements Plan 9 authentication for 9P connections.
+//
+// The client side plugs into ninep.AttachOpts.Authenticator and runs
+// the p9any negotiation on the authentication file, followed by the
+// chosen protocol, p9sk1 or 9front's dp9ik.  Tickets are obtained from
+// a Plan 9 authentication server, as described in authsrv(6).
+package auth
+
+import (
+	"bytes"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Sizes of fields and messages, from authsrv.h.
+const (
+	ANAMELEN  = 28 // Name length
+	AERRLEN   = 64 // Error message length
+	DOMLEN    = 48 // Authentication domain length
+	DESKEYLEN = 7  // DES key length
+	AESKEYLEN = 16 // AES key length
+	CHALLEN   = 8  // Challenge length
+	NONCELEN  = 32 // Nonce and session key length
+
+	TICKREQLEN = 3*ANAMELEN + CHALLEN + DOMLEN + 1 // Ticket request length
+
+	// Lengths of tickets and authenticators in form 0 (DES) and
+	// form 1 (ChaCha20-Poly1305).
+	TICKETLEN     = CHALLEN + 2*ANAMELEN + DESKEYLEN + 1
+	MAXTICKETLEN  = 12 + CHALLEN + 2*ANAMELEN + NONCELEN + 16
+	AUTHENTLEN    = CHALLEN + 4 + 1
+	MAXAUTHENTLEN = 12 + CHALLEN + NONCELEN + 16
+)
+
+// Message types, from authsrv.h.
+const (
+	AuthTreq = 1  // Ticket request
+	AuthOK   = 4  // Success
+	AuthErr  = 5  // Error, followed by AERRLEN bytes of message
+	AuthPAK  = 19 // Authenticated key exchange, for dp9ik
+
+	AuthTs = 64 // Ticket encrypted with the server's key
+	AuthTc = 65 // Ticket encrypted with the client's key
+	AuthAs = 66 // Server generated authenticator
+	AuthAc = 67 // Client generated authenticator
+)
+
+// Key is a user's secret, as shared with the authentication server.
+type Key struct {
+	DES [DESKEYLEN]byte // Key for p9sk1
+	AES [AESKEYLEN]byte // Key for dp9ik
+}
+
+// PassToKey derives a key from a password, like passtokey(2).
+func PassToKey(password string) Key {
+	k := Key{DES: passToDESKey(password)}
+	aes := pbkdf2.Key([]byte(password), []byte("Plan 9 key derivation"), 9001, AESKEYLEN, sha1.New)
+	copy(k.AES[:], aes)
+	return k
+}
+
+// passToDESKey derives the DES key from a password.
+func passToDESKey(password string) [DESKEYLEN]byte {
+	var k [DESKEYLEN]byte
+	p := []byte(password)
+	if len(p) >= ANAMELEN {
+		p = p[:ANAMELEN-1]
+	}
+	buf := make([]byte, ANAMELEN)
+	copy(buf, "        ")
+	n := copy(buf, p)
+	buf[n] = 0
+	t := 0 // Start of the current 8-byte window.
+	for {
+		for i := 0; i < DESKEYLEN; i++ {
+			k[i] = buf[t+i]>>i + buf[t+i+1]<<(8-(i+1))
+		}
+		if n <= 8 {
+			return k
+		}
+		n -= 8
+		t += 8
+		if n < 8 {
+			t -= 8 - n
+			n = 8
+		}
+		encrypt(k, buf[t:t+8])
+	}
+}
+
+// AuthInfo is the result of a successful authentication.
+type AuthInfo struct {
+	CUID   string // Caller id
+	SUID   string // Server id
+	Cap    string // Capability, only from factotum
+	Secret []byte // Secret shared by client and server
+}
+
+// des56to64 expands a 7-byte DES key to the 8-byte form which
+// crypto/des expects, with seven key bits at the top of each byte.
+// Like Plan 9's, it does not compute the parity bits, which DES
+// ignores.
+func des56to64(k56 [DESKEYLEN]byte) []byte {
+	hi := uint32(k56[0])<<24 | uint32(k56[1])<<16 | uint32(k56[2])<<8 | uint32(k56[3])
+	lo := uint32(k56[4])<<24 | uint32(k56[5])<<16 | uint32(k56[6])<<8
+	return []byte{
+		byte(hi >> 24), byte(hi >> 17), byte(hi >> 10), byte(hi >> 3),
+		byte(hi<<4 | lo>>28), byte(lo >> 21), byte(lo >> 14), byte(lo >> 7),
+	}
+}
+
+// encrypt encrypts buf in place like Plan 9's encrypt(2): DES blocks
+// are applied at every seventh byte, so that consecutive blocks
+// overlap by one byte.  The last block is aligned to the end of buf.
+func encrypt(key [DESKEYLEN]byte, buf []byte) {
+	c, err := des.NewCipher(des56to64(key))
+	if err != nil {
+		panic(err) // Not reached; the key has the right size.
+	}
+	n := (len(buf) - 1) / 7
+	r := (len(buf) - 1) % 7
+	for i := 0; i < n; i++ {
+		b := buf[7*i : 7*i+8]
+		c.Encrypt(b, b)
+	}
+	if r > 0 {
+		b := buf[7*n-7+r : 7*n+1+r]
+		c.Encrypt(b, b)
+	}
+}
+
+// decrypt reverses encrypt.
+func decrypt(key [DESKEYLEN]byte, buf []byte) {
+	c, err := des.NewCipher(des56to64(key))
+	if err != nil {
+		panic(err) // Not reached; the key has the right size.
+	}
+	n := (len(buf) - 1) / 7
+	r := (len(buf) - 1) % 7
+	if r > 0 {
+		b := buf[7*n-7+r : 7*n+1+r]
+		c.Decrypt(b, b)
+	}
+	for i := n - 1; i >= 0; i-- {
+		b := buf[7*i : 7*i+8]
+		c.Decrypt(b, b)
+	}
+}
+
+// putString writes s into the fixed-size, NUL-padded field buf.
+func putString(buf []byte, s string) {
+	clear(buf)
+	copy(buf[:len(buf)-1], s)
+}
+
+// appendString appends s to buf as NUL-padded field of size n.
+func appendString(buf []byte, s string, n int) []byte {
+	field := make([]byte, n)
+	putString(field, s)
+	return append(buf, field...)
+}
+
+// getString reads a NUL-padded string from the field buf.
+func getString(buf []byte) string {
+	if i := bytes.IndexByte(buf, 0); i >= 0 {
+		buf = buf[:i]
+	}
+	return string(buf)
+}
+
+// Ticketreq is a ticket request, sent from the server to the client
+// and passed on by the client to the authentication server.
+type Ticketreq struct {
+	Type    byte
+	AuthID  string // Server's encryption id
+	AuthDom string // Server's authentication domain
+	Chal    [CHALLEN]byte
+	HostID  string // Host's encryption id
+	UID     string // UID of requesting user on host
+}
+
+// MarshalBinary returns the TICKREQLEN bytes wire form of tr.
+func (tr *Ticketreq) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, TICKREQLEN)
+	buf[0] = tr.Type
+	p := buf[1:]
+	putString(p[:ANAMELEN], tr.AuthID)
+	p = p[ANAMELEN:]
+	putString(p[:DOMLEN], tr.AuthDom)
+	p = p[DOMLEN:]
+	copy(p, tr.Chal[:])
+	p = p[CHALLEN:]
+	putString(p[:ANAMELEN], tr.HostID)
+	p = p[ANAMELEN:]
+	putString(p[:ANAMELEN], tr.UID)
+	return buf, nil
+}
+
+// UnmarshalBinary parses the wire form of a ticket request.
+func (tr *Ticketreq) UnmarshalBinary(buf []byte) error {
+	if len(buf) != TICKREQLEN {
+		return fmt.Errorf("ticket request has length %d, want %d", len(buf), TICKREQLEN)
+	}
+	tr.Type = buf[0]
+	p := buf[1:]
+	tr.AuthID = getString(p[:ANAMELEN])
+	p = p[ANAMELEN:]
+	tr.AuthDom = getString(p[:DOMLEN])
+	p = p[DOMLEN:]
+	copy(tr.Chal[:], p)
+	p = p[CHALLEN:]
+	tr.HostID = getString(p[:ANAMELEN])
+	p = p[ANAMELEN:]
+	tr.UID = getString(p[:ANAMELEN])
+	return nil
+}
+
+// Ticket is a ticket issued by the authentication server.
+type Ticket struct {
+	Num  byte // AuthTs or AuthTc
+	Chal [CHALLEN]byte
+	CUID string         // UID on client
+	SUID string         // UID on server
+	Key  [NONCELEN]byte // Session key; DESKEYLEN bytes in form 0
+	Form int            // 0 for p9sk1, 1 for dp9ik; not transmitted
+}
+
+// Seal returns the wire form of t, encrypted with key.  In form 0,
+// key is a DES key; in form 1, it is the key from the AuthPAK
+// exchange.
+func (t *Ticket) Seal(key []byte) ([]byte, error) {
+	buf := make([]byte, 0, MAXTICKETLEN)
+	buf = append(buf, t.Num)
+	buf = append(buf, t.Chal[:]...)
+	buf = appendString(buf, t.CUID, ANAMELEN)
+	buf = appendString(buf, t.SUID, ANAMELEN)
+	switch t.Form {
+	case 0:
+		if len(key) != DESKEYLEN {
+			return nil, errors.New("ticket: bad DES key")
+		}
+		buf = append(buf, t.Key[:DESKEYLEN]...)
+		encrypt([DESKEYLEN]byte(key), buf)
+		return buf, nil
+	case 1:
+		buf = append(buf, t.Key[:]...)
+		return form1Seal(buf, key)
+	default:
+		return nil, fmt.Errorf("ticket: unknown form %d", t.Form)
+	}
+}
+
+// OpenTicket decrypts the wire form of a ticket with key.  The form
+// of the ticket is recognized from buf, and key must be of the
+// corresponding kind, as in Seal.  In form 0, a wrong key results in
+// a ticket with the wrong Num.
+func OpenTicket(buf, key []byte) (*Ticket, error) {
+	t := &Ticket{}
+	if _, ok := form1Num(buf); ok {
+		msg, err := form1Open(buf, key)
+		if err != nil {
+			return nil, fmt.Errorf("ticket: %w", err)
+		}
+		if len(msg) != MAXTICKETLEN-12-16+1 {
+			return nil, fmt.Errorf("ticket: bad length %d", len(buf))
+		}
+		buf, t.Form = msg, 1
+	} else {
+		if len(buf) != TICKETLEN {
+			return nil, fmt.Errorf("ticket has length %d, want %d", len(buf), TICKETLEN)
+		}
+		if len(key) != DESKEYLEN {
+			return nil, errors.New("ticket: bad DES key")
+		}
+		buf = bytes.Clone(buf)
+		decrypt([DESKEYLEN]byte(key), buf)
+	}
+	t.Num = buf[0]
+	p := buf[1:]
+	copy(t.Chal[:], p)
+	p = p[CHALLEN:]
+	t.CUID = getString(p[:ANAMELEN])
+	p = p[ANAMELEN:]
+	t.SUID = getString(p[:ANAMELEN])
+	p = p[ANAMELEN:]
+	copy(t.Key[:], p)
+	return t, nil
+}
+
+// ticketLen returns the length of the ticket starting with prefix,
+// which has to be at least 8 bytes long.
+func ticketLen(prefix []byte) int {
+	if _, ok := form1Num(prefix); ok {
+		return MAXTICKETLEN
+	}
+	return TICKETLEN
+}
+
+// desKey returns the DES key of a form 0 ticket.
+func (t *Ticket) desKey() [DESKEYLEN]byte {
+	return [DESKEYLEN]byte(t.Key[:DESKEYLEN])
+}
+
+// authenticator proves the possession of a ticket's key.
+type authenticator struct {
+	num  byte // AuthAs or AuthAc
+	chal [CHALLEN]byte
+	rand [NONCELEN]byte // Nonce; only 4 bytes in form 0
+}
+
+// seal returns the wire form of a, encrypted with the key of t.
+func (a *authenticator) seal(t *Ticket) []byte {
+	buf := make([]byte, 0, MAXAUTHENTLEN)
+	buf = append(buf, a.num)
+	buf = append(buf, a.chal[:]...)
+	if t.Form == 0 {
+		buf = append(buf, a.rand[:4]...)
+		encrypt(t.desKey(), buf)
+		return buf
+	}
+	buf = append(buf, a.rand[:]...)
+	buf, _ = form1Seal(buf, t.Key[:])
+	return buf
+}
+
+// openAuthenticator decrypts an authenticator with the key of t.
+func openAuthenticator(buf []byte, t *Ticket) (*authenticator, error) {
+	if t.Form == 0 {
+		buf = bytes.Clone(buf)
+		decrypt(t.desKey(), buf)
+	} else {
+		var err error
+		if buf, err = form1Open(buf, t.Key[:]); err != nil {
+			return nil, fmt.Errorf("authenticator: %w", err)
+		}
+		if len(buf) != 1+CHALLEN+NONCELEN {
+			return nil, errors.New("authenticator: bad length")
+		}
+	}
+	a := &authenticator{num: buf[0]}
+	copy(a.chal[:], buf[1:])
+	copy(a.rand[:], buf[1+CHALLEN:])
+	return a, nil
+}
+
+// authenticatorLen returns the length of authenticators in the form
+// of t.
+func authenticatorLen(t *Ticket) int {
+	if t.Form == 0 {
+		return AUTHENTLEN
+	}
+	return MAXAUTHENTLEN
+}
+
+// newChallenge returns a random challenge.
+func newChallenge() (c [CHALLEN]byte) {
+	rand.Read(c[:])
+	return c
+}
+
+var errAuthFailed = errors.New("authentication failed")
+
+// readN reads exactly n bytes from r.
+func readN(r io.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
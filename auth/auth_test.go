@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/des"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDES56to64(t *testing.T) {
+	k56 := [DESKEYLEN]byte{0x80, 0x01, 0xfe, 0x55, 0xaa, 0x12, 0x34}
+	k64 := des56to64(k56)
+	// The upper seven bits of each byte are the key bits, in order.
+	var got, want uint64
+	for _, b := range k64 {
+		got = got<<7 | uint64(b>>1)
+	}
+	for _, b := range k56 {
+		want = want<<8 | uint64(b)
+	}
+	if got != want {
+		t.Errorf("des56to64(%x) = %x, carries key bits %x, want %x", k56, k64, got, want)
+	}
+}
+
+// TestDESKnownAnswer checks des56to64 and 8-byte encrypt(2) against
+// the DES vectors of FIPS 81 and of Schneier's Applied Cryptography.
+// The 56-bit keys are the 64-bit ones without their parity bits.
+func TestDESKnownAnswer(t *testing.T) {
+	for _, tc := range []struct{ k56, k64, plain, cipher string }{
+		{"12695bc9b7b7f8", "133457799bbcdff1", "0123456789abcdef", "85e813540f0ab405"},
+		{"0e66499ead8339", "0e329232ea6d0d73", "8787878787878787", "0000000000000000"},
+	} {
+		k56 := [DESKEYLEN]byte(unhex(t, tc.k56))
+		k64 := des56to64(k56)
+		want := unhex(t, tc.k64)
+		// DES ignores the parity bits, which Plan 9 does not set.
+		for i := range want {
+			k64[i] &^= 1
+			want[i] &^= 1
+		}
+		if !bytes.Equal(k64, want) {
+			t.Errorf("des56to64(%s) = %x, want %x", tc.k56, k64, want)
+		}
+		buf := unhex(t, tc.plain)
+		encrypt(k56, buf)
+		if got := hex.EncodeToString(buf); got != tc.cipher {
+			t.Errorf("encrypt(%s, %s) = %s, want %s", tc.k56, tc.plain, got, tc.cipher)
+		}
+		decrypt(k56, buf)
+		if got := hex.EncodeToString(buf); got != tc.plain {
+			t.Errorf("decrypt(%s, %s) = %s, want %s", tc.k56, tc.cipher, got, tc.plain)
+		}
+	}
+}
+
+// desAt applies DES blocks to buf at the given offsets, in order, as a
+// model of encrypt(2) from Plan 9's libc.
+func desAt(t *testing.T, k56 [DESKEYLEN]byte, buf []byte, offsets ...int) {
+	t.Helper()
+	c, err := des.NewCipher(des56to64(k56))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range offsets {
+		c.Encrypt(buf[o:o+8], buf[o:o+8])
+	}
+}
+
+func TestEncryptLayout(t *testing.T) {
+	k56 := [DESKEYLEN]byte(unhex(t, "12695bc9b7b7f8"))
+	for _, tc := range []struct {
+		n       int
+		offsets []int
+	}{
+		{8, []int{0}},
+		{9, []int{0, 1}},
+		{13, []int{0, 5}}, // AUTHENTLEN
+		{15, []int{0, 7}},
+		{16, []int{0, 7, 8}},
+		{72, []int{0, 7, 14, 21, 28, 35, 42, 49, 56, 63, 64}}, // TICKETLEN
+	} {
+		plain := make([]byte, tc.n)
+		for i := range plain {
+			plain[i] = byte(i)
+		}
+		want := bytes.Clone(plain)
+		desAt(t, k56, want, tc.offsets...)
+		got := bytes.Clone(plain)
+		encrypt(k56, got)
+		if !bytes.Equal(got, want) {
+			t.Errorf("encrypt of %d bytes = %x, want DES at offsets %v = %x", tc.n, got, tc.offsets, want)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := PassToKey("secret")
+	for _, n := range []int{8, 9, 13, 15, 16, TICKETLEN, AUTHENTLEN} {
+		plain := make([]byte, n)
+		for i := range plain {
+			plain[i] = byte(i)
+		}
+		buf := bytes.Clone(plain)
+		encrypt(key.DES, buf)
+		if bytes.Equal(buf, plain) {
+			t.Errorf("encrypt(%x) did not change the plaintext", plain)
+		}
+		decrypt(key.DES, buf)
+		if !bytes.Equal(buf, plain) {
+			t.Errorf("decrypt(encrypt(%x)) = %x", plain, buf)
+		}
+	}
+}
+
+func TestPassToKey(t *testing.T) {
+	keys := make(map[Key]string)
+	for _, pw := range []string{"", "glenda", "glenda1", "password", "a longer password", "a longer passwore"} {
+		k := PassToKey(pw)
+		if other, ok := keys[k]; ok {
+			t.Errorf("PassToKey(%q) = PassToKey(%q) = %x", pw, other, k.DES)
+		}
+		keys[k] = pw
+		if k2 := PassToKey(pw); k2 != k {
+			t.Errorf("PassToKey(%q) is not deterministic: %x, %x", pw, k.DES, k2.DES)
+		}
+	}
+	// Keys of short passwords pack the low seven bits of each byte of
+	// the NUL-terminated, blank-padded password.
+	for _, tc := range []struct{ pw, padded string }{
+		{"abc", "abc\x00    "},
+		{"abcdefg", "abcdefg\x00"},
+	} {
+		var want uint64
+		for i := 0; i < 8; i++ {
+			want |= uint64(tc.padded[i]&0x7f) << (7 * i)
+		}
+		var got uint64
+		for i, b := range PassToKey(tc.pw).DES {
+			got |= uint64(b) << (8 * i)
+		}
+		if got != want {
+			t.Errorf("PassToKey(%q) = %014x, want %014x", tc.pw, got, want)
+		}
+	}
+}
+
+// TestForm0Layout checks the plaintext of form 0 tickets and
+// authenticators against authsrv(6): the fields in order, names
+// NUL-padded, and the whole message encrypted with encrypt(2).
+func TestForm0Layout(t *testing.T) {
+	k56 := [DESKEYLEN]byte(unhex(t, "12695bc9b7b7f8"))
+	tk := &Ticket{Num: AuthTc, Chal: [CHALLEN]byte{1, 2, 3, 4, 5, 6, 7, 8}, CUID: "glenda", SUID: "bootes"}
+	copy(tk.Key[:], "SESSION")
+	buf, err := tk.Seal(k56[:])
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	want := []byte{AuthTc, 1, 2, 3, 4, 5, 6, 7, 8}
+	want = append(want, "glenda"+string(make([]byte, ANAMELEN-6))...)
+	want = append(want, "bootes"+string(make([]byte, ANAMELEN-6))...)
+	want = append(want, "SESSION"...)
+	desAt(t, k56, want, 0, 7, 14, 21, 28, 35, 42, 49, 56, 63, 64)
+	if !bytes.Equal(buf, want) {
+		t.Errorf("Seal(%+v) =\n%x, want\n%x", tk, buf, want)
+	}
+
+	a := &authenticator{num: AuthAc, chal: tk.Chal, rand: [NONCELEN]byte{0xde, 0xad, 0xbe, 0xef, 0xff}}
+	want = []byte{AuthAc, 1, 2, 3, 4, 5, 6, 7, 8, 0xde, 0xad, 0xbe, 0xef}
+	desAt(t, tk.desKey(), want, 0, 5)
+	if got := a.seal(tk); !bytes.Equal(got, want) {
+		t.Errorf("authenticator seal = %x, want %x", got, want)
+	}
+}
+
+// TODO: Add known-answer vectors from a Plan 9 or 9front authsrv:
+// passtokey results for passwords longer than 8 bytes, which go
+// through encrypt(2), and a recorded p9sk1 exchange.  The DES vectors
+// above come from FIPS 81, and the layouts from authsrv(6).
+func TestTicketRoundTrip(t *testing.T) {
+	desKey := PassToKey("bootes").DES
+	pakKey := bytes.Repeat([]byte{0x42}, PAKKEYLEN)
+	for _, tc := range []struct {
+		form     int
+		key, bad []byte
+		len      int
+	}{
+		{0, desKey[:], make([]byte, DESKEYLEN), TICKETLEN},
+		{1, pakKey, make([]byte, PAKKEYLEN), MAXTICKETLEN},
+	} {
+		want := Ticket{Num: AuthTs, Chal: [CHALLEN]byte{1, 2, 3, 4, 5, 6, 7, 8}, CUID: "glenda", SUID: "glenda", Form: tc.form}
+		copy(want.Key[:], "0123456789abcdef0123456789abcdef")
+		if tc.form == 0 {
+			want.Key = [NONCELEN]byte{9, 8, 7, 6, 5, 4, 3}
+		}
+		buf, err := want.Seal(tc.key)
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		if len(buf) != tc.len || ticketLen(buf) != tc.len {
+			t.Errorf("form %d: len(Seal()) = %d, ticketLen = %d, want %d", tc.form, len(buf), ticketLen(buf), tc.len)
+		}
+		got, err := OpenTicket(buf, tc.key)
+		if err != nil {
+			t.Fatalf("OpenTicket: %v", err)
+		}
+		if *got != want {
+			t.Errorf("OpenTicket(Seal(%+v)) = %+v", want, *got)
+		}
+		if got, err := OpenTicket(buf, tc.bad); err == nil && got.Num == AuthTs {
+			t.Errorf("form %d: OpenTicket with wrong key succeeded", tc.form)
+		}
+	}
+}
+
+func TestTicketreqRoundTrip(t *testing.T) {
+	want := Ticketreq{Type: AuthTreq, AuthID: "bootes", AuthDom: "example.org", Chal: [CHALLEN]byte{1, 2, 3}, HostID: "glenda", UID: "glenda"}
+	buf, _ := want.MarshalBinary()
+	if len(buf) != TICKREQLEN {
+		t.Fatalf("len(MarshalBinary()) = %d, want %d", len(buf), TICKREQLEN)
+	}
+	var got Ticketreq
+	if err := got.UnmarshalBinary(buf); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if got != want {
+		t.Errorf("UnmarshalBinary(MarshalBinary(%+v)) = %+v", want, got)
+	}
+}
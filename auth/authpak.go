@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// AuthPAK is the password authenticated key exchange used by dp9ik,
+// following 9front's authpak(2): SPAKE2-EE on the Ed448 curve, with
+// points encoded using Decaf and passwords hashed to points using
+// Elligator 2.  The arithmetic takes the same time for all secret
+// values.
+
+// Sizes of AuthPAK values.
+const (
+	PAKKEYLEN = 32            // Size of the derived key
+	PAKSLEN   = (448 + 7) / 8 // Size of an Ed448 scalar
+	PAKYLEN   = PAKSLEN       // Size of a public key
+	PAKXLEN   = PAKSLEN       // Size of a private key
+)
+
+// pakCurve holds the parameters of the twisted Edwards curve
+// a*x² + y² = 1 + d*x²*y² modulo p, with base point (gx, gy), and the
+// smallest non-square n modulo p, which Elligator uses.
+type pakCurve struct {
+	a, d, gx, gy, n fe
+}
+
+var ed448 = newEd448()
+
+// newEd448 returns the curve of 9front's ed448.mp.  Its base point is
+// the one of the Goldilocks paper, with y = 19, not the one of
+// RFC 8032.  As in 9front's spake2ee.mp, n is found by searching.
+func newEd448() *pakCurve {
+	c := &pakCurve{a: fe{1}, d: feSub(fe{}, fe{39081}), gy: fe{19}}
+	gx, _ := hex.DecodeString("297ea0ea2692ff1b4faff46098453a6a26adf733245f065c3c59d0709cecfa96147eaaf3932d94c63d96c170033f4ba0c7f0de840aed939f")
+	c.gx = feFromBytes(gx)
+	for n := int64(2); ; n++ {
+		if big.Jacobi(big.NewInt(n), bigP) == -1 {
+			c.n = fe{uint64(n)}
+			break
+		}
+	}
+	return c
+}
+
+// Field arithmetic modulo p, see p448.go.
+
+func (c *pakCurve) add(x, y fe) fe { return feAdd(x, y) }
+func (c *pakCurve) sub(x, y fe) fe { return feSub(x, y) }
+func (c *pakCurve) neg(x fe) fe    { return feSub(fe{}, x) }
+
+func (c *pakCurve) mul(xs ...fe) fe {
+	r := fe{1}
+	for _, x := range xs {
+		r = feMul(r, x)
+	}
+	return r
+}
+
+// inv returns 1/x, or 0 for x = 0.
+func (c *pakCurve) inv(x fe) fe { return fePow(x, feInvExp) }
+
+// sqrt returns a square root of x, and 1 if there is one, 0 if not.
+// It relies on p ≡ 3 (mod 4).
+func (c *pakCurve) sqrt(x fe) (fe, uint64) {
+	r := fePow(x, feSqrtExp)
+	return r, feEqual(feMul(r, r), x)
+}
+
+// isqrt returns 1/sqrt(x), and 1 if there is one.  If there is none,
+// it returns 0 and 0.  For x = 0, it returns 0 and 1.
+func (c *pakCurve) isqrt(x fe) (fe, uint64) {
+	r, ok := c.sqrt(x)
+	return feSelect(ok, c.inv(r), fe{}), ok
+}
+
+// abs returns -x if x is negative, x otherwise.
+func (c *pakCurve) abs(x fe) fe {
+	return feSelect(feIsNeg(x), c.neg(x), x)
+}
+
+// point is a curve point in extended coordinates, with
+// x = X/Z, y = Y/Z, and x*y = T/Z.
+type point struct {
+	X, Y, Z, T fe
+}
+
+func (c *pakCurve) identity() point {
+	return point{fe{}, fe{1}, fe{1}, fe{}}
+}
+
+func (c *pakCurve) base() point {
+	return point{c.gx, c.gy, fe{1}, c.mul(c.gx, c.gy)}
+}
+
+// addPoints returns P+Q, using the unified addition formula, which
+// also doubles.
+func (c *pakCurve) addPoints(P, Q point) point {
+	A := c.mul(P.X, Q.X)
+	B := c.mul(P.Y, Q.Y)
+	C := c.mul(c.d, P.T, Q.T)
+	D := c.mul(P.Z, Q.Z)
+	E := c.sub(c.sub(c.mul(c.add(P.X, P.Y), c.add(Q.X, Q.Y)), A), B)
+	F := c.sub(D, C)
+	G := c.add(D, C)
+	H := c.sub(B, c.mul(c.a, A))
+	return point{c.mul(E, F), c.mul(G, H), c.mul(F, G), c.mul(E, H)}
+}
+
+func (c *pakCurve) negPoint(P point) point {
+	return point{c.neg(P.X), P.Y, P.Z, c.neg(P.T)}
+}
+
+func selectPoint(b uint64, P, Q point) point {
+	return point{feSelect(b, P.X, Q.X), feSelect(b, P.Y, Q.Y), feSelect(b, P.Z, Q.Z), feSelect(b, P.T, Q.T)}
+}
+
+// scale returns k*P for the big-endian scalar k.  It adds for every
+// bit of k, and keeps the sum only for the bits which are set.
+func (c *pakCurve) scale(k []byte, P point) point {
+	R := c.identity()
+	for _, b := range k {
+		for i := 7; i >= 0; i-- {
+			R = c.addPoints(R, R)
+			R = selectPoint(uint64(b>>i)&1, c.addPoints(R, P), R)
+		}
+	}
+	return R
+}
+
+// encode returns the Decaf encoding of P.  Points which differ by a
+// point of order 4 have the same encoding.
+func (c *pakCurve) encode(P point) fe {
+	amd := c.sub(c.a, c.d)
+	r, _ := c.isqrt(c.mul(amd, c.add(P.Z, P.Y), c.sub(P.Z, P.Y)))
+	u := c.mul(amd, r)
+	r = feSelect(feIsNeg(c.mul(c.neg(fe{2}), u, P.Z)), c.neg(r), r)
+	s := c.add(c.mul(r, c.sub(c.mul(c.a, P.Z, P.X), c.mul(c.d, P.Y, P.T))), P.Y)
+	s = c.mul(u, s, c.inv(c.a))
+	return c.abs(s)
+}
+
+// decode returns a point with the Decaf encoding b, a big-endian
+// number.  Encodings are public, so decode may fail early.
+func (c *pakCurve) decode(b []byte) (point, bool) {
+	s := feFromBytes(b)
+	if !bytes.Equal(s.bytes(), b) || feIsNeg(s) == 1 {
+		return point{}, false
+	}
+	ss := c.mul(s, s)
+	Z := c.add(fe{1}, c.mul(c.a, ss))
+	u := c.sub(c.mul(Z, Z), c.mul(fe{4}, c.d, ss))
+	v, ok := c.isqrt(c.mul(u, ss))
+	if ok == 0 {
+		return point{}, false
+	}
+	v = feSelect(feIsNeg(c.mul(u, v)), c.neg(v), v)
+	w := c.mul(v, s, c.sub(fe{2}, Z))
+	w = c.add(w, fe{feIsZero(s)})
+	X := c.mul(fe{2}, s)
+	return point{X, c.mul(w, Z), Z, c.mul(w, X)}, true
+}
+
+// elligator maps the field element r0 to a curve point.
+func (c *pakCurve) elligator(r0 fe) point {
+	a, d := c.a, c.d
+	one := fe{1}
+	r := c.mul(c.n, r0, r0)
+	D := c.mul(c.add(c.mul(d, r), c.sub(a, d)), c.sub(c.sub(c.mul(d, r), c.mul(a, r)), d))
+	a2d := c.sub(a, c.mul(fe{2}, d))
+	N := c.mul(c.add(r, one), a2d)
+	ND := c.mul(N, D)
+	// If ND is a square, including 0, then cc = 1 and e = 1/sqrt(ND),
+	// otherwise cc = -1 and e = n*r0/sqrt(n*ND).
+	e1, square := c.isqrt(ND)
+	irt, _ := c.isqrt(c.mul(c.n, ND))
+	e := feSelect(square, e1, c.mul(c.n, r0, irt))
+	cc := feSelect(square, one, c.neg(one))
+	s := c.mul(cc, N, e)
+	ae := c.mul(a2d, e)
+	t := c.sub(c.mul(c.neg(cc), N, c.sub(r, one), ae, ae), one)
+	as2 := c.mul(a, s, s)
+	return point{
+		X: c.mul(fe{2}, s, t),
+		Y: c.mul(c.sub(one, as2), c.add(one, as2)),
+		Z: c.mul(c.add(one, as2), t),
+		T: c.mul(fe{2}, s, c.sub(one, as2)),
+	}
+}
+
+// pakHash holds the points derived from a user's key, PM for the
+// authentication server and PN for the other parties.
+type pakHash struct {
+	PM, PN point
+}
+
+// newPAKHash derives the password points for user from key.
+func newPAKHash(key *Key, user string) pakHash {
+	salt := sha256.Sum256([]byte(user))
+	h := make([]byte, 2*PAKSLEN)
+	kdf := hkdf.New(sha256.New, key.AES[:], salt[:], []byte("Plan 9 AuthPAK hash"))
+	if _, err := io.ReadFull(kdf, h); err != nil {
+		panic(err) // Not reached; the output is short.
+	}
+	return pakHash{
+		PM: ed448.elligator(feFromBytes(h[:PAKSLEN])),
+		PN: ed448.elligator(feFromBytes(h[PAKSLEN:])),
+	}
+}
+
+// PAKPriv is one party's state during an AuthPAK exchange.
+type PAKPriv struct {
+	isClient bool
+	h        pakHash
+	x        [PAKXLEN]byte
+	y        [PAKYLEN]byte
+}
+
+// NewPAK starts an AuthPAK exchange for user with key, and returns
+// the public key to be sent to the peer.  The authentication server
+// takes the server role, the other parties the client role.
+func NewPAK(key *Key, user string, isClient bool) (*PAKPriv, []byte) {
+	h := newPAKHash(key, user)
+	p := &PAKPriv{isClient: isClient, h: h}
+	rand.Read(p.x[:])
+	own := h.PM
+	if isClient {
+		own = h.PN
+	}
+	copy(p.y[:], ed448.encode(ed448.addPoints(ed448.scale(p.x[:], ed448.base()), own)).bytes())
+	return p, p.y[:]
+}
+
+// Finish completes the exchange with the peer's public key y and
+// returns the shared key.
+func (p *PAKPriv) Finish(y []byte) ([PAKKEYLEN]byte, error) {
+	var key [PAKKEYLEN]byte
+	if len(y) != PAKYLEN {
+		return key, errors.New("authpak: bad public key length")
+	}
+	Y, ok := ed448.decode(y)
+	if !ok {
+		return key, errors.New("authpak: bad public key")
+	}
+	peer := p.h.PN
+	if p.isClient {
+		peer = p.h.PM
+	}
+	z := ed448.encode(ed448.scale(p.x[:], ed448.addPoints(Y, ed448.negPoint(peer)))).bytes()
+
+	s := sha256.New()
+	if p.isClient {
+		s.Write(p.y[:])
+		s.Write(y)
+	} else {
+		s.Write(y)
+		s.Write(p.y[:])
+	}
+	kdf := hkdf.New(sha256.New, z, s.Sum(nil), []byte("Plan 9 AuthPAK key"))
+	if _, err := io.ReadFull(kdf, key[:]); err != nil {
+		return key, err
+	}
+	return key, nil
+}
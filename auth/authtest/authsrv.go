@@ -0,0 +1,150 @@
+// Package authtest provides a stand-in Plan 9 authentication server
+// for testing authentication without a Plan 9 installation.
+package authtest
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/gnoack/ninep/auth"
+)
+
+// AuthServer is a minimal authentication server, as described in
+// authsrv(6).  It only issues tickets, after an optional AuthPAK
+// exchange; a user may only request a ticket for themselves.
+type AuthServer struct {
+	// Domain is the authentication domain.  If set, ticket requests
+	// for other domains are refused.
+	Domain string
+	// Keys maps user names to keys.  Users include the file servers'
+	// IDs.
+	Keys map[string]auth.Key
+}
+
+// Serve accepts connections on l until it fails, and serves each of
+// them.
+func (s *AuthServer) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			s.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn answers requests on conn until the connection is closed.
+func (s *AuthServer) ServeConn(conn io.ReadWriter) error {
+	// Keys from AuthPAK exchanges, by user.
+	pakKeys := make(map[string][]byte)
+	for {
+		buf := make([]byte, auth.TICKREQLEN)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var tr auth.Ticketreq
+		tr.UnmarshalBinary(buf)
+		var resp []byte
+		var err error
+		switch tr.Type {
+		case auth.AuthTreq:
+			resp, err = s.ticketRequest(&tr, pakKeys)
+		case auth.AuthPAK:
+			ys := make([]byte, 2*auth.PAKYLEN)
+			if _, err := io.ReadFull(conn, ys); err != nil {
+				return err
+			}
+			resp, err = s.pak(&tr, ys, pakKeys)
+		default:
+			err = errors.New("unsupported request")
+		}
+		if err != nil {
+			msg := make([]byte, 1+auth.AERRLEN)
+			msg[0] = auth.AuthErr
+			copy(msg[1:auth.AERRLEN], err.Error())
+			resp = msg
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// lookup returns the keys of the server and the client of tr.
+func (s *AuthServer) lookup(tr *auth.Ticketreq) (akey, hkey auth.Key, err error) {
+	if s.Domain != "" && tr.AuthDom != s.Domain {
+		return akey, hkey, errors.New("unknown domain")
+	}
+	akey, ok := s.Keys[tr.AuthID]
+	if !ok {
+		return akey, hkey, errors.New("unknown user " + tr.AuthID)
+	}
+	hkey, ok = s.Keys[tr.HostID]
+	if !ok {
+		return akey, hkey, errors.New("unknown user " + tr.HostID)
+	}
+	return akey, hkey, nil
+}
+
+// pak runs AuthPAK with the server and the client of tr, whose public
+// keys are in ys, and returns the reply.
+func (s *AuthServer) pak(tr *auth.Ticketreq, ys []byte, pakKeys map[string][]byte) ([]byte, error) {
+	akey, hkey, err := s.lookup(tr)
+	if err != nil {
+		return nil, err
+	}
+	clear(pakKeys)
+	resp := []byte{auth.AuthOK}
+	for i, p := range []struct {
+		user string
+		key  auth.Key
+	}{{tr.AuthID, akey}, {tr.HostID, hkey}} {
+		priv, y := auth.NewPAK(&p.key, p.user, false)
+		k, err := priv.Finish(ys[i*auth.PAKYLEN : (i+1)*auth.PAKYLEN])
+		if err != nil {
+			return nil, err
+		}
+		pakKeys[p.user] = k[:]
+		resp = append(resp, y...)
+	}
+	return resp, nil
+}
+
+// ticketRequest returns the reply to a ticket request.  The tickets
+// are in form 1 if there was an AuthPAK exchange with both parties.
+func (s *AuthServer) ticketRequest(tr *auth.Ticketreq, pakKeys map[string][]byte) ([]byte, error) {
+	akey, hkey, err := s.lookup(tr)
+	if err != nil {
+		return nil, err
+	}
+	if tr.HostID != tr.UID {
+		return nil, errors.New(tr.HostID + " cannot speak for " + tr.UID)
+	}
+	t := auth.Ticket{Chal: tr.Chal, CUID: tr.HostID, SUID: tr.UID}
+	rand.Read(t.Key[:])
+	hk, ak := hkey.DES[:], akey.DES[:]
+	if pakKeys[tr.HostID] != nil && pakKeys[tr.AuthID] != nil {
+		t.Form = 1
+		hk, ak = pakKeys[tr.HostID], pakKeys[tr.AuthID]
+	}
+	resp := []byte{auth.AuthOK}
+	t.Num = auth.AuthTc
+	tc, err := t.Seal(hk)
+	if err != nil {
+		return nil, err
+	}
+	t.Num = auth.AuthTs
+	ts, err := t.Seal(ak)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(resp, tc...), ts...), nil
+}
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gnoack/ninep"
+)
+
+// authRPCMax is the maximum size of a message on factotum's rpc file.
+const authRPCMax = 4096
+
+// Factotum authenticates through factotum(4), so that keys stay out of
+// the process.  It relays the conversation between the authentication
+// file and factotum's rpc file, like auth_proxy(2).
+type Factotum struct {
+	// KeySpec holds additional attributes selecting the key,
+	// e.g. "dom=example.org user=glenda".
+	KeySpec string
+
+	// Open opens factotum's rpc file.  If nil, the rpc file of the
+	// "factotum" service in the plan9port namespace is used.
+	Open func() (io.ReadWriteCloser, error)
+}
+
+// Authenticate runs the client side of the p9any protocol on rw.
+// It has the signature of ninep.Authenticator.
+func (f *Factotum) Authenticate(rw io.ReadWriter) error {
+	_, err := f.Negotiate(rw)
+	return err
+}
+
+// Negotiate runs the client side of the p9any protocol on rw and
+// returns the result of the authentication.
+func (f *Factotum) Negotiate(rw io.ReadWriter) (*AuthInfo, error) {
+	open := f.Open
+	if open == nil {
+		open = openFactotumRPC
+	}
+	rpc, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("factotum: %w", err)
+	}
+	defer rpc.Close()
+
+	params := "proto=p9any role=client"
+	if f.KeySpec != "" {
+		params += " " + f.KeySpec
+	}
+	if r, err := authRPC(rpc, "start", []byte(params)); err != nil {
+		return nil, err
+	} else if r.status != "ok" {
+		return nil, fmt.Errorf("factotum start: %w", r.err())
+	}
+
+	for {
+		r, err := authRPC(rpc, "read", nil)
+		if err != nil {
+			return nil, err
+		}
+		switch r.status {
+		case "done":
+			return getAuthInfo(rpc)
+		case "ok":
+			if _, err := rw.Write(r.arg); err != nil {
+				return nil, fmt.Errorf("factotum: writing to server: %w", err)
+			}
+		case "phase":
+			// Factotum expects input; feed it as much as it asks for.
+			var buf []byte
+			for {
+				r, err = authRPC(rpc, "write", buf)
+				if err != nil {
+					return nil, err
+				}
+				if r.status != "toosmall" {
+					break
+				}
+				n, err := strconv.Atoi(string(r.arg))
+				if err != nil || n <= len(buf) || n > authRPCMax {
+					return nil, fmt.Errorf("factotum: bad toosmall %q", r.arg)
+				}
+				chunk := make([]byte, n-len(buf))
+				m, err := rw.Read(chunk)
+				if err == io.EOF || err == nil && m == 0 {
+					err = io.ErrUnexpectedEOF
+				}
+				if err != nil {
+					return nil, fmt.Errorf("factotum: reading from server: %w", err)
+				}
+				buf = append(buf, chunk[:m]...)
+			}
+			if r.status != "ok" {
+				return nil, fmt.Errorf("factotum write: %w", r.err())
+			}
+		default:
+			return nil, fmt.Errorf("factotum read: %w", r.err())
+		}
+	}
+}
+
+// rpcReply is a reply read from factotum's rpc file.
+type rpcReply struct {
+	status string // ok, done, error, needkey, badkey, phase or toosmall
+	arg    []byte
+}
+
+var rpcStatuses = []string{"ok", "done", "error", "needkey", "badkey", "phase", "toosmall"}
+
+// err returns the error described by a reply.
+func (r *rpcReply) err() error {
+	switch r.status {
+	case "error":
+		if len(r.arg) == 0 {
+			return errors.New("unspecified rpc error")
+		}
+		return errors.New(string(r.arg))
+	case "badkey":
+		// The second line describes the problem.
+		if _, msg, ok := strings.Cut(string(r.arg), "\n"); ok {
+			msg, _, _ = strings.Cut(msg, "\n")
+			return errors.New("badkey " + msg)
+		}
+		return errors.New("badkey " + string(r.arg))
+	case "phase":
+		return errors.New("phase error " + string(r.arg))
+	default:
+		return fmt.Errorf("%s %s", r.status, r.arg)
+	}
+}
+
+// authRPC does one transaction on factotum's rpc file, like
+// auth_rpc(2).
+func authRPC(rpc io.ReadWriter, verb string, arg []byte) (*rpcReply, error) {
+	msg := append([]byte(verb+" "), arg...)
+	if len(msg) > authRPCMax {
+		return nil, errors.New("factotum: rpc too big")
+	}
+	if _, err := rpc.Write(msg); err != nil {
+		return nil, fmt.Errorf("factotum: %w", err)
+	}
+	buf := make([]byte, authRPCMax)
+	n, err := rpc.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("factotum: %w", err)
+	}
+	buf = buf[:n]
+	for _, s := range rpcStatuses {
+		if rest, ok := bytes.CutPrefix(buf, []byte(s)); ok && (len(rest) == 0 || rest[0] == ' ') {
+			if len(rest) > 0 {
+				rest = rest[1:]
+			}
+			return &rpcReply{status: s, arg: rest}, nil
+		}
+	}
+	return nil, fmt.Errorf("factotum: malformed rpc response: %q", buf)
+}
+
+// getAuthInfo fetches the result of a finished conversation.
+func getAuthInfo(rpc io.ReadWriter) (*AuthInfo, error) {
+	r, err := authRPC(rpc, "authinfo", nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.status != "ok" {
+		return nil, fmt.Errorf("factotum authinfo: %w", r.err())
+	}
+	ai := &AuthInfo{}
+	if err := ai.UnmarshalBinary(r.arg); err != nil {
+		return nil, fmt.Errorf("factotum: %w", err)
+	}
+	return ai, nil
+}
+
+// UnmarshalBinary parses an AuthInfo as returned by factotum, with
+// the fields cuid[s] suid[s] cap[s] secret[s], each with a 2-byte
+// length.
+func (ai *AuthInfo) UnmarshalBinary(buf []byte) error {
+	var fields [4][]byte
+	for i := range fields {
+		if len(buf) < 2 {
+			return errors.New("authinfo too short")
+		}
+		n := int(binary.LittleEndian.Uint16(buf))
+		buf = buf[2:]
+		if len(buf) < n {
+			return errors.New("authinfo too short")
+		}
+		fields[i], buf = buf[:n], buf[n:]
+	}
+	ai.CUID = string(fields[0])
+	ai.SUID = string(fields[1])
+	ai.Cap = string(fields[2])
+	ai.Secret = bytes.Clone(fields[3])
+	return nil
+}
+
+// MarshalBinary returns the wire form of ai, as parsed by
+// UnmarshalBinary.
+func (ai *AuthInfo) MarshalBinary() ([]byte, error) {
+	var buf []byte
+	for _, f := range [][]byte{[]byte(ai.CUID), []byte(ai.SUID), []byte(ai.Cap), ai.Secret} {
+		if len(f) > 0xffff {
+			return nil, errors.New("authinfo field too long")
+		}
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(f)))
+		buf = append(buf, f...)
+	}
+	return buf, nil
+}
+
+// factotumRPC is the rpc file of factotum's 9P service.
+type factotumRPC struct {
+	io.ReadWriter
+	f    io.Closer
+	fsys *ninep.FS
+}
+
+func (r *factotumRPC) Close() error {
+	err := r.f.Close()
+	if cerr := r.fsys.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// openFactotumRPC opens the rpc file of the "factotum" service in the
+// plan9port namespace.
+func openFactotumRPC() (io.ReadWriteCloser, error) {
+	fsys, err := ninep.DialFS("factotum", ninep.DialFSOpts{
+		AttachOpts: ninep.AttachOpts{Uname: os.Getenv("USER")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	f, err := fsys.OpenFile("rpc", ninep.ORdWr)
+	if err != nil {
+		fsys.Close()
+		return nil, err
+	}
+	rw, ok := f.(io.ReadWriter)
+	if !ok {
+		f.Close()
+		fsys.Close()
+		return nil, errors.New("rpc file is not read-writable")
+	}
+	return &factotumRPC{ReadWriter: rw, f: f, fsys: fsys}, nil
+}
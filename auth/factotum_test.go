@@ -0,0 +1,127 @@
+package auth_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gnoack/ninep/auth"
+)
+
+// fakeRPC is a factotum rpc file which expects a fixed sequence of
+// requests.
+type fakeRPC struct {
+	t      *testing.T
+	script []rpcStep
+	reply  []byte
+	closed bool
+}
+
+type rpcStep struct{ req, resp string }
+
+func (r *fakeRPC) Write(p []byte) (int, error) {
+	if len(r.script) == 0 {
+		r.t.Errorf("unexpected rpc %q", p)
+		return 0, errors.New("unexpected rpc")
+	}
+	if string(p) != r.script[0].req {
+		r.t.Errorf("rpc request = %q, want %q", p, r.script[0].req)
+	}
+	r.reply = []byte(r.script[0].resp)
+	r.script = r.script[1:]
+	return len(p), nil
+}
+
+func (r *fakeRPC) Read(p []byte) (int, error) {
+	return copy(p, r.reply), nil
+}
+
+func (r *fakeRPC) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestFactotum(t *testing.T) {
+	want := &auth.AuthInfo{CUID: "glenda", SUID: "glenda", Cap: "cap", Secret: []byte{1, 2, 3}}
+	ai, _ := want.MarshalBinary()
+	rpc := &fakeRPC{t: t, script: []rpcStep{
+		{"start proto=p9any role=client dom=example.org", "ok"},
+		{"read ", "ok hello"},
+		{"read ", "phase need input"},
+		{"write ", "toosmall 6"},
+		{"write wor", "toosmall 6"},
+		{"write world!", "ok"},
+		{"read ", "done"},
+		{"authinfo ", "ok " + string(ai)},
+	}}
+	f := &auth.Factotum{
+		KeySpec: "dom=example.org",
+		Open:    func() (io.ReadWriteCloser, error) { return rpc, nil },
+	}
+
+	cconn, sconn := net.Pipe()
+	defer cconn.Close()
+	go func() {
+		defer sconn.Close()
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(sconn, buf); err != nil || string(buf) != "hello" {
+			t.Errorf("server read %q, %v; want %q", buf, err, "hello")
+		}
+		// The reply arrives in pieces.
+		sconn.Write([]byte("wor"))
+		sconn.Write([]byte("ld!"))
+	}()
+
+	got, err := f.Negotiate(cconn)
+	if err != nil {
+		t.Fatalf("Negotiate: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Negotiate() = %+v, want %+v", got, want)
+	}
+	if len(rpc.script) > 0 {
+		t.Errorf("rpc requests not sent: %v", rpc.script)
+	}
+	if !rpc.closed {
+		t.Errorf("rpc file not closed")
+	}
+}
+
+func TestFactotumError(t *testing.T) {
+	for _, tc := range []struct {
+		script  []rpcStep
+		wantErr string
+	}{
+		{
+			script:  []rpcStep{{"start proto=p9any role=client", "error no key matches proto=p9any"}},
+			wantErr: "no key matches",
+		},
+		{
+			script: []rpcStep{
+				{"start proto=p9any role=client", "ok"},
+				{"read ", "needkey proto=p9sk1 dom=example.org user? !password?"},
+			},
+			wantErr: "needkey proto=p9sk1",
+		},
+		{
+			script: []rpcStep{
+				{"start proto=p9any role=client", "ok"},
+				{"read ", "garbage"},
+			},
+			wantErr: "malformed rpc response",
+		},
+	} {
+		rpc := &fakeRPC{t: t, script: tc.script}
+		f := &auth.Factotum{Open: func() (io.ReadWriteCloser, error) { return rpc, nil }}
+		cconn, sconn := net.Pipe()
+		_, err := f.Negotiate(cconn)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("Negotiate() err = %v, want %q", err, tc.wantErr)
+		}
+		cconn.Close()
+		sconn.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Form 1 messages, as used by dp9ik, are encrypted with
+// ChaCha20-Poly1305.  The message type byte is replaced by a 12-byte
+// nonce, made of an 8-byte signature identifying the type and a
+// counter, and the authentication tag is appended.
+
+var form1sig = map[byte]string{
+	AuthTs: "form1 Ts",
+	AuthTc: "form1 Tc",
+	AuthAs: "form1 As",
+	AuthAc: "form1 Ac",
+}
+
+// form1Counter makes the nonces unique.
+var form1Counter atomic.Uint32
+
+// form1Num returns the message type of the form 1 message in buf.
+func form1Num(buf []byte) (byte, bool) {
+	if len(buf) < 8 {
+		return 0, false
+	}
+	for num, sig := range form1sig {
+		if string(buf[:8]) == sig {
+			return num, true
+		}
+	}
+	return 0, false
+}
+
+// form1Seal encrypts msg, which starts with the message type, with
+// the 32-byte key.
+func form1Seal(msg, key []byte) ([]byte, error) {
+	sig, ok := form1sig[msg[0]]
+	if !ok {
+		return nil, errors.New("form1: unsupported message type")
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12, 12+len(msg)-1+aead.Overhead())
+	copy(nonce, sig)
+	binary.LittleEndian.PutUint32(nonce[8:], form1Counter.Add(1)-1)
+	return aead.Seal(nonce, nonce, msg[1:], nil), nil
+}
+
+// form1Open decrypts and authenticates a message sealed by form1Seal.
+func form1Open(buf, key []byte) ([]byte, error) {
+	num, ok := form1Num(buf)
+	if !ok {
+		return nil, errors.New("form1: unknown signature")
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 12+aead.Overhead() {
+		return nil, errors.New("form1: message too short")
+	}
+	msg, err := aead.Open([]byte{num}, buf[:12], buf[12:], nil)
+	if err != nil {
+		return nil, errors.New("form1: decryption failed")
+	}
+	return msg, nil
+}
@@ -0,0 +1,170 @@
+package auth
+
+import "math/big"
+
+// Arithmetic modulo p = 2^448 - 2^224 - 1, the field of Ed448.
+//
+// The operations take the same time for all values, so that AuthPAK
+// does not leak the secret scalar or the password points through
+// timing.  Only the public exponents and the public loop bounds
+// decide the control flow.
+
+// fe is a field element as 16 limbs of 28 bits, least significant
+// first.  Between operations, limbs may exceed 28 bits by a little;
+// fe.bytes returns the unique representation.
+type fe [16]uint64
+
+const feMask = 1<<28 - 1
+
+// feP holds the limbs of p.
+var feP = fe{
+	feMask, feMask, feMask, feMask, feMask, feMask, feMask, feMask,
+	feMask - 1, feMask, feMask, feMask, feMask, feMask, feMask, feMask,
+}
+
+// Public exponents for inversion and square roots.
+var (
+	bigP      = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 448), new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 224), big.NewInt(1)))
+	feInvExp  = new(big.Int).Sub(bigP, big.NewInt(2))
+	feSqrtExp = new(big.Int).Rsh(new(big.Int).Add(bigP, big.NewInt(1)), 2)
+)
+
+// carry propagates the carries between the limbs.  The carry out of
+// the top limb is folded back using 2^448 = 2^224 + 1 (mod p).
+func (x *fe) carry() {
+	for range 2 {
+		for i := 0; i < 15; i++ {
+			x[i+1] += x[i] >> 28
+			x[i] &= feMask
+		}
+		top := x[15] >> 28
+		x[15] &= feMask
+		x[0] += top
+		x[8] += top
+	}
+}
+
+func feAdd(a, b fe) fe {
+	var z fe
+	for i := range z {
+		z[i] = a[i] + b[i]
+	}
+	z.carry()
+	return z
+}
+
+// feSub returns a-b, computed as a+2p-b to stay positive.
+func feSub(a, b fe) fe {
+	var z fe
+	for i := range z {
+		z[i] = a[i] + 2*feP[i] - b[i]
+	}
+	z.carry()
+	return z
+}
+
+func feMul(a, b fe) fe {
+	var t [32]uint64
+	for i := range a {
+		for j := range b {
+			t[i+j] += a[i] * b[j]
+		}
+	}
+	for i := 0; i < 31; i++ {
+		t[i+1] += t[i] >> 28
+		t[i] &= feMask
+	}
+	// Fold the upper half, from the top down, as the limbs 16 to 23
+	// receive the limbs 24 to 31 first.
+	for k := 31; k >= 16; k-- {
+		t[k-16] += t[k]
+		t[k-8] += t[k]
+	}
+	var z fe
+	copy(z[:], t[:16])
+	z.carry()
+	return z
+}
+
+// fePow returns x^e, for a public exponent e.
+func fePow(x fe, e *big.Int) fe {
+	r := fe{1}
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		r = feMul(r, r)
+		if e.Bit(i) == 1 {
+			r = feMul(r, x)
+		}
+	}
+	return r
+}
+
+// feSelect returns a if c is 1 and b if c is 0.
+func feSelect(c uint64, a, b fe) fe {
+	m := -c
+	var z fe
+	for i := range z {
+		z[i] = b[i] ^ ((a[i] ^ b[i]) & m)
+	}
+	return z
+}
+
+// reduce returns x with limbs of 28 bits and a value below p.
+func (x fe) reduce() fe {
+	x.carry()
+	x.carry()
+	// Now x < 2^448 < 2p; subtract p if x ≥ p.
+	var d fe
+	var borrow uint64
+	for i := range x {
+		v := x[i] - feP[i] - borrow
+		borrow = v >> 63
+		d[i] = v & feMask
+	}
+	return feSelect(1-borrow, d, x)
+}
+
+// feIsZero returns 1 if x = 0 (mod p), and 0 otherwise.
+func feIsZero(x fe) uint64 {
+	var v uint64
+	for _, l := range x.reduce() {
+		v |= l
+	}
+	return 1 ^ (v|-v)>>63
+}
+
+func feEqual(a, b fe) uint64 { return feIsZero(feSub(a, b)) }
+
+// feIsNeg returns 1 if x is in the upper half of the field, and 0
+// otherwise.  These are the x for which 2x - p, that is 2x mod p, is
+// odd.
+func feIsNeg(x fe) uint64 {
+	return feAdd(x, x).reduce()[0] & 1
+}
+
+// feFromBytes returns the field element of the big-endian number b,
+// which is at most 448 bits long.
+func feFromBytes(b []byte) fe {
+	var x fe
+	for i, c := range b {
+		bit := 8 * (len(b) - 1 - i)
+		x[bit/28] += uint64(c) << (bit % 28)
+	}
+	x.carry()
+	return x
+}
+
+// bytes returns the 56-byte big-endian encoding of x mod p.
+func (x fe) bytes() []byte {
+	out := make([]byte, PAKSLEN)
+	var acc uint64
+	var nbits, j int
+	for _, l := range x.reduce() {
+		acc |= l << nbits
+		for nbits += 28; nbits >= 8; nbits -= 8 {
+			out[len(out)-1-j] = byte(acc)
+			acc >>= 8
+			j++
+		}
+	}
+	return out
+}
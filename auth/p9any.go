@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/gnoack/ninep"
+)
+
+// Client authenticates to file servers on behalf of a user.
+type Client struct {
+	User string // User to authenticate as
+	Key  Key    // The user's key, see PassToKey
+
+	// Domain restricts the authentication to the given domain.
+	// If empty, the first domain offered by the server is used.
+	Domain string
+
+	// AuthServer is the address of the authentication server, as
+	// Plan 9 dial string, e.g. "tcp!auth.example.org!567".
+	AuthServer string
+}
+
+// Authenticate runs the client side of the p9any protocol on rw.
+// It has the signature of ninep.Authenticator.
+func (c *Client) Authenticate(rw io.ReadWriter) error {
+	_, err := c.Negotiate(rw)
+	return err
+}
+
+// Negotiate runs the client side of the p9any protocol on rw and
+// returns the result of the authentication.
+func (c *Client) Negotiate(rw io.ReadWriter) (*AuthInfo, error) {
+	offer, err := readString(rw)
+	if err != nil {
+		return nil, fmt.Errorf("p9any: reading offer: %w", err)
+	}
+	v2 := false
+	if rest, ok := strings.CutPrefix(offer, "v.2 "); ok {
+		offer, v2 = rest, true
+	}
+	// Prefer dp9ik over p9sk1.
+	proto, dom := "", ""
+	for _, o := range strings.Fields(offer) {
+		p, d, _ := strings.Cut(o, "@")
+		if (p == "dp9ik" && proto != "dp9ik" || p == "p9sk1" && proto == "") && (c.Domain == "" || c.Domain == d) {
+			proto, dom = p, d
+		}
+	}
+	if proto == "" {
+		return nil, fmt.Errorf("p9any: no supported protocol in %q", offer)
+	}
+	if err := writeString(rw, proto+" "+dom); err != nil {
+		return nil, err
+	}
+	if v2 {
+		ok, err := readN(rw, 3)
+		if err != nil {
+			return nil, fmt.Errorf("p9any: %w", err)
+		}
+		if string(ok) != "OK\x00" {
+			return nil, fmt.Errorf("p9any: server did not accept %v@%v", proto, dom)
+		}
+	}
+	return c.p9sk1(rw, proto == "dp9ik")
+}
+
+// dialAuthServer connects to the authentication server.
+func (c *Client) dialAuthServer() (net.Conn, error) {
+	if c.AuthServer == "" {
+		return nil, errors.New("no authentication server configured")
+	}
+	return ninep.DialNet(c.AuthServer)
+}
+
+// Server is the file server side of the authentication.
+type Server struct {
+	ID     string // The server's user name, known to the authentication server
+	Domain string // The server's authentication domain
+	Key    Key    // The server's key, see PassToKey
+}
+
+// Negotiate runs the server side of the p9any protocol on rw and
+// returns the result of the authentication.
+func (s *Server) Negotiate(rw io.ReadWriter) (*AuthInfo, error) {
+	if err := writeString(rw, fmt.Sprintf("v.2 dp9ik@%v p9sk1@%v", s.Domain, s.Domain)); err != nil {
+		return nil, err
+	}
+	choice, err := readString(rw)
+	if err != nil {
+		return nil, fmt.Errorf("p9any: reading choice: %w", err)
+	}
+	proto, dom, _ := strings.Cut(choice, " ")
+	if proto != "dp9ik" && proto != "p9sk1" || dom != s.Domain {
+		return nil, fmt.Errorf("p9any: unsupported choice %q", choice)
+	}
+	if err := writeString(rw, "OK"); err != nil {
+		return nil, err
+	}
+	return s.p9sk1(rw, proto == "dp9ik")
+}
+
+// readString reads a NUL-terminated string from r.  The string may
+// arrive in several reads, but nothing may follow it.
+func readString(r io.Reader) (string, error) {
+	var buf []byte
+	chunk := make([]byte, 256)
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if i := bytes.IndexByte(buf, 0); i >= 0 {
+			if i != len(buf)-1 {
+				return "", errors.New("unexpected data after string")
+			}
+			return string(buf[:i]), nil
+		}
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(buf) > 4096 {
+			return "", errors.New("string too long")
+		}
+	}
+}
+
+// writeString writes s, NUL-terminated, in a single write.
+func writeString(w io.Writer, s string) error {
+	_, err := w.Write(append([]byte(s), 0))
+	return err
+}
@@ -0,0 +1,152 @@
+package auth_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gnoack/ninep/auth"
+	"github.com/gnoack/ninep/auth/authtest"
+)
+
+// startAuthServer starts a stand-in authentication server and
+// returns its dial string.
+func startAuthServer(t *testing.T, as *authtest.AuthServer) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go as.Serve(l)
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return "tcp!" + host + "!" + port
+}
+
+// p9sk1Only is the client's end of a connection to a server which
+// only offers p9sk1, like Plan 9 servers before dp9ik.
+type p9sk1Only struct {
+	net.Conn
+	offered bool
+}
+
+func (c *p9sk1Only) Read(p []byte) (int, error) {
+	if c.offered {
+		return c.Conn.Read(p)
+	}
+	c.offered = true
+	buf := make([]byte, 256)
+	n, err := c.Conn.Read(buf)
+	offer, _, _ := strings.Cut(string(buf[:n]), "\x00")
+	var kept []string
+	for _, o := range strings.Fields(offer) {
+		if !strings.HasPrefix(o, "dp9ik@") {
+			kept = append(kept, o)
+		}
+	}
+	return copy(p, strings.Join(kept, " ")+"\x00"), err
+}
+
+// negotiate runs client and server against each other, using the
+// protocol proto.
+func negotiate(c *auth.Client, s *auth.Server, proto string) (cinfo, sinfo *auth.AuthInfo, cerr, serr error) {
+	var cconn, sconn net.Conn
+	cconn, sconn = net.Pipe()
+	if proto == "p9sk1" {
+		cconn = &p9sk1Only{Conn: cconn}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer sconn.Close()
+		sinfo, serr = s.Negotiate(sconn)
+	}()
+	cinfo, cerr = c.Negotiate(cconn)
+	cconn.Close()
+	<-done
+	return cinfo, sinfo, cerr, serr
+}
+
+func TestAuth(t *testing.T) {
+	addr := startAuthServer(t, &authtest.AuthServer{
+		Domain: "example.org",
+		Keys: map[string]auth.Key{
+			"glenda": auth.PassToKey("glenda's password"),
+			"bootes": auth.PassToKey("bootes' password"),
+		},
+	})
+	srv := &auth.Server{ID: "bootes", Domain: "example.org", Key: auth.PassToKey("bootes' password")}
+
+	for _, proto := range []struct {
+		name       string
+		secretSize int
+	}{{"p9sk1", 8}, {"dp9ik", 256}} {
+		t.Run(proto.name, func(t *testing.T) {
+			testAuth(t, addr, srv, proto.name, proto.secretSize)
+		})
+	}
+}
+
+func testAuth(t *testing.T, addr string, srv *auth.Server, proto string, secretSize int) {
+	for _, tc := range []struct {
+		name    string
+		client  auth.Client
+		wantErr string
+	}{
+		{
+			name:   "ok",
+			client: auth.Client{User: "glenda", Key: auth.PassToKey("glenda's password")},
+		},
+		{
+			name:   "domain",
+			client: auth.Client{User: "glenda", Key: auth.PassToKey("glenda's password"), Domain: "example.org"},
+		},
+		{
+			name:    "wrong domain",
+			client:  auth.Client{User: "glenda", Key: auth.PassToKey("glenda's password"), Domain: "example.com"},
+			wantErr: "no supported protocol",
+		},
+		{
+			name:    "wrong password",
+			client:  auth.Client{User: "glenda", Key: auth.PassToKey("wrong")},
+			wantErr: "password mismatch",
+		},
+		{
+			name:    "unknown user",
+			client:  auth.Client{User: "adm", Key: auth.PassToKey("glenda's password")},
+			wantErr: "unknown user adm",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.client
+			c.AuthServer = addr
+			cinfo, sinfo, cerr, serr := negotiate(&c, srv, proto)
+			if tc.wantErr != "" {
+				if cerr == nil || !strings.Contains(cerr.Error(), tc.wantErr) {
+					t.Errorf("Client.Negotiate() err = %v, want %q", cerr, tc.wantErr)
+				}
+				if serr == nil {
+					t.Errorf("Server.Negotiate() succeeded for failed client")
+				}
+				return
+			}
+			if cerr != nil || serr != nil {
+				t.Fatalf("Negotiate: client err %v, server err %v", cerr, serr)
+			}
+			if cinfo.CUID != "glenda" || cinfo.SUID != "glenda" || len(cinfo.Secret) != secretSize {
+				t.Errorf("client AuthInfo = %+v", cinfo)
+			}
+			if sinfo.CUID != cinfo.CUID || sinfo.SUID != cinfo.SUID || string(sinfo.Secret) != string(cinfo.Secret) {
+				t.Errorf("server AuthInfo = %+v, client AuthInfo = %+v", sinfo, cinfo)
+			}
+		})
+	}
+}
+
+func TestNoAuthServer(t *testing.T) {
+	c := &auth.Client{User: "glenda", Key: auth.PassToKey("password")}
+	s := &auth.Server{ID: "bootes", Key: auth.PassToKey("password")}
+	if _, _, cerr, _ := negotiate(c, s, "dp9ik"); cerr == nil || !strings.Contains(cerr.Error(), "no authentication server") {
+		t.Errorf("Client.Negotiate() err = %v, want missing auth server", cerr)
+	}
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// The p9sk1 and dp9ik protocols share their structure.  In dp9ik,
+// the parties first run AuthPAK with the authentication server,
+// relayed by the client, and the tickets and authenticators are in
+// form 1, carrying nonces from which the session secret is derived.
+
+// p9sk1 runs the client side of p9sk1, or of dp9ik if dp9ik is set,
+// on rw.
+func (c *Client) p9sk1(rw io.ReadWriter, dp9ik bool) (*AuthInfo, error) {
+	proto := protoName(dp9ik)
+	cchal := newChallenge()
+	if _, err := rw.Write(cchal[:]); err != nil {
+		return nil, err
+	}
+	m := TICKREQLEN
+	if dp9ik {
+		m += PAKYLEN
+	}
+	buf, err := readN(rw, m)
+	if err != nil {
+		return nil, fmt.Errorf("%v: reading ticket request: %w", proto, err)
+	}
+	var tr Ticketreq
+	if err := tr.UnmarshalBinary(buf[:TICKREQLEN]); err != nil {
+		return nil, fmt.Errorf("%v: %w", proto, err)
+	}
+	if tr.Type != AuthTreq {
+		return nil, fmt.Errorf("%v: bad ticket request type %d", proto, tr.Type)
+	}
+	tr.HostID = c.User
+	tr.UID = c.User
+	tp, err := c.getTickets(&tr, buf[TICKREQLEN:])
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", proto, err)
+	}
+	t, err := OpenTicket(tp.tc, tp.key)
+	if err != nil || t.Num != AuthTc || t.Chal != tr.Chal {
+		return nil, fmt.Errorf("%v: password mismatch with auth server", proto)
+	}
+	if (t.Form == 1) != dp9ik {
+		return nil, fmt.Errorf("%v: auth server sent ticket in form %d", proto, t.Form)
+	}
+
+	// Pass on the server's ticket, and prove that we can read ours.
+	a := authenticator{num: AuthAc, chal: tr.Chal}
+	if dp9ik {
+		rand.Read(a.rand[:])
+	}
+	var msg []byte
+	msg = append(msg, tp.ybs...)
+	msg = append(msg, tp.ts...)
+	msg = append(msg, a.seal(t)...)
+	if _, err := rw.Write(msg); err != nil {
+		return nil, err
+	}
+
+	buf, err = readN(rw, authenticatorLen(t))
+	if err != nil {
+		return nil, fmt.Errorf("%v: reading authenticator: %w", proto, err)
+	}
+	sa, err := openAuthenticator(buf, t)
+	if err != nil || sa.num != AuthAs || sa.chal != cchal {
+		return nil, fmt.Errorf("%v: server lies: %w", proto, errAuthFailed)
+	}
+	return newAuthInfo(t, a.rand[:], sa.rand[:]), nil
+}
+
+// ticketPair is a pair of tickets from the authentication server.
+type ticketPair struct {
+	tc  []byte // Ticket for the client
+	ts  []byte // Ticket for the server
+	key []byte // The client's key to open tc
+	ybs []byte // AuthPAK reply for the server, in dp9ik
+}
+
+// getTickets fetches a pair of tickets for tr from the authentication
+// server.  For dp9ik, ys is the server's AuthPAK public key.
+func (c *Client) getTickets(tr *Ticketreq, ys []byte) (*ticketPair, error) {
+	conn, err := c.dialAuthServer()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tp := &ticketPair{key: c.Key.DES[:]}
+	if len(ys) > 0 {
+		// Run AuthPAK for both the server and ourselves.
+		pak, yac := NewPAK(&c.Key, c.User, true)
+		pr := *tr
+		pr.Type = AuthPAK
+		req, _ := pr.MarshalBinary()
+		req = append(req, ys...)
+		req = append(req, yac...)
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		if err := readAuthResponse(conn); err != nil {
+			return nil, err
+		}
+		ys, err := readN(conn, 2*PAKYLEN)
+		if err != nil {
+			return nil, err
+		}
+		key, err := pak.Finish(ys[PAKYLEN:])
+		if err != nil {
+			return nil, err
+		}
+		tp.key, tp.ybs = key[:], ys[:PAKYLEN]
+	}
+
+	req, _ := tr.MarshalBinary()
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	if err := readAuthResponse(conn); err != nil {
+		return nil, err
+	}
+	if tp.tc, err = readTicket(conn); err != nil {
+		return nil, err
+	}
+	if tp.ts, err = readTicket(conn); err != nil {
+		return nil, err
+	}
+	return tp, nil
+}
+
+// readTicket reads a ticket in either form from r.
+func readTicket(r io.Reader) ([]byte, error) {
+	prefix, err := readN(r, 8)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := readN(r, ticketLen(prefix)-len(prefix))
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, rest...), nil
+}
+
+// readAuthResponse reads the status byte of an authentication server
+// response, and the error message if there is one.
+func readAuthResponse(r io.Reader) error {
+	b, err := readN(r, 1)
+	if err != nil {
+		return err
+	}
+	switch b[0] {
+	case AuthOK:
+		return nil
+	case AuthErr:
+		msg, err := readN(r, AERRLEN)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("auth server: %s", getString(msg))
+	default:
+		return fmt.Errorf("auth server: unexpected response type %d", b[0])
+	}
+}
+
+// p9sk1 runs the server side of p9sk1, or of dp9ik if dp9ik is set,
+// on rw.
+func (s *Server) p9sk1(rw io.ReadWriter, dp9ik bool) (*AuthInfo, error) {
+	proto := protoName(dp9ik)
+	buf, err := readN(rw, CHALLEN)
+	if err != nil {
+		return nil, fmt.Errorf("%v: reading challenge: %w", proto, err)
+	}
+	cchal := [CHALLEN]byte(buf)
+
+	tr := Ticketreq{Type: AuthTreq, AuthID: s.ID, AuthDom: s.Domain, Chal: newChallenge()}
+	req, _ := tr.MarshalBinary()
+	var pak *PAKPriv
+	if dp9ik {
+		var y []byte
+		pak, y = NewPAK(&s.Key, s.ID, true)
+		req = append(req, y...)
+	}
+	if _, err := rw.Write(req); err != nil {
+		return nil, err
+	}
+
+	key := s.Key.DES[:]
+	if dp9ik {
+		y, err := readN(rw, PAKYLEN)
+		if err != nil {
+			return nil, fmt.Errorf("%v: reading AuthPAK key: %w", proto, err)
+		}
+		k, err := pak.Finish(y)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", proto, err)
+		}
+		key = k[:]
+	}
+	buf, err = readTicket(rw)
+	if err != nil {
+		return nil, fmt.Errorf("%v: reading ticket: %w", proto, err)
+	}
+	t, err := OpenTicket(buf, key)
+	if err != nil || t.Num != AuthTs || t.Chal != tr.Chal || (t.Form == 1) != dp9ik {
+		return nil, fmt.Errorf("%v: bad ticket: %w", proto, errAuthFailed)
+	}
+	buf, err = readN(rw, authenticatorLen(t))
+	if err != nil {
+		return nil, fmt.Errorf("%v: reading authenticator: %w", proto, err)
+	}
+	a, err := openAuthenticator(buf, t)
+	if err != nil || a.num != AuthAc || a.chal != tr.Chal {
+		return nil, fmt.Errorf("%v: bad authenticator: %w", proto, errAuthFailed)
+	}
+
+	sa := authenticator{num: AuthAs, chal: cchal}
+	if dp9ik {
+		rand.Read(sa.rand[:])
+	}
+	if _, err := rw.Write(sa.seal(t)); err != nil {
+		return nil, err
+	}
+	return newAuthInfo(t, a.rand[:], sa.rand[:]), nil
+}
+
+// newAuthInfo returns the result of an authentication with ticket t
+// and the client's and server's nonces.
+func newAuthInfo(t *Ticket, cnonce, snonce []byte) *AuthInfo {
+	ai := &AuthInfo{CUID: t.CUID, SUID: t.SUID}
+	if t.Form == 0 {
+		ai.Secret = des56to64(t.desKey())
+		return ai
+	}
+	salt := append(append([]byte{}, cnonce...), snonce...)
+	ai.Secret = make([]byte, 256)
+	kdf := hkdf.New(sha256.New, t.Key[:], salt, []byte("Plan 9 session secret"))
+	io.ReadFull(kdf, ai.Secret)
+	return ai
+}
+
+func protoName(dp9ik bool) string {
+	if dp9ik {
+		return "dp9ik"
+	}
+	return "p9sk1"
+}
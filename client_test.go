@@ -0,0 +1,428 @@
+package ninep_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/ninetest"
+)
+
+// openFile attaches to fid 1 and opens name as fid 2 on cc.
+func openFile(t *testing.T, cc *ninep.ClientConn, fid uint32, name string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := cc.Attach(ctx, fid, ^uint32(0), "glenda", ""); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	if _, err := cc.Walk(ctx, fid, fid, []string{name}); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if _, _, err := cc.Open(ctx, fid, ninep.ORead); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+}
+
+func dial(t *testing.T, srv *ninetest.Server) *ninep.ClientConn {
+	t.Helper()
+	cc, err := srv.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+var testFiles = map[string]ninetest.File{
+	"a": {Data: []byte("aaa"), Mode: 0644},
+	"b": {Data: []byte("bbb"), Mode: 0644},
+}
+
+func TestReadCanceled(t *testing.T) {
+	wait := make(chan struct{})
+	defer close(wait)
+	srv := &ninetest.Server{
+		Files: testFiles,
+		Fault: func(req ninep.Message) ninetest.Fault {
+			if r, ok := req.(*ninep.Tread); ok && r.FID == 1 {
+				return ninetest.Fault{Wait: wait}
+			}
+			return ninetest.Fault{}
+		},
+	}
+	cc := dial(t, srv)
+	openFile(t, cc, 1, "a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	buf := make([]byte, 10)
+	if _, err := cc.Read(ctx, 1, 0, buf); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Read with held reply: got err %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The connection is still usable.
+	openFile(t, cc, 2, "b")
+	n, err := cc.Read(context.Background(), 2, 0, buf)
+	if err != nil || string(buf[:n]) != "bbb" {
+		t.Errorf("Read = %q, %v; want %q, nil", buf[:n], err, "bbb")
+	}
+}
+
+func TestRepliesOutOfOrder(t *testing.T) {
+	wait := make(chan struct{})
+	srv := &ninetest.Server{
+		Files: testFiles,
+		Fault: func(req ninep.Message) ninetest.Fault {
+			if r, ok := req.(*ninep.Tread); ok && r.FID == 1 {
+				return ninetest.Fault{Wait: wait}
+			}
+			return ninetest.Fault{}
+		},
+	}
+	cc := dial(t, srv)
+	openFile(t, cc, 1, "a")
+	openFile(t, cc, 2, "b")
+
+	done := make(chan string)
+	go func() {
+		buf := make([]byte, 10)
+		n, err := cc.Read(context.Background(), 1, 0, buf)
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		done <- string(buf[:n])
+	}()
+
+	// The second read overtakes the first one.
+	buf := make([]byte, 10)
+	n, err := cc.Read(context.Background(), 2, 0, buf)
+	if err != nil || string(buf[:n]) != "bbb" {
+		t.Errorf("Read = %q, %v; want %q, nil", buf[:n], err, "bbb")
+	}
+	close(wait)
+	if got := <-done; got != "aaa" {
+		t.Errorf("delayed Read = %q, want %q", got, "aaa")
+	}
+}
+
+func TestRerror(t *testing.T) {
+	srv := &ninetest.Server{
+		Files: testFiles,
+		Fault: func(req ninep.Message) ninetest.Fault {
+			if _, ok := req.(*ninep.Tstat); ok {
+				return ninetest.Fault{Error: "i/o error"}
+			}
+			return ninetest.Fault{}
+		},
+	}
+	cc := dial(t, srv)
+	openFile(t, cc, 1, "a")
+
+	if _, err := cc.Stat(context.Background(), 1); err == nil || err.Error() != "i/o error" {
+		t.Errorf("Stat: got err %v, want %q", err, "i/o error")
+	}
+}
+
+func TestDroppedConnection(t *testing.T) {
+	srv := &ninetest.Server{
+		Files: testFiles,
+		Fault: func(req ninep.Message) ninetest.Fault {
+			_, ok := req.(*ninep.Tread)
+			return ninetest.Fault{Drop: ok}
+		},
+	}
+	cc := dial(t, srv)
+	openFile(t, cc, 1, "a")
+
+	buf := make([]byte, 10)
+	if _, err := cc.Read(context.Background(), 1, 0, buf); err == nil {
+		t.Errorf("Read on dropped connection succeeded")
+	}
+	if _, err := cc.Stat(context.Background(), 1); err == nil {
+		t.Errorf("Stat after dropped connection succeeded")
+	}
+}
+
+// A reply for a flushed request may arrive before the Rflush.
+// The client must discard it.
+func TestLateReplyToFlushedRequest(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		read := func() ninep.Message {
+			m, err := ninep.ReadMessage(server)
+			if err != nil {
+				t.Errorf("ReadMessage: %v", err)
+			}
+			return m
+		}
+		write := func(m ninep.Message) {
+			if err := ninep.WriteMessage(server, m); err != nil {
+				t.Errorf("WriteMessage: %v", err)
+			}
+		}
+		tv := read().(*ninep.Tversion)
+		write(&ninep.Rversion{Tag: tv.Tag, Msize: tv.Msize, Version: tv.Version})
+		tr := read().(*ninep.Tread)
+		tf := read().(*ninep.Tflush)
+		write(&ninep.Rread{Tag: tr.Tag, Data: []byte("late")})
+		write(&ninep.Rflush{Tag: tf.Tag})
+		ts := read().(*ninep.Tstat)
+		write(&ninep.Rstat{Tag: ts.Tag, Stat: ninep.Stat{Name: "a"}})
+	}()
+
+	cc, err := ninep.NewClientConn(client, ninep.DialOpts{})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := cc.Read(ctx, 1, 0, make([]byte, 10)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Read: got err %v, want %v", err, context.DeadlineExceeded)
+	}
+	st, err := cc.Stat(context.Background(), 1)
+	if err != nil || st.Name != "a" {
+		t.Errorf("Stat = %v, %v; want name %q", st, err, "a")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	srv := &ninetest.Server{Files: testFiles}
+	cc, err := ninep.NewClientConn(srv.Pipe(), ninep.DialOpts{Logger: logger})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	defer cc.Close()
+	openFile(t, cc, 1, "a")
+	if _, err := cc.Walk(context.Background(), 1, 2, []string{"nonexistent"}); err == nil {
+		t.Fatalf("Walk to nonexistent file succeeded")
+	}
+
+	type record struct {
+		Msg     string
+		Type    string
+		Tag     *int
+		FID     *uint32
+		Ename   string
+		Latency *int64
+	}
+	var got []record
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r record
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("bad log output: %v", err)
+		}
+		got = append(got, r)
+	}
+
+	wantTypes := []string{"Tversion", "Rversion", "Tattach", "Rattach", "Twalk", "Rwalk", "Topen", "Ropen", "Twalk", "Rerror"}
+	if len(got) != len(wantTypes) {
+		t.Fatalf("got %d log records %+v, want %d", len(got), got, len(wantTypes))
+	}
+	for i, r := range got {
+		if r.Type != wantTypes[i] {
+			t.Errorf("record %d: type = %q, want %q", i, r.Type, wantTypes[i])
+		}
+		if r.Tag == nil {
+			t.Errorf("record %d: no tag", i)
+		}
+		wantMsg, reply := "9p request", i%2 == 1
+		if reply {
+			wantMsg = "9p reply"
+		}
+		if r.Msg != wantMsg {
+			t.Errorf("record %d: msg = %q, want %q", i, r.Msg, wantMsg)
+		}
+		if hasLatency := r.Latency != nil; hasLatency != reply {
+			t.Errorf("record %d: has latency = %v, want %v", i, hasLatency, reply)
+		}
+		if hasFID := r.FID != nil; hasFID != (i >= 2) {
+			t.Errorf("record %d: has fid = %v, want %v", i, hasFID, i >= 2)
+		} else if hasFID && *r.FID != 1 {
+			t.Errorf("record %d: fid = %d, want 1", i, *r.FID)
+		}
+	}
+	if last := got[len(got)-1]; last.Ename == "" {
+		t.Errorf("Rerror record has no ename")
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(name string) ninep.Interceptor {
+		return func(ctx context.Context, req ninep.Message, invoke ninep.Invoker) (ninep.Message, error) {
+			resp, err := invoke(ctx, req)
+			fid, _ := ninep.MessageFID(req)
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, fmt.Sprintf("%v %v tag=%d fid=%d err=%v", name, req.Type(), req.MessageTag(), fid, err != nil))
+			return resp, err
+		}
+	}
+	// fakeStat answers Tstat requests without contacting the server.
+	fakeStat := func(ctx context.Context, req ninep.Message, invoke ninep.Invoker) (ninep.Message, error) {
+		if _, ok := req.(*ninep.Tstat); ok {
+			return &ninep.Rstat{Stat: ninep.Stat{Name: "fake"}}, nil
+		}
+		return invoke(ctx, req)
+	}
+
+	srv := &ninetest.Server{Files: testFiles}
+	cc, err := ninep.NewClientConn(srv.Pipe(), ninep.DialOpts{
+		Concurrency:  1,
+		Interceptors: []ninep.Interceptor{record("outer"), record("inner"), fakeStat},
+	})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	defer cc.Close()
+
+	ctx := context.Background()
+	if _, err := cc.Attach(ctx, 1, ^uint32(0), "glenda", ""); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	if _, err := cc.Walk(ctx, 1, 2, []string{"nonexistent"}); err == nil {
+		t.Fatalf("Walk to nonexistent file succeeded")
+	}
+	stat, err := cc.Stat(ctx, 1)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if stat.Name != "fake" {
+		t.Errorf("Stat: got name %q, want %q from interceptor", stat.Name, "fake")
+	}
+
+	want := []string{
+		"inner Tattach tag=0 fid=1 err=false",
+		"outer Tattach tag=0 fid=1 err=false",
+		"inner Twalk tag=0 fid=1 err=true",
+		"outer Twalk tag=0 fid=1 err=true",
+		"inner Tstat tag=0 fid=1 err=false",
+		"outer Tstat tag=0 fid=1 err=false",
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("got calls\n%v\nwant\n%v", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestInterceptorWrongReply(t *testing.T) {
+	srv := &ninetest.Server{Files: testFiles}
+	cc, err := ninep.NewClientConn(srv.Pipe(), ninep.DialOpts{
+		Interceptors: []ninep.Interceptor{
+			func(ctx context.Context, req ninep.Message, invoke ninep.Invoker) (ninep.Message, error) {
+				return &ninep.Rclunk{}, nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	defer cc.Close()
+
+	if _, err := cc.Stat(context.Background(), 1); err == nil {
+		t.Errorf("Stat with Rclunk reply: got nil error")
+	}
+}
+
+func TestStats(t *testing.T) {
+	wait := make(chan struct{})
+	srv := &ninetest.Server{
+		Files: testFiles,
+		Fault: func(req ninep.Message) ninetest.Fault {
+			if _, ok := req.(*ninep.Tread); ok {
+				return ninetest.Fault{Wait: wait}
+			}
+			return ninetest.Fault{}
+		},
+	}
+	cc := dial(t, srv)
+	fsys, err := ninep.Attach(cc, ninep.AttachOpts{Uname: "glenda"})
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	if _, err := fsys.Open("nonexistent"); err == nil {
+		t.Fatalf("Open(nonexistent) succeeded")
+	}
+	var files []fs.File
+	for _, name := range []string{"a", "b"} {
+		f, err := fsys.Open(name)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", name, err)
+		}
+		files = append(files, f)
+	}
+
+	// Block three reads in the server.
+	var wg sync.WaitGroup
+	for _, f := range []fs.File{files[0], files[1], files[0]} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.(io.ReaderAt).ReadAt(make([]byte, 3), 0)
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for cc.Stats().InFlight < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("reads did not get in flight: %+v", cc.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if st := cc.Stats(); st.FIDs != 3 {
+		t.Errorf("FIDs = %d, want 3 (root and two open files)", st.FIDs)
+	}
+	close(wait)
+	wg.Wait()
+	for _, f := range files {
+		f.Close()
+	}
+
+	st := cc.Stats()
+	if st.InFlight != 0 || st.PeakInFlight != 3 {
+		t.Errorf("InFlight = %d, PeakInFlight = %d, want 0, 3", st.InFlight, st.PeakInFlight)
+	}
+	if st.FIDs != 1 {
+		t.Errorf("FIDs = %d, want 1 (root)", st.FIDs)
+	}
+	if got := st.Requests[ninep.MsgTread]; got != 3 {
+		t.Errorf("Requests[Tread] = %d, want 3", got)
+	}
+	if got := st.Requests[ninep.MsgTclunk]; got != 2 {
+		t.Errorf("Requests[Tclunk] = %d, want 2", got)
+	}
+	// One error from Tauth, and one from walking to a nonexistent file.
+	if len(st.Errors) != 2 {
+		t.Errorf("Errors = %v, want two different errors", st.Errors)
+	}
+	if st.BytesSent == 0 || st.BytesReceived == 0 {
+		t.Errorf("BytesSent = %d, BytesReceived = %d, want both > 0", st.BytesSent, st.BytesReceived)
+	}
+	var total uint64
+	for _, n := range st.Requests {
+		total += n
+	}
+	if st.Latency.Count != total || st.Latency.Max < st.Latency.P50 {
+		t.Errorf("Latency = %+v for %d requests", st.Latency, total)
+	}
+}
@@ -0,0 +1,156 @@
+// 9pdump prints 9P messages in plan9port's fcall format.
+//
+// It reads a raw stream of 9P messages, or with -trace a trace
+// recorded with ninep.DialOpts.Trace, from the given files or from
+// standard input.  Replies are paired with their requests by tag.
+// When the input carries timestamps, the time between request and
+// reply is printed as well.  Messages can be in 9P2000 or 9P2000.u.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gnoack/ninep"
+)
+
+var trace = flag.Bool("trace", false, "Read a recorded trace instead of a raw message stream")
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "     %s [-trace] [FILE...]\n\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// request is a request waiting for its reply.
+type request struct {
+	msg  ninep.Message
+	time time.Time // zero if unknown
+}
+
+// dumper prints messages and pairs requests with replies.
+type dumper struct {
+	out     io.Writer
+	pending map[uint16]request
+}
+
+// dump prints m.  t is the time when m was seen, or zero.
+func (d *dumper) dump(m ninep.Message, t time.Time) {
+	var prefix string
+	if !t.IsZero() {
+		prefix = t.Format("15:04:05.000000 ")
+	}
+	if m.Type().IsRequest() {
+		fmt.Fprintf(d.out, "%s-> %v\n", prefix, m)
+		switch m.(type) {
+		case *ninep.Tversion:
+			// Version aborts all outstanding requests.
+			clear(d.pending)
+		}
+		d.pending[m.MessageTag()] = request{msg: m, time: t}
+		return
+	}
+
+	note := " (no request)"
+	if req, ok := d.pending[m.MessageTag()]; ok {
+		delete(d.pending, m.MessageTag())
+		if f, ok := req.msg.(*ninep.Tflush); ok {
+			delete(d.pending, f.OldTag)
+		}
+		switch {
+		case m.Type() != req.msg.Type()+1 && m.Type() != ninep.MsgRerror:
+			note = fmt.Sprintf(" (mismatched reply to %v)", req.msg.Type())
+		case !t.IsZero() && !req.time.IsZero():
+			note = fmt.Sprintf(" (%v)", t.Sub(req.time))
+		default:
+			note = ""
+		}
+	}
+	fmt.Fprintf(d.out, "%s<- %v%s\n", prefix, m, note)
+}
+
+// finish prints the requests which did not get a reply.
+func (d *dumper) finish() {
+	tags := make([]int, 0, len(d.pending))
+	for tag := range d.pending {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+	for _, tag := range tags {
+		fmt.Fprintf(d.out, "unanswered: %v\n", d.pending[uint16(tag)].msg)
+	}
+}
+
+// dumpStream prints the raw message stream r.
+func (d *dumper) dumpStream(r io.Reader) error {
+	for {
+		m, err := ninep.ReadMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		d.dump(m, time.Time{})
+	}
+}
+
+// dumpTrace prints the trace r.
+func (d *dumper) dumpTrace(r io.Reader) error {
+	tr := ninep.NewTraceReader(r)
+	for {
+		rec, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		m, err := ninep.Unmarshal(rec.Data)
+		if err != nil {
+			fmt.Fprintf(d.out, "%s %v: bad message %x: %v\n", rec.Time.Format("15:04:05.000000"), rec.Dir, rec.Data, err)
+			continue
+		}
+		d.dump(m, rec.Time)
+	}
+}
+
+func (d *dumper) dumpFile(name string) error {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if *trace {
+		return d.dumpTrace(r)
+	}
+	return d.dumpStream(r)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	names := flag.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	d := &dumper{out: os.Stdout, pending: make(map[uint16]request)}
+	for _, name := range names {
+		if err := d.dumpFile(name); err != nil {
+			log.Fatalf("%v: %v", name, err)
+		}
+	}
+	d.finish()
+}
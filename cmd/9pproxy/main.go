@@ -0,0 +1,183 @@
+// 9pproxy forwards 9P connections to an upstream service and logs
+// every message passing through, with replies paired to their
+// requests.  Messages are forwarded byte for byte, so messages which
+// the ninep package can't decode are logged as such and still reach
+// the other side.
+//
+// Usage:
+//
+//	9pproxy -listen unix!/tmp/ns.$USER.$DISPLAY/acme-debug -upstream acme
+//
+// The upstream service is given as for ninep.DialNet, the listen
+// address as for ninep.ListenNet.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gnoack/ninep"
+)
+
+var (
+	listen   = flag.String("listen", "", "Address to listen on, e.g. tcp!localhost!5640 or unix!/path")
+	upstream = flag.String("upstream", "", "Service to forward connections to, e.g. acme or tcp!host!564")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "     %s -listen ADDR -upstream SERVICE\n\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// request is a forwarded request waiting for its reply.
+type request struct {
+	msg  ninep.Message
+	time time.Time
+}
+
+// proxyConn is a proxied client connection.
+type proxyConn struct {
+	id int
+
+	mu      sync.Mutex
+	pending map[uint16]request
+}
+
+func (c *proxyConn) logf(format string, args ...any) {
+	log.Printf("conn %d: "+format, append([]any{c.id}, args...)...)
+}
+
+// sent records and logs a request forwarded to upstream.
+func (c *proxyConn) sent(m ninep.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := m.(*ninep.Tversion); ok {
+		clear(c.pending)
+	}
+	c.pending[m.MessageTag()] = request{msg: m, time: time.Now()}
+	c.logf("-> %v", m)
+}
+
+// received logs a reply forwarded to the client, together with the
+// request it belongs to.
+func (c *proxyConn) received(m ninep.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	req, ok := c.pending[m.MessageTag()]
+	if !ok {
+		c.logf("<- %v (no request)", m)
+		return
+	}
+	delete(c.pending, m.MessageTag())
+	if f, ok := req.msg.(*ninep.Tflush); ok {
+		delete(c.pending, f.OldTag)
+	}
+	c.logf("<- %v (%v for %v)", m, time.Since(req.time), req.msg.Type())
+}
+
+// readFrame reads the next size-prefixed message from r, without
+// decoding it.
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < 7 || n > ninep.MaxMsize {
+		return nil, fmt.Errorf("message size %d out of bounds", n)
+	}
+	frame := make([]byte, n)
+	copy(frame, size[:])
+	if _, err := io.ReadFull(r, frame[4:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// forward copies messages from src to dst unchanged until src is
+// closed, calling record with a decoded copy of each message.
+// Messages which fail to decode are logged and forwarded as well.
+func (c *proxyConn) forward(dst io.Writer, src io.Reader, dir string, record func(ninep.Message)) error {
+	for {
+		frame, err := readFrame(src)
+		if err != nil {
+			return err
+		}
+		if m, err := ninep.Unmarshal(bytes.Clone(frame)); err != nil {
+			c.logf("%v undecodable message of type %d, %d bytes: %v", dir, frame[4], len(frame), err)
+		} else {
+			record(m)
+		}
+		if _, err := dst.Write(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// serve proxies the client connection conn.
+func (c *proxyConn) serve(conn net.Conn) {
+	defer conn.Close()
+
+	up, err := ninep.DialNet(*upstream)
+	if err != nil {
+		c.logf("dial upstream: %v", err)
+		return
+	}
+	defer up.Close()
+	c.logf("connected %v to %v", conn.RemoteAddr(), up.RemoteAddr())
+
+	done := make(chan error, 2)
+	go func() { done <- c.forward(up, conn, "->", c.sent) }()
+	go func() { done <- c.forward(conn, up, "<-", c.received) }()
+	// When one side fails, closing both connections stops the other.
+	err = <-done
+	conn.Close()
+	up.Close()
+	<-done
+
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		c.logf("closed: %v", err)
+		return
+	}
+	c.logf("closed")
+}
+
+func main() {
+	// For better RPC latency debugging, log microseconds.
+	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+
+	flag.Usage = usage
+	flag.Parse()
+	if *listen == "" || *upstream == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	l, err := ninep.ListenNet(*listen)
+	if err != nil {
+		log.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+	log.Printf("Forwarding %v to %v", l.Addr(), *upstream)
+
+	for id := 1; ; id++ {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatalf("Accept: %v", err)
+		}
+		c := &proxyConn{id: id, pending: make(map[uint16]request)}
+		go c.serve(conn)
+	}
+}
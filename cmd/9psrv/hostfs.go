@@ -0,0 +1,18 @@
+//go:build linux
+
+package main
+
+import (
+	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/hostfs"
+)
+
+// dirServer returns the file server for the directory name.
+func dirServer(name string) (ninep.FileServer, error) {
+	fsys, err := hostfs.New(name)
+	if err != nil {
+		return nil, err
+	}
+	fsys.ReadOnly = !*rw
+	return fsys, nil
+}
@@ -0,0 +1,205 @@
+// 9psrv serves a local directory, an archive, or an in-memory file
+// tree over 9P.
+//
+// Usage:
+//
+//	9psrv [-rw] -listen ADDR DIR
+//	9psrv -listen ADDR ARCHIVE.zip|ARCHIVE.tar[.gz]
+//	9psrv -listen ADDR -ram
+//
+// The listen address is given as for ninep.ListenNet: a dial string
+// like tcp!*!564 or unix!/path, or a service name, which is posted in
+// the plan9port namespace directory.  For example, after
+//
+//	9psrv -listen share ~/share
+//
+// the directory can be listed with "9p ls share/".
+//
+// Directories are served read-only unless -rw is given.  Archives are
+// always read-only, and the ramfs is always writable.  Symbolic links,
+// devices and other special files in tar archives are skipped with a
+// warning.  Directories can only be served on Linux.
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/ramfs"
+)
+
+var (
+	listen  = flag.String("listen", "", "Address to listen on, e.g. tcp!*!564, unix!/path or a service name")
+	rw      = flag.Bool("rw", false, "Serve a directory read-write")
+	ram     = flag.Bool("ram", false, "Serve an empty in-memory file tree")
+	verbose = flag.Bool("v", false, "Log all 9P messages")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "     %s [-rw] -listen ADDR DIR\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "     %s -listen ADDR ARCHIVE.zip|ARCHIVE.tar[.gz]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "     %s -listen ADDR -ram\n\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// fileServer returns the file server for the command line arguments.
+func fileServer() (ninep.FileServer, error) {
+	if *ram {
+		if flag.NArg() != 0 {
+			return nil, fmt.Errorf("-ram takes no arguments")
+		}
+		owner := "none"
+		if u, err := user.Current(); err == nil {
+			owner = u.Username
+		}
+		return ramfs.New(owner), nil
+	}
+	if flag.NArg() != 1 {
+		return nil, fmt.Errorf("need exactly one directory or archive")
+	}
+	name := flag.Arg(0)
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case fi.IsDir():
+		return dirServer(name)
+	case *rw:
+		return nil, fmt.Errorf("archives can only be served read-only")
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+		return ninep.FileServerFS(zr), nil
+	case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		fsys, err := readTar(name)
+		if err != nil {
+			return nil, err
+		}
+		return ninep.FileServerFS(fsys), nil
+	}
+	return nil, fmt.Errorf("%v: not a directory, zip or tar archive", name)
+}
+
+// readTar reads a tar archive into memory.  Hard links are resolved
+// to copies of the files they point to.
+func readTar(name string) (tarFS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(name, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	}
+	fsys := newTarFS()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fsys, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", name, err)
+		}
+		p, ok := tarPath(hdr.Name)
+		if !ok {
+			log.Printf("%v: skipping %q: outside of the archive", name, hdr.Name)
+			continue
+		}
+		if p == "." {
+			continue
+		}
+		fi := hdr.FileInfo()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			fsys.add(p, newTarDir(path.Base(p), fi.Mode(), fi.ModTime()))
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", name, err)
+			}
+			fsys.add(p, &tarEntry{name: path.Base(p), mode: fi.Mode(), mtime: fi.ModTime(), data: data})
+		case tar.TypeLink:
+			target, ok := tarPath(hdr.Linkname)
+			if e := fsys[target]; ok && e != nil && !e.IsDir() {
+				fsys.add(p, &tarEntry{name: path.Base(p), mode: e.mode, mtime: e.mtime, data: e.data})
+			} else {
+				log.Printf("%v: skipping hard link %v to missing file %v", name, hdr.Name, hdr.Linkname)
+			}
+		case tar.TypeSymlink:
+			log.Printf("%v: skipping symbolic link %v -> %v", name, hdr.Name, hdr.Linkname)
+		case tar.TypeXGlobalHeader:
+			// Metadata only.
+		default:
+			log.Printf("%v: skipping special file %v (type %q)", name, hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+// tarPath returns the fs.FS path of a file named in a tar archive.
+// It reports false for names outside of the archive.
+func tarPath(name string) (string, bool) {
+	p := path.Clean(strings.TrimPrefix(name, "/"))
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *listen == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files, err := fileServer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := &ninep.Server{Files: files}
+	if *verbose {
+		srv.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	l, err := ninep.ListenNet(*listen)
+	if err != nil {
+		log.Fatalf("Listen: %v", err)
+	}
+	// Closing the listener removes a posted service's socket.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		l.Close()
+	}()
+	log.Printf("Serving on %v", l.Addr())
+	if err := srv.Serve(l); !errors.Is(err, net.ErrClosed) {
+		log.Fatal(err)
+	}
+}
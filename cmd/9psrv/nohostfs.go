@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/gnoack/ninep"
+)
+
+// dirServer returns the file server for the directory name.  The
+// hostfs package is only available on Linux.
+func dirServer(name string) (ninep.FileServer, error) {
+	return nil, errors.New("serving directories is only supported on Linux")
+}
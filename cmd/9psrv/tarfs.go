@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"time"
+)
+
+// tarFS is a read-only, in-memory file tree, keyed by path as in
+// fs.FS.  It holds the contents of a tar archive, including the
+// directories which are only implied by the file names.
+type tarFS map[string]*tarEntry
+
+// tarEntry is a file or directory in a tarFS.  It serves as its own
+// fs.FileInfo and fs.DirEntry.
+type tarEntry struct {
+	name     string // Base name
+	mode     fs.FileMode
+	mtime    time.Time
+	data     []byte
+	children map[string]*tarEntry // Only for directories
+}
+
+func newTarFS() tarFS {
+	return tarFS{".": newTarDir(".", fs.ModeDir|0o555, time.Time{})}
+}
+
+func newTarDir(name string, mode fs.FileMode, mtime time.Time) *tarEntry {
+	return &tarEntry{name: name, mode: mode, mtime: mtime, children: make(map[string]*tarEntry)}
+}
+
+// add adds e at the cleaned path p, creating the missing parent
+// directories.  A directory which already exists keeps its children.
+func (fsys tarFS) add(p string, e *tarEntry) {
+	if old := fsys[p]; old != nil && old.IsDir() && e.IsDir() {
+		e.children = old.children
+	}
+	fsys[p] = e
+	for p != "." {
+		dir := path.Dir(p)
+		parent := fsys[dir]
+		if parent == nil || !parent.IsDir() {
+			parent = newTarDir(path.Base(dir), fs.ModeDir|0o555, time.Time{})
+			fsys[dir] = parent
+		}
+		parent.children[path.Base(p)] = fsys[p]
+		p = dir
+	}
+}
+
+func (fsys tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e := fsys[name]
+	if e == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.IsDir() {
+		return &tarDir{e: e}, nil
+	}
+	return &tarFile{e: e, Reader: bytes.NewReader(e.data)}, nil
+}
+
+func (e *tarEntry) Name() string               { return e.name }
+func (e *tarEntry) Size() int64                { return int64(len(e.data)) }
+func (e *tarEntry) Mode() fs.FileMode          { return e.mode }
+func (e *tarEntry) ModTime() time.Time         { return e.mtime }
+func (e *tarEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *tarEntry) Sys() any                   { return nil }
+func (e *tarEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *tarEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+// tarFile is an open regular file.
+type tarFile struct {
+	e *tarEntry
+	*bytes.Reader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.e, nil }
+func (f *tarFile) Close() error               { return nil }
+
+// tarDir is an open directory.
+type tarDir struct {
+	e       *tarEntry
+	entries []fs.DirEntry // Not yet read by ReadDir, once started.
+	started bool
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.e, nil }
+func (d *tarDir) Close() error               { return nil }
+
+func (d *tarDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.e.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the directory entries sorted by name, as described
+// in fs.ReadDirFile.
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.started {
+		names := make([]string, 0, len(d.e.children))
+		for name := range d.e.children {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			d.entries = append(d.entries, d.e.children[name])
+		}
+		d.started = true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -1,23 +1,24 @@
 package main
 
 import (
-	"bufio"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"log/slog"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/auth"
 )
 
 var (
-	uname = flag.String("uname", os.Getenv("USER"), "Username to try to attach with")
-	aname = flag.String("aname", "", "File system to attach to (may be empty)")
+	uname   = flag.String("uname", os.Getenv("USER"), "Username to try to attach with")
+	aname   = flag.String("aname", "", "File system to attach to (may be empty)")
+	keyspec = flag.String("keyspec", "", "Attributes selecting the factotum key, if the server requires authentication")
+	debug   = flag.Bool("debug", false, "Log all 9P messages")
 )
 
 func usage() {
@@ -34,6 +35,10 @@ func parsePositionalArgs() (cmd string, service string, path string) {
 	cmd = flag.Args()[0]
 	arg := flag.Args()[1]
 	service, path, _ = strings.Cut(arg, "/")
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		path = "."
+	}
 	return
 }
 
@@ -51,11 +56,16 @@ func main() {
 	flag.Parse()
 	cmd, service, path := parsePositionalArgs()
 
+	var dopts ninep.DialOpts
+	if *debug {
+		dopts.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
 	fsys, err := ninep.DialFS(service, ninep.DialFSOpts{
+		DialOpts: dopts,
 		AttachOpts: ninep.AttachOpts{
 			Uname:         *uname,
 			Aname:         *aname,
-			Authenticator: interact,
+			Authenticator: (&auth.Factotum{KeySpec: *keyspec}).Authenticate,
 		},
 	})
 	if err != nil {
@@ -93,19 +103,6 @@ func main() {
 		}
 		fmt.Printf("%d bytes written.\n", n)
 
-	case "rpc":
-		f, err := fsys.OpenFile(path, ninep.ORdWr)
-		if err != nil {
-			log.Fatalf("OpenFile: %v", err)
-		}
-		defer f.Close()
-
-		rw, ok := f.(io.ReadWriter)
-		if !ok {
-			log.Fatalf("not a read-writeable file: %v", f)
-		}
-		interact(rw)
-
 	case "stat":
 		stat, err := fs.Stat(fsys, path)
 		if err != nil {
@@ -127,43 +124,3 @@ func main() {
 		}
 	}
 }
-
-// TODO: Clean up this mess - this is probably wrong.
-func interact(f io.ReadWriter) error {
-	time.Sleep(500 * time.Millisecond)
-	stdinR := bufio.NewReader(os.Stdin)
-	var buf [8192]byte
-	for {
-		for {
-			n, err := f.Read(buf[:])
-			if err != nil {
-				if !errors.Is(err, io.EOF) {
-					fmt.Println("err:", err)
-					time.Sleep(500 * time.Millisecond)
-					break
-				}
-				return err
-			}
-			if n == 0 {
-				break
-			}
-			fmt.Println("*** " + string(buf[:n]))
-		}
-		line, err := stdinR.ReadString('\n')
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil
-			}
-			return err
-		}
-		line = strings.TrimSuffix(line, "\n") + "\x00"
-		_, err = f.Write([]byte(line))
-		if err != nil {
-			if strings.HasPrefix(err.Error(), "bad rpc verb") {
-				log.Printf("Error: %v", err)
-				continue
-			}
-			return err
-		}
-	}
-}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Numeric message types, for the golden wire encodings.
+var msgTypeNumbers = map[string]uint8{
+	"Topenfd": 98, "Ropenfd": 99,
+	"Tversion": 100, "Rversion": 101,
+	"Tauth": 102, "Rauth": 103,
+	"Tattach": 104, "Rattach": 105,
+	"Rerror": 107,
+	"Tflush": 108, "Rflush": 109,
+	"Twalk": 110, "Rwalk": 111,
+	"Topen": 112, "Ropen": 113,
+	"Tcreate": 114, "Rcreate": 115,
+	"Tread": 116, "Rread": 117,
+	"Twrite": 118, "Rwrite": 119,
+	"Tclunk": 120, "Rclunk": 121,
+	"Tremove": 122, "Rremove": 123,
+	"Tstat": 124, "Rstat": 125,
+	"Twstat": 126, "Rwstat": 127,
+}
+
+// A sample is a field value used in the generated tests,
+// as Go expression and in its wire encoding.
+//
+// The wire encoding is assembled here independently of the package's
+// encoder, following the layout of plan9port's convS2M(3): integers
+// are little-endian, strings and data are prefixed with their 2-byte
+// (resp. 4-byte) length, and stats are prefixed with their size twice.
+type sample struct {
+	lit  string
+	wire []string // hex, one entry per wire field
+}
+
+func le(v uint64, n int) string {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return hex.EncodeToString(buf[:n])
+}
+
+func str(s string) []string {
+	if s == "" {
+		return []string{le(0, 2)}
+	}
+	return []string{le(uint64(len(s)), 2), hex.EncodeToString([]byte(s))}
+}
+
+func qid(kind uint8, vers uint32, path uint64) []string {
+	return []string{le(uint64(kind), 1), le(uint64(vers), 4), le(path, 8)}
+}
+
+func statWire(dotu bool) []string {
+	var inner []string
+	inner = append(inner, le(0x0102, 2), le(0x03040506, 4))        // type, dev
+	inner = append(inner, qid(0x80, 7, 0x1122334455667788)...)     // qid
+	inner = append(inner, le(0x800001ed, 4))                       // mode
+	inner = append(inner, le(0x5f5e1000, 4), le(0x5f5e2000, 4))    // atime, mtime
+	inner = append(inner, le(0, 8))                                // length
+	for _, s := range []string{"lib", "glenda", "sys", "glenda"} { // name, uid, gid, muid
+		inner = append(inner, str(s)...)
+	}
+	if dotu {
+		inner = append(inner, str("")...)                            // extension
+		inner = append(inner, le(1000, 4), le(1001, 4), le(1000, 4)) // n_uid, n_gid, n_muid
+	}
+	n := len(strings.Join(inner, "")) / 2
+	return append([]string{le(uint64(n+2), 2), le(uint64(n), 2)}, inner...)
+}
+
+var samples = map[string]sample{
+	"tag":     {"0x0a0b", []string{le(0x0a0b, 2)}},
+	"oldtag":  {"0x0c0d", []string{le(0x0c0d, 2)}},
+	"fid":     {"0x01020304", []string{le(0x01020304, 4)}},
+	"afid":    {"0x05060708", []string{le(0x05060708, 4)}},
+	"newfid":  {"0x090a0b0c", []string{le(0x090a0b0c, 4)}},
+	"mode":    {"0x11", []string{le(0x11, 1)}},
+	"iounit":  {"0x2000", []string{le(0x2000, 4)}},
+	"perm":    {"0x800001ed", []string{le(0x800001ed, 4)}},
+	"unixfd":  {"3", []string{le(3, 4)}},
+	"msize":   {"8192", []string{le(8192, 4)}},
+	"count":   {"0x0100", []string{le(0x0100, 4)}},
+	"offset":  {"0x0102030405060708", []string{le(0x0102030405060708, 8)}},
+	"qid":     {"QID{Kind: QTDIR, Vers: 0x01020304, Path: 0x1122334455667788}", qid(0x80, 0x01020304, 0x1122334455667788)},
+	"aqid":    {"QID{Kind: QTAUTH, Vers: 0, Path: 0x99}", qid(0x08, 0, 0x99)},
+	"uname":   {`"glenda"`, str("glenda")},
+	"aname":   {`""`, str("")},
+	"ename":   {`"permission denied"`, str("permission denied")},
+	"name":    {`"lib"`, str("lib")},
+	"version": {`"9P2000"`, str("9P2000")},
+	"data":    {`[]byte("hello")`, []string{le(5, 4), hex.EncodeToString([]byte("hello"))}},
+	"nwnames": {`[]string{"lib", "font"}`, append(append([]string{le(2, 2)}, str("lib")...), str("font")...)},
+	"qids": {
+		"[]QID{{Kind: QTDIR, Vers: 1, Path: 2}, {Kind: QTFILE, Vers: 3, Path: 4}}",
+		append(append([]string{le(2, 2)}, qid(0x80, 1, 2)...), qid(0x00, 3, 4)...),
+	},
+	"stat": {
+		`Stat{Type: 0x0102, Dev: 0x03040506, QID: QID{Kind: QTDIR, Vers: 7, Path: 0x1122334455667788}, ` +
+			`Mode: 0x800001ed, Atime: 0x5f5e1000, Mtime: 0x5f5e2000, Name: "lib", UID: "glenda", GID: "sys", MUID: "glenda"}`,
+		statWire(false),
+	},
+	// 9P2000.u
+	"n_uname":   {"1000", []string{le(1000, 4)}},
+	"errno":     {"13", []string{le(13, 4)}},
+	"extension": {`"b 1 2"`, str("b 1 2")},
+	"dotu":      {"true", nil},
+	"stat.u": {
+		`Stat{Type: 0x0102, Dev: 0x03040506, QID: QID{Kind: QTDIR, Vers: 7, Path: 0x1122334455667788}, ` +
+			`Mode: 0x800001ed, Atime: 0x5f5e1000, Mtime: 0x5f5e2000, Name: "lib", UID: "glenda", GID: "sys", MUID: "glenda", ` +
+			`NUID: 1000, NGID: 1001, NMUID: 1000, DotU: true}`,
+		statWire(true),
+	},
+}
+
+func getSample(n string) sample {
+	s, ok := samples[n]
+	if !ok {
+		log.Fatalf("no sample for %q", n)
+	}
+	return s
+}
+
+// hasDotU reports whether the message spec ss has a 9P2000.u variant.
+func hasDotU(ss []string) bool {
+	return slices.ContainsFunc(ss, isDotU) || slices.Contains(ss, "stat[n]")
+}
+
+// dotuFields returns the fields of the 9P2000.u variant of the message
+// spec ss, or of the 9P2000 variant.
+func dotuFields(ss []string, dotu bool) []string {
+	base, ext := splitDotU(ss)
+	if dotu && len(ext) > 0 {
+		return append(append(base, ext...), "u:dotu[bool]")
+	}
+	return base
+}
+
+// sampleFor returns the sample for the field named n.
+func sampleFor(n string, dotu bool) sample {
+	if n == "stat" && dotu {
+		n = "stat.u"
+	}
+	return getSample(n)
+}
+
+// goldenWire returns the golden wire encoding for the message spec ss,
+// as hex with the fields separated by spaces.
+func goldenWire(ss []string, dotu bool) string {
+	var fields []string
+	for _, s := range dotuFields(ss, dotu) {
+		_, n, _ := getInfo(s)
+		switch n {
+		case "size":
+		case "msgType":
+			fields = append(fields, le(uint64(msgTypeNumbers[ss[1]]), 1))
+		default:
+			fields = append(fields, sampleFor(n, dotu).wire...)
+		}
+	}
+	size := 4 + len(strings.Join(fields, ""))/2
+	return strings.Join(append([]string{le(uint64(size), 4)}, fields...), " ")
+}
+
+// goldenLiteral returns the Go expression for the sample message.
+func goldenLiteral(ss []string, dotu bool) string {
+	var fields []string
+	for _, s := range dotuFields(ss, dotu) {
+		_, n, _ := getInfo(s)
+		if n == "size" || n == "msgType" {
+			continue
+		}
+		fields = append(fields, fieldName(n)+": "+sampleFor(n, dotu).lit)
+	}
+	return fmt.Sprintf("&%v{%v}", ss[1], strings.Join(fields, ", "))
+}
+
+// Additional golden messages which are not covered by the samples.
+var extraGolden = []struct{ lit, wire string }{
+	// A version request as sent by most clients.
+	{`&Tversion{Tag: notag, Msize: 8192, Version: "9P2000"}`, "13000000 64 ffff 00200000 0600 395032303030"},
+	// Walks to the same fid.
+	{`&Twalk{Tag: 1, FID: 2, NewFID: 2, Wnames: []string{}}`, "11000000 6e 0100 02000000 02000000 0000"},
+	{`&Rwalk{Tag: 1, QIDs: []QID{}}`, "09000000 6f 0100 0000"},
+	// End of file.
+	{`&Rread{Tag: 1, Data: []byte{}}`, "0b000000 75 0100 00000000"},
+}
+
+// emit prints s and a newline verbatim.
+func emit(s string) {
+	os.Stdout.WriteString(s + "\n")
+}
+
+func printGoldenTests(specs [][]string) {
+	emit(`package ninep
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("bad golden value %q: %v", s, err)
+	}
+	return b
+}`)
+
+	// Table of golden messages.
+	fmt.Println()
+	fmt.Println("var goldenMessages = []struct {")
+	fmt.Println("\tmsg  Message")
+	fmt.Println("\twire string")
+	fmt.Println("}{")
+	for _, ss := range specs {
+		ss = conflate(ss)
+		fmt.Printf("\t{%v, %q},\n", goldenLiteral(ss, false), goldenWire(ss, false))
+		if hasDotU(ss) {
+			fmt.Printf("\t{%v, %q},\n", goldenLiteral(ss, true), goldenWire(ss, true))
+		}
+	}
+	for _, g := range extraGolden {
+		fmt.Printf("\t{%v, %q},\n", g.lit, g.wire)
+	}
+	fmt.Println("}")
+
+	emit(`
+func TestMarshalGolden(t *testing.T) {
+	for _, tc := range goldenMessages {
+		got, err := Marshal(tc.msg)
+		if err != nil {
+			t.Errorf("Marshal(%#v): %v", tc.msg, err)
+			continue
+		}
+		if want := unhex(t, tc.wire); !bytes.Equal(got, want) {
+			t.Errorf("Marshal(%#v) = %x, want %x", tc.msg, got, want)
+		}
+	}
+}
+
+func TestUnmarshalGolden(t *testing.T) {
+	for _, tc := range goldenMessages {
+		got, err := Unmarshal(unhex(t, tc.wire))
+		if err != nil {
+			t.Errorf("Unmarshal(%q): %v", tc.wire, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.msg) {
+			t.Errorf("Unmarshal(%q) = %#v, want %#v", tc.wire, got, tc.msg)
+		}
+	}
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	for _, tc := range goldenMessages {
+		wire := unhex(t, tc.wire)
+		for n := 0; n < len(wire); n++ {
+			if _, err := Unmarshal(wire[:n]); err == nil {
+				t.Errorf("Unmarshal(%x) succeeded for truncated %v", wire[:n], tc.msg.Type())
+			}
+		}
+	}
+}`)
+
+	emit(`
+func TestReadMessageStream(t *testing.T) {
+	var stream bytes.Buffer
+	for _, tc := range goldenMessages {
+		stream.Write(unhex(t, tc.wire))
+	}
+	for _, tc := range goldenMessages {
+		got, err := ReadMessage(&stream)
+		if err != nil {
+			t.Fatalf("ReadMessage() for %v: %v", tc.msg.Type(), err)
+		}
+		if !reflect.DeepEqual(got, tc.msg) {
+			t.Errorf("ReadMessage() = %#v, want %#v", got, tc.msg)
+		}
+	}
+	if _, err := ReadMessage(&stream); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadMessage() at end of stream: got err %v, want %v", err, io.EOF)
+	}
+}`)
+}
@@ -5,28 +5,32 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strings"
 )
 
 var (
 	outfile = flag.String("o", "/dev/stdout", "output file")
-	prefix  = flag.String("prefix", "", "Prefix for function names to print")
+	tests   = flag.Bool("tests", false, "Print golden tests instead of message structs")
 )
 
 // Message specs, extracted from plan9port.
+//
+// Fields prefixed with "u:" are 9P2000.u extensions, which follow the
+// 9P2000 fields of the message.
 var msgSpecs [][]string = [][]string{
-	{"size[4]", "Tauth", "tag[2]", "afid[4]", "uname[s]", "aname[s]"},
+	{"size[4]", "Tauth", "tag[2]", "afid[4]", "uname[s]", "aname[s]", "u:n_uname[4]"},
 	{"size[4]", "Rauth", "tag[2]", "aqid[13]"},
-	{"size[4]", "Tattach", "tag[2]", "fid[4]", "afid[4]", "uname[s]", "aname[s]"},
+	{"size[4]", "Tattach", "tag[2]", "fid[4]", "afid[4]", "uname[s]", "aname[s]", "u:n_uname[4]"},
 	{"size[4]", "Rattach", "tag[2]", "qid[13]"},
 	{"size[4]", "Tclunk", "tag[2]", "fid[4]"},
 	{"size[4]", "Rclunk", "tag[2]"},
-	{"size[4]", "Rerror", "tag[2]", "ename[s]"},
+	{"size[4]", "Rerror", "tag[2]", "ename[s]", "u:errno[4]"},
 	{"size[4]", "Tflush", "tag[2]", "oldtag[2]"},
 	{"size[4]", "Rflush", "tag[2]"},
 	{"size[4]", "Topen", "tag[2]", "fid[4]", "mode[1]"},
 	{"size[4]", "Ropen", "tag[2]", "qid[13]", "iounit[4]"},
-	{"size[4]", "Tcreate", "tag[2]", "fid[4]", "name[s]", "perm[4]", "mode[1]"},
+	{"size[4]", "Tcreate", "tag[2]", "fid[4]", "name[s]", "perm[4]", "mode[1]", "u:extension[s]"},
 	{"size[4]", "Rcreate", "tag[2]", "qid[13]", "iounit[4]"},
 	{"size[4]", "Topenfd", "tag[2]", "fid[4]", "mode[1]"},
 	{"size[4]", "Ropenfd", "tag[2]", "qid[13]", "iounit[4]", "unixfd[4]"},
@@ -46,19 +50,30 @@ var msgSpecs [][]string = [][]string{
 	{"size[4]", "Rwalk", "tag[2]", "nwqid[2]", "nwqid*(qid[13])"},
 }
 
-func printComment(ss []string) {
-	fmt.Println()
-	fmt.Print("//")
+// isDotU reports whether s is a 9P2000.u field.
+func isDotU(s string) bool {
+	return strings.HasPrefix(s, "u:")
+}
+
+// splitDotU splits a message spec into the 9P2000 and 9P2000.u fields.
+func splitDotU(ss []string) (base, ext []string) {
 	for _, s := range ss {
-		fmt.Print(" " + s)
+		if isDotU(s) {
+			ext = append(ext, s)
+		} else {
+			base = append(base, s)
+		}
 	}
-	fmt.Println()
+	return base, ext
 }
 
 // returns type, variable name, size calculation code
 func getInfo(s string) (string, string, string) {
+	s = strings.TrimPrefix(s, "u:")
 	name, _, _ := strings.Cut(s, "[")
 	switch {
+	case s == "dotu[bool]":
+		return "bool", name, ""
 	case strings.HasSuffix(s, "[1]"):
 		return "uint8", name, "1"
 	case strings.HasSuffix(s, "[2]"):
@@ -74,7 +89,7 @@ func getInfo(s string) (string, string, string) {
 	case strings.HasPrefix(s, "T") || strings.HasPrefix(s, "R"):
 		return "uint8", "msgType", "1"
 	case s == "stat[n]":
-		return "Stat", name, fmt.Sprintf("(39 + 8 + len(%v.Name) + len(%v.UID) + len(%v.GID) + len(%v.MUID))", name, name, name, name)
+		return "Stat", name, fmt.Sprintf("(2 + 2 + int(statSize(%v)))", name)
 	case strings.HasSuffix(s, "[count[4]]"):
 		return "[]byte", name, fmt.Sprintf("(4 + len(%v))", name)
 	case s == "nwname*(wname[s])":
@@ -87,195 +102,245 @@ func getInfo(s string) (string, string, string) {
 	return "", "", ""
 }
 
-func dontReturnTag(name string) bool {
-	// We don't want to return the tag when reading reply data;
-	// the tags are already peeked in advance of reading by the 9p
-	// protocol layer.
-	return name[0] == 'R'
+// Exported struct field names for the variable names in msgSpecs.
+var fieldNames = map[string]string{
+	"tag":     "Tag",
+	"afid":    "AFID",
+	"fid":     "FID",
+	"newfid":  "NewFID",
+	"uname":   "Uname",
+	"aname":   "Aname",
+	"aqid":    "AQID",
+	"qid":     "QID",
+	"ename":   "Ename",
+	"oldtag":  "OldTag",
+	"mode":    "Mode",
+	"iounit":  "IOUnit",
+	"name":    "Name",
+	"perm":    "Perm",
+	"unixfd":  "UnixFD",
+	"offset":  "Offset",
+	"count":   "Count",
+	"data":    "Data",
+	"stat":    "Stat",
+	"msize":   "Msize",
+	"version": "Version",
+	"nwnames": "Wnames",
+	"qids":    "QIDs",
+	// 9P2000.u
+	"n_uname":   "NUname",
+	"errno":     "Errno",
+	"extension": "Extension",
+	"dotu":      "DotU",
 }
 
-func printDebugLine(name string, ss []string) {
-	request := name[0] == 'T'
+func fieldName(n string) string {
+	f, ok := fieldNames[n]
+	if !ok {
+		log.Fatalf("no field name for %q", n)
+	}
+	return f
+}
 
-	fmt.Println("\tif *debugLog {")
-	if request {
-		fmt.Print("\t\tlog.Println(\"<-\"")
-	} else {
-		fmt.Print("\t\tlog.Println(\"->\"")
+// writeFuncName returns the name of the function writing type t.
+func writeFuncName(t string) string {
+	switch t {
+	case "[]string":
+		return "writeStringSlice"
+	case "[]QID":
+		return "writeQIDSlice"
+	case "[]byte":
+		return "writeByteSlice"
 	}
+	return fmt.Sprintf("write%v", strings.Title(t))
+}
+
+// readFuncName returns the name of the function reading type t.
+func readFuncName(t string) string {
+	switch t {
+	case "[]string":
+		return "readStringSlice"
+	case "[]QID":
+		return "readQIDSlice"
+	case "[]byte":
+		return "readByteSlice"
+	}
+	return fmt.Sprintf("read%v", strings.Title(t))
+}
+
+// sizeExpr returns the Go expression for the encoded size
+// of the given fields of a message struct.
+func sizeExpr(ss []string) string {
+	var terms []string
 	for _, s := range ss {
-		_, n, _ := getInfo(s)
-		if n == "size" {
-			continue
+		_, n, sz := getInfo(s)
+		if n != "size" && n != "msgType" {
+			sz = regexp.MustCompile(`\b`+n+`\b`).ReplaceAllString(sz, "m."+fieldName(n))
 		}
-		if n == "msgType" {
-			fmt.Printf(", \"%v\"", name)
+		terms = append(terms, sz)
+	}
+	return strings.Join(terms, " + ")
+}
+
+func printStructFields(ss []string) {
+	width := 0
+	for _, s := range ss {
+		_, n, _ := getInfo(s)
+		if n == "size" || n == "msgType" {
 			continue
 		}
-		if n == "data" && name == "Rread" {
-			fmt.Print(", \"data\", data[:n]")
+		width = max(width, len(fieldName(n)))
+	}
+	for _, s := range ss {
+		t, n, _ := getInfo(s)
+		if n == "size" || n == "msgType" {
 			continue
 		}
-		fmt.Printf(", \"%v\", %v", n, n)
+		f := fieldName(n)
+		fmt.Printf("\t%v%v %v\n", f, strings.Repeat(" ", width-len(f)), t)
 	}
-	fmt.Println(")")
-	fmt.Println("\t}")
 }
 
-func printReadFunc(ss []string) {
-	name := ss[1]
-	funcname := "read" + name
-	if !strings.HasPrefix(funcname, *prefix) {
-		return
-	}
-	printComment(ss)
-
-	switch funcname {
-	case "readRread":
-		fmt.Println("func readRread(r io.Reader, data []byte) (n uint32, err error) {")
-	case "readTwrite":
-		fmt.Println("func readTwrite(r io.Reader, data []byte) (tag uint16, fid uint32, offset uint64, err error) {")
-	default:
-		fmt.Print("func " + funcname + "(r io.Reader) (")
-		for _, s := range ss {
-			t, n, _ := getInfo(s)
-			if n == "msgType" || n == "size" {
-				continue
-			}
-			if n == "tag" && dontReturnTag(name) {
-				continue
-			}
-			fmt.Print(n + " " + t + ", ")
+func printWrites(ss []string, name, indent string) {
+	for _, s := range ss {
+		t, n, _ := getInfo(s)
+		var arg string
+		switch n {
+		case "size":
+			arg = "size"
+		case "msgType":
+			arg = "uint8(Msg" + name + ")"
+		default:
+			arg = "m." + fieldName(n)
 		}
-		fmt.Println("err error) {")
+		if s == "stat[n]" {
+			fmt.Printf("%vif err := writeUint16(w, 2+statSize(%v)); err != nil {\n", indent, arg)
+			fmt.Printf("%v\treturn err\n", indent)
+			fmt.Printf("%v}\n", indent)
+		}
+		fmt.Printf("%vif err := %v(w, %v); err != nil {\n", indent, writeFuncName(t), arg)
+		fmt.Printf("%v\treturn err\n", indent)
+		fmt.Printf("%v}\n", indent)
 	}
+}
 
-	// Reading
-	fmt.Println("\tvar size uint32")
+func printReads(ss []string, indent string) {
 	for _, s := range ss {
 		t, n, _ := getInfo(s)
-		fname := fmt.Sprintf("read%v", strings.Title(t))
-		if t == "[]string" {
-			fname = "readStringSlice"
-		}
-		if t == "[]QID" {
-			fname = "readQIDSlice"
-		}
-		if t == "[]byte" {
-			if funcname != "readRread" {
-				log.Fatal("[]byte reading is only implemented for readRread right now, tried ", funcname)
-			}
-			fmt.Printf("\tif n, err = readAndFillByteSlice(r, %v); err != nil {\n", n)
-			fmt.Println("\t\treturn")
-			fmt.Println("\t}")
+		if n == "size" || n == "msgType" || n == "tag" {
 			continue
 		}
 		if s == "stat[n]" {
-			fmt.Println("\t// TODO: Why is this doubly size delimited?")
-			fmt.Println("\tvar outerStatSize uint16")
-			fmt.Println("\tif err = readUint16(r, &outerStatSize); err != nil {")
-			fmt.Println("\t\treturn")
-			fmt.Println("\t}")
-		}
-		if n == "msgType" {
-			fmt.Println("\tvar msgType uint8")
-		}
-		if n == "tag" && dontReturnTag(name) {
-			fmt.Println("\tvar tag uint16")
-		}
-		fmt.Printf("\tif err = %v(r, &%v); err != nil {\n", fname, n)
-		fmt.Println("\t\treturn")
-		fmt.Println("\t}")
-		if n == "tag" {
-			if name[0] == 'R' {
-				// XXX: Check whether this reads the full error message. (Unix extensions?)
-				fmt.Println("\tif msgType == Rerror {")
-				fmt.Println("\t\tvar errmsg string")
-				fmt.Println("\t\tif err = readString(r, &errmsg); err != nil {")
-				fmt.Println("\t\t\treturn")
-				fmt.Println("\t\t}")
-				fmt.Println("\t\terr = errors.New(errmsg)")
-				fmt.Println("\t\treturn")
-				fmt.Println("\t}")
-			}
-			fmt.Println("\tif msgType !=", name, "{")
-			fmt.Println("\t\terr = errUnexpectedMsg")
-			fmt.Println("\t\treturn")
-			fmt.Println("\t}")
+			fmt.Printf("%vvar outerStatSize uint16\n", indent)
+			fmt.Printf("%vif err := readUint16(r, &outerStatSize); err != nil {\n", indent)
+			fmt.Printf("%v\treturn err\n", indent)
+			fmt.Printf("%v}\n", indent)
 		}
+		fmt.Printf("%vif err := %v(r, &m.%v); err != nil {\n", indent, readFuncName(t), fieldName(n))
+		fmt.Printf("%v\treturn err\n", indent)
+		fmt.Printf("%v}\n", indent)
 	}
-	printDebugLine(name, ss)
-
-	fmt.Println("\treturn")
-	fmt.Println("}")
 }
 
-func printWriteFunc(ss []string) {
-
+func printMessageStruct(ss []string) {
 	name := ss[1]
-	var msgType string
+	base, ext := splitDotU(ss)
 
-	funcname := "write" + name
-	if !strings.HasPrefix(funcname, *prefix) {
-		return
+	fmt.Println()
+	fmt.Printf("// %v is the 9P message\n", name)
+	fmt.Println("//")
+	fmt.Print("//\t")
+	fmt.Println(strings.Join(base, " "))
+	if len(ext) > 0 {
+		fmt.Println("//")
+		fmt.Println("// 9P2000.u appends")
+		fmt.Println("//")
+		fmt.Print("//\t")
+		fmt.Println(strings.ReplaceAll(strings.Join(ext, " "), "u:", ""))
 	}
-	printComment(ss)
-
-	fmt.Print("func " + funcname + "(w io.Writer, ")
-	for i, s := range ss {
-		t, n, _ := getInfo(s)
-		// msgType is fixed for each method
-		if n == "msgType" {
-			msgType = s
-			continue
-		}
-		// size is calculated dynamically based on other parameters
-		if n == "size" {
-			continue
-		}
-		fmt.Print(n + " " + t)
-		if i < len(ss)-1 {
-			fmt.Print(", ")
-		}
+	fmt.Printf("type %v struct {\n", name)
+	printStructFields(base)
+	if len(ext) > 0 {
+		fmt.Println()
+		fmt.Println("\t// 9P2000.u fields, present if DotU is set")
+		printStructFields(append(ext, "u:dotu[bool]"))
 	}
-	fmt.Println(") error {")
+	fmt.Println("}")
 
-	printDebugLine(name, ss)
+	fmt.Println()
+	fmt.Printf("func (m *%v) Type() MsgType { return Msg%v }\n", name, name)
+	fmt.Println()
+	fmt.Printf("func (m *%v) MessageTag() uint16 { return m.Tag }\n", name)
+	fmt.Println()
+	fmt.Printf("func (m *%v) setTag(tag uint16) { m.Tag = tag }\n", name)
 
-	// Size calculation
-	fmt.Print("\tsize := uint32(")
-	for i, s := range ss {
-		_, _, sz := getInfo(s)
-		fmt.Print(sz)
-		if i < len(ss)-1 {
-			fmt.Print(" + ")
-		}
+	// Encoding
+	fmt.Println()
+	fmt.Printf("func (m *%v) encode(w io.Writer) error {\n", name)
+	fmt.Printf("\tsize := uint32(%v)\n", sizeExpr(base))
+	if len(ext) > 0 {
+		fmt.Println("\tif m.DotU {")
+		fmt.Printf("\t\tsize += uint32(%v)\n", sizeExpr(ext))
+		fmt.Println("\t}")
+	}
+	printWrites(base, name, "\t")
+	if len(ext) > 0 {
+		fmt.Println("\tif m.DotU {")
+		printWrites(ext, name, "\t\t")
+		fmt.Println("\t}")
 	}
-	fmt.Println(")")
+	fmt.Println("\treturn nil")
+	fmt.Println("}")
 
-	for _, s := range ss {
-		t, n, _ := getInfo(s)
-		funcname := fmt.Sprintf("write%v", strings.Title(t))
-		if t == "[]string" {
-			funcname = "writeStringSlice"
-		}
-		if t == "[]QID" {
-			funcname = "writeQIDSlice"
-		}
-		if t == "[]byte" {
-			funcname = "writeByteSlice"
-		}
-		if n == "msgType" {
-			n = msgType // resolve to constant directly
-		}
-		fmt.Printf("\tif err := %v(w, %v); err != nil {\n", funcname, n)
-		fmt.Println("\t\treturn err")
+	// Decoding of everything after the header.
+	fmt.Println()
+	fmt.Printf("func (m *%v) decode(tag uint16, r io.Reader) error {\n", name)
+	fmt.Println("\tm.Tag = tag")
+	printReads(base, "\t")
+	if len(ext) > 0 {
+		fmt.Println("\tif remaining(r) > 0 {")
+		fmt.Println("\t\tm.DotU = true")
+		printReads(ext, "\t\t")
 		fmt.Println("\t}")
 	}
 	fmt.Println("\treturn nil")
 	fmt.Println("}")
 }
 
+func printNewMessage(specs [][]string) {
+	fmt.Println()
+	fmt.Println("// newMessage returns a new message for the given type,")
+	fmt.Println("// or nil if the type is unknown.")
+	fmt.Println("func newMessage(t MsgType) Message {")
+	fmt.Println("\tswitch t {")
+	for _, ss := range specs {
+		fmt.Printf("\tcase Msg%v:\n", ss[1])
+		fmt.Printf("\t\treturn &%v{}\n", ss[1])
+	}
+	fmt.Println("\t}")
+	fmt.Println("\treturn nil")
+	fmt.Println("}")
+}
+
+func printMessageFID(specs [][]string) {
+	fmt.Println()
+	fmt.Println("// MessageFID returns the fid which the message refers to,")
+	fmt.Println("// or false if the message does not refer to a fid.")
+	fmt.Println("func MessageFID(m Message) (fid uint32, ok bool) {")
+	fmt.Println("\tswitch m := m.(type) {")
+	for _, ss := range specs {
+		for _, s := range ss {
+			if s == "fid[4]" {
+				fmt.Printf("\tcase *%v:\n", ss[1])
+				fmt.Println("\t\treturn m.FID, true")
+			}
+		}
+	}
+	fmt.Println("\t}")
+	fmt.Println("\treturn 0, false")
+	fmt.Println("}")
+}
+
 // Conflate:
 // count[4] data[count] => data[count[4]]
 func conflate(in []string) []string {
@@ -319,26 +384,17 @@ func main() {
 	defer f.Close()
 	os.Stdout = f
 
-	if strings.HasPrefix(*prefix, "w") {
-		fmt.Println(`package ninep
-
-import (
-	"io"
-	"log"
-)`)
-	} else {
-		fmt.Println(`package ninep
-
-import (
-	"errors"
-	"io"
-	"log"
-)`)
+	if *tests {
+		printGoldenTests(msgSpecs)
+		return
 	}
 
+	fmt.Println(`package ninep
+
+import "io"`)
 	for _, ss := range msgSpecs {
-		ss = conflate(ss)
-		printWriteFunc(ss)
-		printReadFunc(ss)
+		printMessageStruct(conflate(ss))
 	}
+	printNewMessage(msgSpecs)
+	printMessageFID(msgSpecs)
 }
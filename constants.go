@@ -1,37 +1,86 @@
 package ninep
 
+import "fmt"
+
+// MsgType is the type of a 9P message.
+type MsgType uint8
+
 // Every 9P message has an associated type indicating its contents and
 // wire format:
 const (
-	Tversion = 100
-	Rversion = 101
-	Tauth    = 102
-	Rauth    = 103
-	Tattach  = 104
-	Rattach  = 105
+	MsgTversion MsgType = 100
+	MsgRversion MsgType = 101
+	MsgTauth    MsgType = 102
+	MsgRauth    MsgType = 103
+	MsgTattach  MsgType = 104
+	MsgRattach  MsgType = 105
 	/* There is no request for errors. */
-	Rerror  = 107
-	Tflush  = 108
-	Rflush  = 109
-	Twalk   = 110
-	Rwalk   = 111
-	Topen   = 112
-	Ropen   = 113
-	Tcreate = 114
-	Rcreate = 115
-	Tread   = 116
-	Rread   = 117
-	Twrite  = 118
-	Rwrite  = 119
-	Tclunk  = 120
-	Rclunk  = 121
-	Tremove = 122
-	Rremove = 123
-	Tstat   = 124
-	Rstat   = 125
-	Twstat  = 126
-	Rwstat  = 127
+	MsgRerror  MsgType = 107
+	MsgTflush  MsgType = 108
+	MsgRflush  MsgType = 109
+	MsgTwalk   MsgType = 110
+	MsgRwalk   MsgType = 111
+	MsgTopen   MsgType = 112
+	MsgRopen   MsgType = 113
+	MsgTcreate MsgType = 114
+	MsgRcreate MsgType = 115
+	MsgTread   MsgType = 116
+	MsgRread   MsgType = 117
+	MsgTwrite  MsgType = 118
+	MsgRwrite  MsgType = 119
+	MsgTclunk  MsgType = 120
+	MsgRclunk  MsgType = 121
+	MsgTremove MsgType = 122
+	MsgRremove MsgType = 123
+	MsgTstat   MsgType = 124
+	MsgRstat   MsgType = 125
+	MsgTwstat  MsgType = 126
+	MsgRwstat  MsgType = 127
 	// Plan9 from User Space extensions
-	Topenfd = 98
-	Ropenfd = 99
+	MsgTopenfd MsgType = 98
+	MsgRopenfd MsgType = 99
 )
+
+var msgTypeNames = map[MsgType]string{
+	MsgTversion: "Tversion",
+	MsgRversion: "Rversion",
+	MsgTauth:    "Tauth",
+	MsgRauth:    "Rauth",
+	MsgTattach:  "Tattach",
+	MsgRattach:  "Rattach",
+	MsgRerror:   "Rerror",
+	MsgTflush:   "Tflush",
+	MsgRflush:   "Rflush",
+	MsgTwalk:    "Twalk",
+	MsgRwalk:    "Rwalk",
+	MsgTopen:    "Topen",
+	MsgRopen:    "Ropen",
+	MsgTcreate:  "Tcreate",
+	MsgRcreate:  "Rcreate",
+	MsgTread:    "Tread",
+	MsgRread:    "Rread",
+	MsgTwrite:   "Twrite",
+	MsgRwrite:   "Rwrite",
+	MsgTclunk:   "Tclunk",
+	MsgRclunk:   "Rclunk",
+	MsgTremove:  "Tremove",
+	MsgRremove:  "Rremove",
+	MsgTstat:    "Tstat",
+	MsgRstat:    "Rstat",
+	MsgTwstat:   "Twstat",
+	MsgRwstat:   "Rwstat",
+	MsgTopenfd:  "Topenfd",
+	MsgRopenfd:  "Ropenfd",
+}
+
+func (t MsgType) String() string {
+	if s, ok := msgTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("MsgType(%d)", uint8(t))
+}
+
+// IsRequest reports whether t is the type of a T-message.
+func (t MsgType) IsRequest() bool {
+	return t%2 == 0
+}
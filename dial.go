@@ -2,14 +2,16 @@ package ninep
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // nofid is the fid value used to indicate absence of a FID,
@@ -20,32 +22,173 @@ const nofid uint32 = ^uint32(0)
 // e.g. during authentication
 const notag uint16 = ^uint16(0)
 
-func dialNet(service string) (net.Conn, error) {
+// DialNet connects to a 9p service without speaking 9p on the
+// connection.  The service is one of
+//
+//   - a Plan 9 dial string "tcp!host!port" or "unix!path",
+//     where the port defaults to 564,
+//   - "tls!host!port", for TLS over TCP with the default TLS
+//     configuration (see DialOpts.TLSConfig),
+//   - "sources", for sources.9p.io,
+//   - "localhost:port", for a local TCP port, or
+//   - the name of a service in the plan9port namespace directory,
+//     e.g. "acme" (see Namespace).
+func DialNet(service string) (net.Conn, error) {
+	return dialNet(service, nil)
+}
+
+// dialNet is like DialNet, but uses TLS with the configuration cfg
+// if it is non-nil or if the service is a "tls!" dial string.
+func dialNet(service string, cfg *tls.Config) (net.Conn, error) {
+	rest, isTLS := strings.CutPrefix(service, "tls!")
+	if !isTLS && cfg == nil {
+		return dialPlain(service)
+	}
+	if isTLS {
+		service = "tcp!" + rest
+	}
+	if cfg == nil {
+		cfg = &tls.Config{}
+	} else {
+		cfg = cfg.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = dialHost(service)
+	}
+	conn, err := dialPlain(service)
+	if err != nil {
+		return nil, err
+	}
+	tc := tls.Client(conn, cfg)
+	if err := tc.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// dialHost returns the host name of a TCP service, for verifying
+// the server's certificate.
+func dialHost(service string) string {
+	addr := service
+	if network, a, ok := parseDialString(service); ok {
+		if network != "tcp" {
+			return ""
+		}
+		addr = a
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+func dialPlain(service string) (net.Conn, error) {
+	if network, addr, ok := parseDialString(service); ok {
+		return net.Dial(network, addr)
+	}
 	if service == "sources" {
 		return net.Dial("tcp", "sources.9p.io:564")
 	}
 	if strings.HasPrefix(service, "localhost:") {
 		return net.Dial("tcp", service)
 	}
-	sessionDir := fmt.Sprintf("ns.%s.%s", os.Getenv("USER"), os.Getenv("DISPLAY"))
-	return net.Dial("unix", filepath.Join("/tmp", sessionDir, service))
+	return net.Dial("unix", filepath.Join(Namespace(), service))
+}
+
+// Namespace returns the plan9port namespace directory, in which
+// services are posted as unix sockets.  As in namespace(1), it is
+// $NAMESPACE, or /tmp/ns.$USER.$DISPLAY.
+func Namespace() string {
+	if ns := os.Getenv("NAMESPACE"); ns != "" {
+		return ns
+	}
+	return filepath.Join("/tmp", fmt.Sprintf("ns.%s.%s", os.Getenv("USER"), os.Getenv("DISPLAY")))
+}
+
+// ListenNet listens for 9p connections.  The address is
+//
+//   - a Plan 9 dial string "tcp!host!port" or "unix!path", where the
+//     host "*" listens on all addresses,
+//   - a TCP address "host:port", or
+//   - a service name, which is posted in the plan9port namespace
+//     directory, so that DialNet and plan9port's 9p(1) can reach it.
+func ListenNet(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "tcp!*!") {
+		addr = "tcp!!" + strings.TrimPrefix(addr, "tcp!*!")
+	}
+	if network, addr, ok := parseDialString(addr); ok {
+		return net.Listen(network, addr)
+	}
+	if strings.ContainsAny(addr, ":!/") {
+		return net.Listen("tcp", addr)
+	}
+	return postService(addr)
 }
 
-func versionRPC(c net.Conn, wantVersion string, wantMsize uint32) (msize uint32, vErr error) {
-	if err := writeTversion(c, notag, wantMsize, wantVersion); err != nil {
+// postService listens on a unix socket for the service name in the
+// namespace directory.  A socket left over by a previous server is
+// replaced.
+func postService(name string) (net.Listener, error) {
+	ns := Namespace()
+	if err := os.MkdirAll(ns, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(ns, name)
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("service %q is already posted in %v", name, ns)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// parseDialString parses a Plan 9 dial string like "tcp!host!port"
+// into a network and address for net.Dial.
+func parseDialString(s string) (network, addr string, ok bool) {
+	fields := strings.Split(s, "!")
+	switch {
+	case fields[0] == "tcp" && len(fields) == 2:
+		return "tcp", net.JoinHostPort(fields[1], "564"), true
+	case fields[0] == "tcp" && len(fields) == 3:
+		return "tcp", net.JoinHostPort(fields[1], fields[2]), true
+	case fields[0] == "unix" && len(fields) == 2:
+		return "unix", fields[1], true
+	}
+	return "", "", false
+}
+
+func versionRPC(c io.ReadWriter, logger *slog.Logger, wantVersion string, wantMsize uint32) (msize uint32, vErr error) {
+	ctx := context.Background()
+	req := &Tversion{Tag: notag, Msize: wantMsize, Version: wantVersion}
+	start := time.Now()
+	logRequest(ctx, logger, req)
+	if err := WriteMessage(c, req); err != nil {
 		return 0, err
 	}
-	msize, version, err := readRversion(c)
+	resp, err := readMessage(c, wantMsize)
 	if err != nil {
 		return 0, fmt.Errorf("version(%q, %q): %w", wantMsize, wantVersion, err)
 	}
+	logReply(ctx, logger, req, resp, time.Since(start))
+	rv, ok := resp.(*Rversion)
+	if !ok {
+		if e, ok := resp.(*Rerror); ok {
+			return 0, fmt.Errorf("version(%q, %q): %w", wantMsize, wantVersion, &Error{Ename: e.Ename})
+		}
+		return 0, fmt.Errorf("version(%q, %q): %w", wantMsize, wantVersion, errUnexpectedMsg)
+	}
+	msize = rv.Msize
 
 	if wantMsize < msize {
 		return 0, fmt.Errorf("server wanted too high msize of %v", msize)
 	}
 
-	if version != wantVersion {
-		return 0, fmt.Errorf("mismatching version: %q != %q", version, wantVersion)
+	if rv.Version != wantVersion {
+		return 0, fmt.Errorf("mismatching version: %q != %q", rv.Version, wantVersion)
 	}
 	return msize, nil
 }
@@ -67,19 +210,46 @@ func DialFS(service string, opts DialFSOpts) (dFS *FS, dErr error) {
 
 type DialOpts struct {
 	Concurrency uint16
+
+	// Logger, if non-nil, receives a debug-level record for every
+	// message sent and received, with the message type, tag, fid
+	// and reply latency as attributes.
+	Logger *slog.Logger
+
+	// Interceptors wrap every RPC on the connection, with the first
+	// interceptor outermost.  Version negotiation happens before
+	// interceptors are installed and does not pass through them.
+	Interceptors []Interceptor
+
+	// Trace, if non-nil, records all messages on the transport,
+	// including version negotiation.
+	Trace *TraceWriter
+
+	// TLSConfig, if non-nil, makes Dial connect with TLS.  Set its
+	// Certificates to authenticate with a client certificate.  The
+	// ServerName defaults to the host in the service address.
+	// Services of the form "tls!host!port" use TLS even without a
+	// TLSConfig.
+	TLSConfig *tls.Config
 }
 
 // Dial establishes a 9p client connection and returns it.
 func Dial(service string, opts DialOpts) (dConn *ClientConn, dErr error) {
+	netConn, err := dialNet(service, opts.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientConn(netConn, opts)
+}
+
+// NewClientConn establishes a 9p client connection over an already
+// connected transport.  The transport is closed when the returned
+// ClientConn is closed or when establishing the connection fails.
+func NewClientConn(netConn io.ReadWriteCloser, opts DialOpts) (dConn *ClientConn, dErr error) {
 	if opts.Concurrency == 0 {
 		opts.Concurrency = 256
 	}
 
-	// Dial.
-	netConn, err := dialNet(service)
-	if err != nil {
-		return nil, err
-	}
 	defer func() {
 		if dConn != nil {
 			return
@@ -87,8 +257,12 @@ func Dial(service string, opts DialOpts) (dConn *ClientConn, dErr error) {
 		netConn.Close()
 	}()
 
+	if opts.Trace != nil {
+		netConn = newTracingConn(netConn, opts.Trace)
+	}
+
 	// Check version and negotiate msize.
-	msize, err := versionRPC(netConn, "9P2000", 8192)
+	msize, err := versionRPC(netConn, opts.Logger, "9P2000", 8192)
 	if err != nil {
 		return nil, err
 	}
@@ -100,8 +274,11 @@ func Dial(service string, opts DialOpts) (dConn *ClientConn, dErr error) {
 		conn:       netConn,
 		reqReaders: make(map[uint16]callback),
 		msize:      msize,
+		logger:     opts.Logger,
 		cancel:     cancelCause,
+		done:       make(chan struct{}),
 	}
+	cc.invoke = chainInterceptors(cc.roundTrip, opts.Interceptors)
 	// Fill tag queue.
 	for i := uint16(0); i < opts.Concurrency; i++ {
 		cc.tags <- i
@@ -115,8 +292,7 @@ func Dial(service string, opts DialOpts) (dConn *ClientConn, dErr error) {
 			if ctx.Err() != nil {
 				return // OK
 			}
-			// TODO: How to report error correctly?
-			log.Fatalf("9p client: run(): %v", err)
+			cc.fail(fmt.Errorf("9p client: %w", err))
 		}
 	}()
 
@@ -0,0 +1,72 @@
+package ninep
+
+import (
+	"io"
+	"testing"
+)
+
+func TestParseDialString(t *testing.T) {
+	for _, tc := range []struct {
+		in            string
+		network, addr string
+		ok            bool
+	}{
+		{"tcp!sources.9p.io!564", "tcp", "sources.9p.io:564", true},
+		{"tcp!localhost", "tcp", "localhost:564", true},
+		{"tcp!::1!5640", "tcp", "[::1]:5640", true},
+		{"unix!/tmp/ns.glenda.:0/acme", "unix", "/tmp/ns.glenda.:0/acme", true},
+		{"acme", "", "", false},
+		{"localhost:564", "", "", false},
+		{"udp!localhost!564", "", "", false},
+		{"tcp!a!b!c", "", "", false},
+	} {
+		network, addr, ok := parseDialString(tc.in)
+		if network != tc.network || addr != tc.addr || ok != tc.ok {
+			t.Errorf("parseDialString(%q) = %q, %q, %v; want %q, %q, %v", tc.in, network, addr, ok, tc.network, tc.addr, tc.ok)
+		}
+	}
+}
+
+func TestDialHost(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"tcp!fs.example.com!564", "fs.example.com"},
+		{"tcp!fs.example.com", "fs.example.com"},
+		{"tcp!::1!5640", "::1"},
+		{"localhost:564", "localhost"},
+		{"unix!/tmp/fs", ""},
+	} {
+		if got := dialHost(tc.in); got != tc.want {
+			t.Errorf("dialHost(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestListenService(t *testing.T) {
+	t.Setenv("NAMESPACE", t.TempDir())
+	l, err := ListenNet("testsrv")
+	if err != nil {
+		t.Fatalf("ListenNet: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Write([]byte("hi"))
+			conn.Close()
+		}
+	}()
+	conn, err := DialNet("testsrv")
+	if err != nil {
+		t.Fatalf("DialNet: %v", err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hi" {
+		t.Errorf("read %q, %v from posted service", buf, err)
+	}
+
+	if l2, err := ListenNet("testsrv"); err == nil {
+		l2.Close()
+		t.Errorf("posting the service twice succeeded")
+	}
+}
@@ -1,7 +1,39 @@
 package ninep
 
-import "errors"
+import (
+	"errors"
+	"io/fs"
+	"strings"
+)
 
 var (
-	errUnexpectedMsg error = errors.New("unexpected message")
+	errUnexpectedMsg    error = errors.New("unexpected message")
+	errLengthExceedsMsg error = errors.New("length field exceeds message size")
 )
+
+// Error is an error reported by the server in an Rerror message.
+type Error struct {
+	Ename string // Error message as sent by the server.
+}
+
+func (e *Error) Error() string { return e.Ename }
+
+// Is reports whether the server error corresponds to target, for the
+// io/fs errors fs.ErrNotExist, fs.ErrExist and fs.ErrPermission.
+//
+// 9P errors are strings, so this is based on the messages used by Plan
+// 9, plan9port and common Unix servers.
+func (e *Error) Is(target error) bool {
+	msg := strings.ToLower(e.Ename)
+	switch target {
+	case fs.ErrNotExist:
+		return strings.Contains(msg, "does not exist") ||
+			strings.Contains(msg, "not found") ||
+			strings.Contains(msg, "no such file")
+	case fs.ErrExist:
+		return strings.Contains(msg, "exists")
+	case fs.ErrPermission:
+		return strings.Contains(msg, "permission denied")
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package ninep
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The String methods of the messages format them like plan9port's
+// fcallfmt in lib9/fcallfmt.c, e.g.
+//
+//	Twalk tag 3 fid 1 newfid 2 nwname 2 0:lib 1:font
+//
+// 9P2000.u fields are appended where present.
+
+// fcallQID formats q like %Q in plan9port.
+func fcallQID(q QID) string {
+	var t strings.Builder
+	for _, b := range []struct {
+		bit uint8
+		c   byte
+	}{{QTDIR, 'd'}, {QTAPPEND, 'a'}, {QTEXCL, 'l'}, {QTAUTH, 'A'}} {
+		if q.Kind&b.bit != 0 {
+			t.WriteByte(b.c)
+		}
+	}
+	return fmt.Sprintf("(%.16x %d %s)", q.Path, q.Vers, t.String())
+}
+
+// fcallMode formats permission bits like %M in plan9port.
+func fcallMode(m uint32) string {
+	var b strings.Builder
+	for _, f := range []struct {
+		bit uint32
+		c   byte
+	}{{ModeDir, 'd'}, {ModeAppend, 'a'}, {ModeAuth, 'A'}, {ModeExcl, 'l'}} {
+		if m&f.bit != 0 {
+			b.WriteByte(f.c)
+		}
+	}
+	const rwx = "rwxrwxrwx"
+	for i := 0; i < 9; i++ {
+		if m&(1<<(8-i)) != 0 {
+			b.WriteByte(rwx[i])
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// maxDump is the number of data bytes shown in formatted messages.
+const maxDump = 64
+
+// dumpSome formats the start of data like plan9port's dumpsome: as
+// quoted text if it is printable, and in hex otherwise.
+func dumpSome(data []byte) string {
+	if len(data) > maxDump {
+		data = data[:maxDump]
+	}
+	printable := true
+	for _, c := range data {
+		if (c < 32 && c != '\n' && c != '\t') || c > 127 {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return "'" + string(data) + "'"
+	}
+	var b strings.Builder
+	b.WriteByte('\'')
+	for i, c := range data {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%.2x", c)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// String formats s like plan9port's fdirconv.
+func (s Stat) String() string {
+	str := fmt.Sprintf("'%s' '%s' '%s' '%s' q %s m %#o at %d mt %d l %d t %d d %d",
+		s.Name, s.UID, s.GID, s.MUID, fcallQID(s.QID), s.Mode,
+		s.Atime, s.Mtime, s.Length, s.Type, s.Dev)
+	if s.DotU {
+		str += fmt.Sprintf(" ext '%s' nuid %d ngid %d nmuid %d", s.Extension, s.NUID, s.NGID, s.NMUID)
+	}
+	return str
+}
+
+func (m *Tversion) String() string {
+	return fmt.Sprintf("Tversion tag %d msize %d version '%s'", m.Tag, m.Msize, m.Version)
+}
+
+func (m *Rversion) String() string {
+	return fmt.Sprintf("Rversion tag %d msize %d version '%s'", m.Tag, m.Msize, m.Version)
+}
+
+func (m *Tauth) String() string {
+	s := fmt.Sprintf("Tauth tag %d afid %d uname %s aname %s", m.Tag, int32(m.AFID), m.Uname, m.Aname)
+	if m.DotU {
+		s += fmt.Sprintf(" n_uname %d", int32(m.NUname))
+	}
+	return s
+}
+
+func (m *Rauth) String() string {
+	return fmt.Sprintf("Rauth tag %d qid %s", m.Tag, fcallQID(m.AQID))
+}
+
+func (m *Tattach) String() string {
+	s := fmt.Sprintf("Tattach tag %d fid %d afid %d uname %s aname %s", m.Tag, int32(m.FID), int32(m.AFID), m.Uname, m.Aname)
+	if m.DotU {
+		s += fmt.Sprintf(" n_uname %d", int32(m.NUname))
+	}
+	return s
+}
+
+func (m *Rattach) String() string {
+	return fmt.Sprintf("Rattach tag %d qid %s", m.Tag, fcallQID(m.QID))
+}
+
+func (m *Rerror) String() string {
+	s := fmt.Sprintf("Rerror tag %d ename %s", m.Tag, m.Ename)
+	if m.DotU {
+		s += fmt.Sprintf(" errno %d", m.Errno)
+	}
+	return s
+}
+
+func (m *Tflush) String() string {
+	return fmt.Sprintf("Tflush tag %d oldtag %d", m.Tag, m.OldTag)
+}
+
+func (m *Rflush) String() string {
+	return fmt.Sprintf("Rflush tag %d", m.Tag)
+}
+
+func (m *Twalk) String() string {
+	s := fmt.Sprintf("Twalk tag %d fid %d newfid %d nwname %d", m.Tag, int32(m.FID), int32(m.NewFID), len(m.Wnames))
+	for i, name := range m.Wnames {
+		s += fmt.Sprintf(" %d:%s", i, name)
+	}
+	return s
+}
+
+func (m *Rwalk) String() string {
+	s := fmt.Sprintf("Rwalk tag %d nwqid %d", m.Tag, len(m.QIDs))
+	for i, q := range m.QIDs {
+		s += fmt.Sprintf(" %d:%s", i, fcallQID(q))
+	}
+	return s
+}
+
+func (m *Topen) String() string {
+	return fmt.Sprintf("Topen tag %d fid %d mode %d", m.Tag, m.FID, m.Mode)
+}
+
+func (m *Ropen) String() string {
+	return fmt.Sprintf("Ropen tag %d qid %s iounit %d", m.Tag, fcallQID(m.QID), m.IOUnit)
+}
+
+func (m *Tcreate) String() string {
+	s := fmt.Sprintf("Tcreate tag %d fid %d name %s perm %s mode %d", m.Tag, m.FID, m.Name, fcallMode(m.Perm), m.Mode)
+	if m.DotU {
+		s += fmt.Sprintf(" extension %s", m.Extension)
+	}
+	return s
+}
+
+func (m *Rcreate) String() string {
+	return fmt.Sprintf("Rcreate tag %d qid %s iounit %d", m.Tag, fcallQID(m.QID), m.IOUnit)
+}
+
+func (m *Topenfd) String() string {
+	return fmt.Sprintf("Topenfd tag %d fid %d mode %d", m.Tag, m.FID, m.Mode)
+}
+
+func (m *Ropenfd) String() string {
+	return fmt.Sprintf("Ropenfd tag %d qid %s iounit %d unixfd %d", m.Tag, fcallQID(m.QID), m.IOUnit, int32(m.UnixFD))
+}
+
+func (m *Tread) String() string {
+	return fmt.Sprintf("Tread tag %d fid %d offset %d count %d", m.Tag, int32(m.FID), int64(m.Offset), m.Count)
+}
+
+func (m *Rread) String() string {
+	return fmt.Sprintf("Rread tag %d count %d %s", m.Tag, len(m.Data), dumpSome(m.Data))
+}
+
+func (m *Twrite) String() string {
+	return fmt.Sprintf("Twrite tag %d fid %d offset %d count %d %s", m.Tag, int32(m.FID), int64(m.Offset), len(m.Data), dumpSome(m.Data))
+}
+
+func (m *Rwrite) String() string {
+	return fmt.Sprintf("Rwrite tag %d count %d", m.Tag, m.Count)
+}
+
+func (m *Tclunk) String() string {
+	return fmt.Sprintf("Tclunk tag %d fid %d", m.Tag, m.FID)
+}
+
+func (m *Rclunk) String() string {
+	return fmt.Sprintf("Rclunk tag %d", m.Tag)
+}
+
+func (m *Tremove) String() string {
+	return fmt.Sprintf("Tremove tag %d fid %d", m.Tag, m.FID)
+}
+
+func (m *Rremove) String() string {
+	return fmt.Sprintf("Rremove tag %d", m.Tag)
+}
+
+func (m *Tstat) String() string {
+	return fmt.Sprintf("Tstat tag %d fid %d", m.Tag, m.FID)
+}
+
+func (m *Rstat) String() string {
+	return fmt.Sprintf("Rstat tag %d stat %v", m.Tag, m.Stat)
+}
+
+func (m *Twstat) String() string {
+	return fmt.Sprintf("Twstat tag %d fid %d stat %v", m.Tag, m.FID, m.Stat)
+}
+
+func (m *Rwstat) String() string {
+	return fmt.Sprintf("Rwstat tag %d", m.Tag)
+}
@@ -0,0 +1,44 @@
+package ninep
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMessageString(t *testing.T) {
+	for _, tc := range []struct {
+		msg  Message
+		want string
+	}{
+		{&Tversion{Tag: notag, Msize: 8192, Version: "9P2000"}, "Tversion tag 65535 msize 8192 version '9P2000'"},
+		{&Tauth{Tag: 1, AFID: 5, Uname: "glenda", Aname: ""}, "Tauth tag 1 afid 5 uname glenda aname "},
+		{&Tattach{Tag: 1, FID: 0, AFID: nofid, Uname: "glenda", Aname: "", NUname: 1000, DotU: true}, "Tattach tag 1 fid 0 afid -1 uname glenda aname  n_uname 1000"},
+		{&Rattach{Tag: 1, QID: QID{Kind: QTDIR, Path: 1}}, "Rattach tag 1 qid (0000000000000001 0 d)"},
+		{&Rerror{Tag: 2, Ename: "permission denied"}, "Rerror tag 2 ename permission denied"},
+		{&Rerror{Tag: 2, Ename: "permission denied", Errno: 13, DotU: true}, "Rerror tag 2 ename permission denied errno 13"},
+		{&Twalk{Tag: 3, FID: 1, NewFID: 2, Wnames: []string{"lib", "font"}}, "Twalk tag 3 fid 1 newfid 2 nwname 2 0:lib 1:font"},
+		{&Rwalk{Tag: 3, QIDs: []QID{{Kind: QTDIR, Path: 0x10}, {Kind: QTAPPEND | QTEXCL, Vers: 2, Path: 0x11}}}, "Rwalk tag 3 nwqid 2 0:(0000000000000010 0 d) 1:(0000000000000011 2 al)"},
+		{&Tcreate{Tag: 4, FID: 2, Name: "tmp", Perm: ModeDir | 0755, Mode: ORead}, "Tcreate tag 4 fid 2 name tmp perm drwxr-xr-x mode 0"},
+		{&Tread{Tag: 5, FID: 2, Offset: 0, Count: 8168}, "Tread tag 5 fid 2 offset 0 count 8168"},
+		{&Rread{Tag: 5, Data: []byte("hello\n")}, "Rread tag 5 count 6 'hello\n'"},
+		{&Rread{Tag: 5, Data: []byte{0, 1, 2, 3, 0xff}}, "Rread tag 5 count 5 '00010203 ff'"},
+		{&Twrite{Tag: 6, FID: 2, Offset: 10, Data: []byte("x")}, "Twrite tag 6 fid 2 offset 10 count 1 'x'"},
+		{&Tclunk{Tag: 7, FID: 2}, "Tclunk tag 7 fid 2"},
+		{
+			&Rstat{Tag: 8, Stat: Stat{Name: "lib", UID: "glenda", GID: "sys", MUID: "glenda", QID: QID{Kind: QTDIR, Path: 1}, Mode: ModeDir | 0775, Mtime: 100}},
+			"Rstat tag 8 stat 'lib' 'glenda' 'sys' 'glenda' q (0000000000000001 0 d) m 020000000775 at 0 mt 100 l 0 t 0 d 0",
+		},
+	} {
+		if got := fmt.Sprint(tc.msg); got != tc.want {
+			t.Errorf("got  %q\nwant %q", got, tc.want)
+		}
+	}
+}
+
+func TestMessagesHaveString(t *testing.T) {
+	for typ := range msgTypeNames {
+		if _, ok := newMessage(typ).(fmt.Stringer); !ok {
+			t.Errorf("%v has no String method", typ)
+		}
+	}
+}
@@ -5,18 +5,25 @@ import "sync"
 // fidPool is a thread-safe pool of FIDs.
 //
 // The main operations on fidPool are acquisition and release of FIDs.
+// Released FIDs are handed out again by later acquisitions.
 type fidPool struct {
 	mu sync.Mutex
 
-	// TODO: This is an improper implementation.
-	// We should track used FIDs instead of just cycling.
-	nextFID uint32
+	nextFID uint32   // Highest FID handed out so far
+	free    []uint32 // Released FIDs, available for reuse
+	inUse   int      // Number of acquired FIDs not released yet
 }
 
 func (p *fidPool) Acquire() uint32 {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	p.inUse++
+	if n := len(p.free); n > 0 {
+		fid := p.free[n-1]
+		p.free = p.free[:n-1]
+		return fid
+	}
 	p.nextFID++
 	return p.nextFID
 }
@@ -25,10 +32,14 @@ func (p *fidPool) Release(fid uint32) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// TODO: This is just a hack to allow for limited
-	// pseudo-reuse.  We can return FIDs if they were the last
-	// ones that were acquired.
-	if p.nextFID == fid {
-		p.nextFID--
-	}
+	p.inUse--
+	p.free = append(p.free, fid)
+}
+
+// InUse returns the number of FIDs which are currently acquired.
+func (p *fidPool) InUse() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.inUse
 }
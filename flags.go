@@ -1,8 +0,0 @@
-package ninep
-
-import "flag"
-
-// Flags
-var (
-	debugLog = flag.Bool("9p.debug", false, "enable debug logging of requests and responses")
-)
@@ -0,0 +1,88 @@
+package ninep
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// seedMessages are used as fuzzing seeds.
+var seedMessages = []Message{
+	&Tversion{Tag: notag, Msize: 8192, Version: "9P2000"},
+	&Rversion{Tag: notag, Msize: 8192, Version: "9P2000"},
+	&Tauth{Tag: 1, AFID: 2, Uname: "glenda", Aname: ""},
+	&Rauth{Tag: 1, AQID: QID{Kind: QTAUTH, Path: 5}},
+	&Rerror{Tag: 1, Ename: "file does not exist"},
+	&Twalk{Tag: 3, FID: 1, NewFID: 2, Wnames: []string{"lib", "font"}},
+	&Rwalk{Tag: 3, QIDs: []QID{{Kind: QTDIR, Path: 1}, {Path: 2, Vers: 3}}},
+	&Tread{Tag: 4, FID: 2, Offset: 1024, Count: 512},
+	&Rread{Tag: 4, Data: []byte("hello, world")},
+	&Twrite{Tag: 5, FID: 2, Offset: 7, Data: []byte("x")},
+	&Rstat{Tag: 6, Stat: Stat{Name: "NOTICE", UID: "sys", GID: "sys", MUID: "sys", Length: 42}},
+	&Twstat{Tag: 7, FID: 2, Stat: Stat{Name: "foo", Mode: 0644}},
+}
+
+func marshalSeeds(f *testing.F) {
+	f.Helper()
+	for _, m := range seedMessages {
+		buf, err := Marshal(m)
+		if err != nil {
+			f.Fatalf("Marshal(%v): %v", m, err)
+		}
+		f.Add(buf)
+	}
+	// Broken length fields.
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, byte(MsgRread), 0, 0, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{11, 0, 0, 0, byte(MsgRwalk), 0, 0, 0xff, 0xff, 0, 0})
+}
+
+func FuzzReadMessage(f *testing.F) {
+	marshalSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Messages are bounded by the msize, as on a ClientConn.
+		if m, err := readMessage(bytes.NewReader(data), 64); err == nil {
+			if buf, _ := Marshal(m); len(buf) > 64 {
+				t.Errorf("readMessage with msize 64 returned a %d-byte %v", len(buf), m.Type())
+			}
+		}
+		m, err := ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// Messages which could be decoded must survive a round trip.
+		buf, err := Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal(%#v): %v", m, err)
+		}
+		got, err := Unmarshal(buf)
+		if err != nil {
+			t.Fatalf("Unmarshal(Marshal(%#v)): %v", m, err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("Unmarshal(Marshal(%#v)) = %#v", m, got)
+		}
+	})
+}
+
+func FuzzReadStat(f *testing.F) {
+	var buf bytes.Buffer
+	writeStat(&buf, Stat{Name: "NOTICE", UID: "sys", GID: "sys", MUID: "sys"})
+	f.Add(buf.Bytes())
+	f.Add([]byte{0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var s Stat
+		readStat(bytes.NewReader(data), &s)
+	})
+}
+
+func FuzzReadStringSlice(f *testing.F) {
+	var buf bytes.Buffer
+	writeStringSlice(&buf, []string{"lib", "font"})
+	f.Add(buf.Bytes())
+	f.Add([]byte{0xff, 0xff, 0, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var ss []string
+		readStringSlice(bytes.NewReader(data), &ss)
+	})
+}
@@ -1,3 +1,8 @@
 module github.com/gnoack/ninep
 
 go 1.22
+
+require (
+	golang.org/x/crypto v0.32.0
+	golang.org/x/sys v0.29.0
+)
@@ -0,0 +1,495 @@
+//go:build linux
+
+// Package hostfs exports a directory of the host's file system, to be
+// served with ninep.Server, like u9fs(4).
+//
+// Paths are resolved one element at a time, with openat(2) relative
+// to the exported directory and without following symbolic links, so
+// that clients can not escape the exported tree.  Symbolic links are
+// listed in directories, but can not be walked through or opened.
+//
+// Access checks are those of the server process; the attaching user
+// name is not used.
+package hostfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/gnoack/ninep"
+)
+
+var (
+	errBadName    = errors.New("bad file name")
+	errRenameRoot = errors.New("can't rename root")
+	errDirLength  = errors.New("can't change length of directory")
+	errDirBit     = errors.New("can't change directory bit")
+	errImmutable  = errors.New("can't change qid, type or dev")
+	errUnknownUID = errors.New("unknown user")
+	errUnknownGID = errors.New("unknown group")
+)
+
+// FS is a host directory.  It implements ninep.FileServer.
+type FS struct {
+	// ReadOnly makes all changes to the file tree fail.
+	ReadOnly bool
+
+	rootFd int
+
+	// Caches of user and group names.
+	mu     sync.Mutex
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+// New returns an FS exporting the directory dir.  It must be closed
+// after use.
+func New(dir string) (*FS, error) {
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	return &FS{
+		rootFd: fd,
+		users:  make(map[uint32]string),
+		groups: make(map[uint32]string),
+	}, nil
+}
+
+// Close releases the exported directory.
+func (fsys *FS) Close() error {
+	return unix.Close(fsys.rootFd)
+}
+
+// Attach implements ninep.FileServer.
+func (fsys *FS) Attach(ctx context.Context, uname, aname string) (ninep.Node, error) {
+	if aname != "" {
+		return nil, os.ErrNotExist
+	}
+	return &node{fsys: fsys}, nil
+}
+
+// at calls f with a directory and the name of the file names within
+// it.  The directories along the path are opened without following
+// symbolic links.  The root is passed as "." in the exported directory.
+func (fsys *FS) at(names []string, f func(dirfd int, name string) error) error {
+	if len(names) == 0 {
+		return f(fsys.rootFd, ".")
+	}
+	dirfd := fsys.rootFd
+	for _, n := range names[:len(names)-1] {
+		fd, err := unix.Openat(dirfd, n, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if dirfd != fsys.rootFd {
+			unix.Close(dirfd)
+		}
+		if err != nil {
+			return err
+		}
+		dirfd = fd
+	}
+	if dirfd != fsys.rootFd {
+		defer unix.Close(dirfd)
+	}
+	return f(dirfd, names[len(names)-1])
+}
+
+// userName returns the name of the user uid, or the number if it is
+// not in the user database.
+func (fsys *FS) userName(uid uint32) string {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	if name, ok := fsys.users[uid]; ok {
+		return name
+	}
+	name := strconv.Itoa(int(uid))
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	fsys.users[uid] = name
+	return name
+}
+
+// groupName is like userName, for groups.
+func (fsys *FS) groupName(gid uint32) string {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	if name, ok := fsys.groups[gid]; ok {
+		return name
+	}
+	name := strconv.Itoa(int(gid))
+	if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	fsys.groups[gid] = name
+	return name
+}
+
+// lookupUID returns the uid of a user name or number.
+func lookupUID(name string) (int, error) {
+	if u, err := user.Lookup(name); err == nil {
+		return strconv.Atoi(u.Uid)
+	}
+	if uid, err := strconv.Atoi(name); err == nil {
+		return uid, nil
+	}
+	return 0, errUnknownUID
+}
+
+// lookupGID returns the gid of a group name or number.
+func lookupGID(name string) (int, error) {
+	if g, err := user.LookupGroup(name); err == nil {
+		return strconv.Atoi(g.Gid)
+	}
+	if gid, err := strconv.Atoi(name); err == nil {
+		return gid, nil
+	}
+	return 0, errUnknownGID
+}
+
+// toStat converts the host's file metadata.  The QID is derived from
+// the inode and device numbers, and the version from the modification
+// time and size, as in u9fs.
+func (fsys *FS) toStat(name string, st *unix.Stat_t) ninep.Stat {
+	mode := st.Mode & 0o777
+	var kind uint8
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFDIR:
+		mode |= ninep.ModeDir
+		kind = ninep.QTDIR
+	case unix.S_IFLNK:
+		mode |= ninep.ModeSymlink
+		kind = ninep.QTSYMLINK
+	}
+	length := uint64(st.Size)
+	if kind == ninep.QTDIR {
+		length = 0
+	}
+	uid := fsys.userName(st.Uid)
+	return ninep.Stat{
+		QID: ninep.QID{
+			Kind: kind,
+			Vers: uint32(st.Mtim.Sec) ^ uint32(st.Size<<8),
+			Path: st.Ino ^ st.Dev<<48,
+		},
+		Mode:   mode,
+		Atime:  uint32(st.Atim.Sec),
+		Mtime:  uint32(st.Mtim.Sec),
+		Length: length,
+		Name:   name,
+		UID:    uid,
+		GID:    fsys.groupName(st.Gid),
+		MUID:   uid,
+	}
+}
+
+// node is a file, identified by its path from the exported directory.
+type node struct {
+	fsys *FS
+
+	mu    sync.Mutex
+	names []string // Replaced, not modified, on rename.
+}
+
+// path returns the names of the path from the exported directory.
+func (n *node) path() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.names
+}
+
+// child returns the node for the file name in the directory n.
+func (n *node) child(name string) *node {
+	names := n.path()
+	return &node{fsys: n.fsys, names: append(names[:len(names):len(names)], name)}
+}
+
+func (n *node) name() string {
+	names := n.path()
+	if len(names) == 0 {
+		return "/"
+	}
+	return names[len(names)-1]
+}
+
+func (n *node) lstat() (st unix.Stat_t, err error) {
+	err = n.fsys.at(n.path(), func(dirfd int, name string) error {
+		return unix.Fstatat(dirfd, name, &st, unix.AT_SYMLINK_NOFOLLOW)
+	})
+	return st, err
+}
+
+func (n *node) Stat(ctx context.Context) (ninep.Stat, error) {
+	st, err := n.lstat()
+	if err != nil {
+		return ninep.Stat{}, err
+	}
+	return n.fsys.toStat(n.name(), &st), nil
+}
+
+func (n *node) Walk(ctx context.Context, name string) (ninep.Node, error) {
+	c := n.child(name)
+	if _, err := c.lstat(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// openFlags returns the open(2) flags for a 9P open mode.
+func openFlags(mode uint8) int {
+	var flags int
+	switch mode & 3 {
+	case ninep.ORead, ninep.OExec:
+		flags = unix.O_RDONLY
+	case ninep.OWrite:
+		flags = unix.O_WRONLY
+	case ninep.ORdWr:
+		flags = unix.O_RDWR
+	}
+	if mode&ninep.OTrunc != 0 {
+		flags |= unix.O_TRUNC
+	}
+	return flags | unix.O_NOFOLLOW | unix.O_CLOEXEC
+}
+
+func (n *node) Open(ctx context.Context, mode uint8) (ninep.Handle, error) {
+	if n.fsys.ReadOnly {
+		if m := mode & 3; m == ninep.OWrite || m == ninep.ORdWr || mode&(ninep.OTrunc|ninep.ORClose) != 0 {
+			return nil, unix.EROFS
+		}
+	}
+	var fd int
+	err := n.fsys.at(n.path(), func(dirfd int, name string) (err error) {
+		fd, err = unix.Openat(dirfd, name, openFlags(mode), 0)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return n.newHandle(fd)
+}
+
+func (n *node) newHandle(fd int) (ninep.Handle, error) {
+	f := os.NewFile(uintptr(fd), n.name())
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &dirHandle{fsys: n.fsys, f: f}, nil
+	}
+	return &fileHandle{f}, nil
+}
+
+func (n *node) Create(ctx context.Context, name string, perm uint32, mode uint8) (ninep.Node, ninep.Handle, error) {
+	if n.fsys.ReadOnly {
+		return nil, nil, unix.EROFS
+	}
+	c := n.child(name)
+	var fd int
+	err := n.fsys.at(c.path(), func(dirfd int, name string) (err error) {
+		if perm&ninep.ModeDir != 0 {
+			if err := unix.Mkdirat(dirfd, name, perm&0o777); err != nil {
+				return err
+			}
+			fd, err = unix.Openat(dirfd, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+			return err
+		}
+		fd, err = unix.Openat(dirfd, name, openFlags(mode)|unix.O_CREAT|unix.O_EXCL, perm&0o777)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	h, err := c.newHandle(fd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, h, nil
+}
+
+func (n *node) Remove(ctx context.Context) error {
+	if n.fsys.ReadOnly {
+		return unix.EROFS
+	}
+	return n.fsys.at(n.path(), func(dirfd int, name string) error {
+		var st unix.Stat_t
+		if err := unix.Fstatat(dirfd, name, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return err
+		}
+		if st.Mode&unix.S_IFMT == unix.S_IFDIR {
+			return unix.Unlinkat(dirfd, name, unix.AT_REMOVEDIR)
+		}
+		return unix.Unlinkat(dirfd, name, 0)
+	})
+}
+
+// Wstat implements ninep.Wstater, with truncate(2), chmod(2),
+// chown(2), utimes(2) and rename(2).  The changes are applied in that
+// order, until one of them fails.
+func (n *node) Wstat(ctx context.Context, s ninep.Stat) error {
+	if n.fsys.ReadOnly {
+		return unix.EROFS
+	}
+	null := ninep.NullStat()
+	if s.Type != null.Type || s.Dev != null.Dev || s.QID != null.QID {
+		return errImmutable
+	}
+	rename := s.Name != "" && s.Name != n.name()
+	if rename {
+		switch {
+		case len(n.path()) == 0:
+			return errRenameRoot
+		case strings.Contains(s.Name, "/") || s.Name == "." || s.Name == "..":
+			return errBadName
+		}
+	}
+	uid, gid := -1, -1
+	if s.UID != "" {
+		id, err := lookupUID(s.UID)
+		if err != nil {
+			return err
+		}
+		uid = id
+	}
+	if s.GID != "" {
+		id, err := lookupGID(s.GID)
+		if err != nil {
+			return err
+		}
+		gid = id
+	}
+	return n.fsys.at(n.path(), func(dirfd int, name string) error {
+		var st unix.Stat_t
+		if err := unix.Fstatat(dirfd, name, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return err
+		}
+		isDir := st.Mode&unix.S_IFMT == unix.S_IFDIR
+		if s.Length != null.Length {
+			if isDir {
+				if s.Length != 0 {
+					return errDirLength
+				}
+			} else if err := truncateAt(dirfd, name, int64(s.Length)); err != nil {
+				return err
+			}
+		}
+		if s.Mode != null.Mode {
+			if (s.Mode&ninep.ModeDir != 0) != isDir {
+				return errDirBit
+			}
+			if err := chmodAt(dirfd, name, s.Mode&0o777); err != nil {
+				return err
+			}
+		}
+		if uid != -1 || gid != -1 {
+			if err := unix.Fchownat(dirfd, name, uid, gid, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+				return err
+			}
+		}
+		if s.Mtime != null.Mtime || s.Atime != null.Atime {
+			ts := []unix.Timespec{{Nsec: unix.UTIME_OMIT}, {Nsec: unix.UTIME_OMIT}}
+			if s.Atime != null.Atime {
+				ts[0] = unix.NsecToTimespec(int64(s.Atime) * int64(time.Second))
+			}
+			if s.Mtime != null.Mtime {
+				ts[1] = unix.NsecToTimespec(int64(s.Mtime) * int64(time.Second))
+			}
+			if err := unix.UtimesNanoAt(dirfd, name, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+				return err
+			}
+		}
+		if rename {
+			if err := unix.Renameat2(dirfd, name, dirfd, s.Name, unix.RENAME_NOREPLACE); err != nil {
+				return err
+			}
+			n.mu.Lock()
+			names := n.names[:len(n.names)-1]
+			n.names = append(names[:len(names):len(names)], s.Name)
+			n.mu.Unlock()
+		}
+		return nil
+	})
+}
+
+// chmodAt changes the mode of the file name in dirfd, but not of the
+// target of a symbolic link.  chmod(2) follows symbolic links, so the
+// file is pinned with O_PATH first, and changed through /proc, where
+// it cannot be replaced by a symbolic link in between.
+func chmodAt(dirfd int, name string, mode uint32) error {
+	fd, err := unix.Openat(dirfd, name, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return err
+	}
+	if st.Mode&unix.S_IFMT == unix.S_IFLNK {
+		return unix.ELOOP
+	}
+	return unix.Chmod("/proc/self/fd/"+strconv.Itoa(fd), mode)
+}
+
+func truncateAt(dirfd int, name string, size int64) error {
+	fd, err := unix.Openat(dirfd, name, unix.O_WRONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	return unix.Ftruncate(fd, size)
+}
+
+type fileHandle struct{ f *os.File }
+
+func (h *fileHandle) Close() error { return h.f.Close() }
+
+func (h *fileHandle) ReadAt(ctx context.Context, p []byte, off int64) (int, error) {
+	return h.f.ReadAt(p, off)
+}
+
+func (h *fileHandle) WriteAt(ctx context.Context, p []byte, off int64) (int, error) {
+	return h.f.WriteAt(p, off)
+}
+
+type dirHandle struct {
+	fsys *FS
+	f    *os.File
+}
+
+func (h *dirHandle) Close() error { return h.f.Close() }
+
+func (h *dirHandle) ReadDir(ctx context.Context) ([]ninep.Stat, error) {
+	if _, err := h.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	names, err := h.f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := h.f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var stats []ninep.Stat
+	err = conn.Control(func(fd uintptr) {
+		for _, name := range names {
+			var st unix.Stat_t
+			if unix.Fstatat(int(fd), name, &st, unix.AT_SYMLINK_NOFOLLOW) != nil {
+				continue // Removed in the meantime.
+			}
+			stats = append(stats, h.fsys.toStat(name, &st))
+		}
+	})
+	return stats, err
+}
@@ -0,0 +1,207 @@
+//go:build linux
+
+package hostfs_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/hostfs"
+)
+
+var ctx = context.Background()
+
+// export serves the directory dir and attaches to it with fid 0.
+func export(t *testing.T, dir string) *ninep.ClientConn {
+	t.Helper()
+	fsys, err := hostfs.New(dir)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { fsys.Close() })
+	sc, cc := net.Pipe()
+	go (&ninep.Server{Files: fsys}).ServeConn(sc)
+	c, err := ninep.NewClientConn(cc, ninep.DialOpts{})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, err := c.Attach(ctx, 0, ^uint32(0), "glenda", ""); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	return c
+}
+
+// walk walks fid from the root along names.
+func walk(t *testing.T, c *ninep.ClientConn, fid uint32, names ...string) {
+	t.Helper()
+	qids, err := c.Walk(ctx, 0, fid, names)
+	if err != nil || len(qids) != len(names) {
+		t.Fatalf("Walk(%q) = %v, %v", names, qids, err)
+	}
+}
+
+func readAll(t *testing.T, c *ninep.ClientConn, fid uint32) string {
+	t.Helper()
+	buf := make([]byte, 1024)
+	n, err := c.Read(ctx, fid, 0, buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "hello"), []byte("hello, world\n"), 0o644)
+	os.Mkdir(filepath.Join(dir, "sub"), 0o755)
+	c := export(t, dir)
+
+	walk(t, c, 1, "hello")
+	if _, _, err := c.Open(ctx, 1, ninep.ORdWr); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got := readAll(t, c, 1); got != "hello, world\n" {
+		t.Errorf("Read = %q", got)
+	}
+	before, _ := c.Stat(ctx, 1)
+	if _, err := c.Write(ctx, 1, 13, []byte("bye\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	after, _ := c.Stat(ctx, 1)
+	if after.QID.Path != before.QID.Path || after.QID.Vers == before.QID.Vers {
+		t.Errorf("qid after write = %v, before = %v; want same path, new version", after.QID, before.QID)
+	}
+
+	var st syscall.Stat_t
+	syscall.Stat(filepath.Join(dir, "hello"), &st)
+	if after.QID.Path&(1<<48-1) != st.Ino {
+		t.Errorf("qid path = %#x, want inode %#x", after.QID.Path, st.Ino)
+	}
+	if u, err := user.Current(); err == nil && after.UID != u.Username {
+		t.Errorf("uid = %q, want %q", after.UID, u.Username)
+	}
+
+	walk(t, c, 2, "sub")
+	if _, _, err := c.Create(ctx, 2, "new", 0o640, ninep.OWrite); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	c.Write(ctx, 2, 0, []byte("new file"))
+	if got, _ := os.ReadFile(filepath.Join(dir, "sub", "new")); string(got) != "new file" {
+		t.Errorf("created file contains %q", got)
+	}
+
+	walk(t, c, 3)
+	if _, _, err := c.Open(ctx, 3, ninep.ORead); err != nil {
+		t.Fatalf("Open(.): %v", err)
+	}
+	buf := make([]byte, 8192)
+	n, err := c.Read(ctx, 3, 0, buf)
+	if err != nil {
+		t.Fatalf("Read(.): %v", err)
+	}
+	var names []string
+	for buf = buf[:n]; len(buf) > 0; {
+		var s ninep.Stat
+		size := int(buf[0]) | int(buf[1])<<8 + 2
+		if err := s.UnmarshalBinary(buf[:size]); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, s.Name)
+		buf = buf[size:]
+	}
+	slices.Sort(names)
+	if want := []string{"hello", "sub"}; !slices.Equal(names, want) {
+		t.Errorf("directory entries = %q, want %q", names, want)
+	}
+
+	walk(t, c, 4, "sub", "new")
+	if err := c.Remove(ctx, 4); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "new")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("file exists after Remove: %v", err)
+	}
+}
+
+func TestWstat(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a"), []byte("hello, world\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b"), nil, 0o644)
+	c := export(t, dir)
+
+	walk(t, c, 1, "a")
+	s := ninep.NullStat()
+	s.Name = "b"
+	if err := c.Wstat(ctx, 1, s); err == nil {
+		t.Errorf("rename onto existing file succeeded")
+	}
+	s = ninep.NullStat()
+	s.Length = 5
+	s.Mode = 0o600
+	s.Mtime = 1234567890
+	s.Name = "c"
+	if err := c.Wstat(ctx, 1, s); err != nil {
+		t.Fatalf("Wstat: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "c"))
+	if err != nil {
+		t.Fatalf("renamed file: %v", err)
+	}
+	if fi.Size() != 5 || fi.Mode() != 0o600 || fi.ModTime().Unix() != 1234567890 {
+		t.Errorf("after Wstat: size %v, mode %v, mtime %v", fi.Size(), fi.Mode(), fi.ModTime())
+	}
+	// The fid follows the file to its new name.
+	if st, err := c.Stat(ctx, 1); err != nil || st.Name != "c" || st.Length != 5 {
+		t.Errorf("Stat after rename = %v, %v; want name c, length 5", st, err)
+	}
+
+	s = ninep.NullStat()
+	s.Mode = ninep.ModeDir | 0o755
+	if err := c.Wstat(ctx, 1, s); err == nil || err.Error() != "can't change directory bit" {
+		t.Errorf("setting the directory bit: got %v, want %q", err, "can't change directory bit")
+	}
+}
+
+func TestConfinement(t *testing.T) {
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644)
+	dir := t.TempDir()
+	os.Symlink(outside, filepath.Join(dir, "dirlink"))
+	os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "filelink"))
+	os.Symlink("../"+filepath.Base(outside), filepath.Join(dir, "rellink"))
+	c := export(t, dir)
+
+	root, _ := c.Stat(ctx, 0)
+	qids, err := c.Walk(ctx, 0, 1, []string{"..", ".."})
+	if err != nil || len(qids) != 2 || qids[1] != root.QID {
+		t.Errorf("Walk(../..) = %v, %v; want the root %v", qids, err, root.QID)
+	}
+	for _, names := range [][]string{{"dirlink", "secret"}, {"rellink", "secret"}} {
+		if qids, err := c.Walk(ctx, 0, 2, names); err == nil && len(qids) == len(names) {
+			t.Errorf("Walk(%q) escaped the exported directory", names)
+			c.Clunk(ctx, 2)
+		}
+	}
+	walk(t, c, 3, "filelink")
+	if _, _, err := c.Open(ctx, 3, ninep.ORead); err == nil {
+		t.Errorf("Open of symbolic link succeeded")
+	}
+	s := ninep.NullStat()
+	s.Mode = 0o777
+	if err := c.Wstat(ctx, 3, s); err == nil {
+		t.Errorf("chmod of symbolic link succeeded")
+	}
+	if fi, _ := os.Stat(filepath.Join(outside, "secret")); fi.Mode() != 0o644 {
+		t.Errorf("mode of file outside changed to %v", fi.Mode())
+	}
+}
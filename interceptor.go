@@ -0,0 +1,31 @@
+package ninep
+
+import "context"
+
+// An Invoker sends the request req and returns the server's reply.
+// Rerror replies are returned as *Error.
+type Invoker func(ctx context.Context, req Message) (Message, error)
+
+// An Interceptor wraps the RPCs done by a ClientConn.
+//
+// The interceptor is called with each request and continues the RPC
+// by calling invoke, which may be another interceptor.  It may
+// inspect or replace the request and the reply, or skip invoke
+// altogether.  The tag of the request is assigned by invoke; it can
+// be read with req.MessageTag() after invoke returns.  The fid of the
+// request can be found with MessageFID.
+//
+// Interceptors are called concurrently for concurrent RPCs.
+type Interceptor func(ctx context.Context, req Message, invoke Invoker) (Message, error)
+
+// chainInterceptors returns an invoker which calls the interceptors
+// in order, with the first one outermost, and then invoke.
+func chainInterceptors(invoke Invoker, interceptors []Interceptor) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		intercept, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, req Message) (Message, error) {
+			return intercept(ctx, req, next)
+		}
+	}
+	return invoke
+}
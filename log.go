@@ -0,0 +1,43 @@
+package ninep
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// messageAttrs returns the log attributes describing a message.
+// fid is the fid of the request which the message belongs to.
+func messageAttrs(m Message, fid uint32, hasFID bool) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("type", m.Type().String()),
+		slog.Int("tag", int(m.MessageTag())),
+	}
+	if hasFID {
+		attrs = append(attrs, slog.Uint64("fid", uint64(fid)))
+	}
+	if e, ok := m.(*Rerror); ok {
+		attrs = append(attrs, slog.String("ename", e.Ename))
+	}
+	return attrs
+}
+
+// logRequest logs a T-message at debug level.
+func logRequest(ctx context.Context, logger *slog.Logger, req Message) {
+	if logger == nil || !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	fid, ok := MessageFID(req)
+	logger.LogAttrs(ctx, slog.LevelDebug, "9p request", messageAttrs(req, fid, ok)...)
+}
+
+// logReply logs the R-message resp to the request req at debug level,
+// together with the time it took the server to reply.
+func logReply(ctx context.Context, logger *slog.Logger, req, resp Message, latency time.Duration) {
+	if logger == nil || !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	fid, ok := MessageFID(req)
+	attrs := append(messageAttrs(resp, fid, ok), slog.Duration("latency", latency))
+	logger.LogAttrs(ctx, slog.LevelDebug, "9p reply", attrs...)
+}
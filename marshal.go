@@ -0,0 +1,106 @@
+package ninep
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Message is a 9P message, either a T-message (request) or an
+// R-message (response).
+//
+// The message types are the pointers to the message structs in this
+// package, e.g. *Tversion or *Rwalk.
+type Message interface {
+	// Type returns the message type.
+	Type() MsgType
+	// MessageTag returns the tag of the message.
+	MessageTag() uint16
+
+	// setTag sets the tag of the message.
+	setTag(tag uint16)
+	// encode writes the full message including the header.
+	encode(w io.Writer) error
+	// decode reads the message fields following the header.
+	decode(tag uint16, r io.Reader) error
+}
+
+var errTrailingBytes = errors.New("message has trailing bytes")
+
+// Marshal returns the wire representation of m.
+func Marshal(m Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := m.encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal parses a single message from its wire representation.
+// b must hold exactly one message.
+func Unmarshal(b []byte) (Message, error) {
+	r := bytes.NewReader(b)
+	m, err := ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, errTrailingBytes
+	}
+	return m, nil
+}
+
+// WriteMessage writes the wire representation of m to w,
+// using a single call to w.Write.
+func WriteMessage(w io.Writer, m Message) error {
+	buf, err := Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// MaxMsize is the largest message size accepted by ReadMessage.
+const MaxMsize = 1 << 20
+
+// ReadMessage reads the next message from r.
+//
+// The concrete type of the returned message is determined by the
+// message type in the message header.  Messages larger than MaxMsize
+// are rejected.
+func ReadMessage(r io.Reader) (Message, error) {
+	return readMessage(r, MaxMsize)
+}
+
+// readMessage reads the next message from r,
+// rejecting messages larger than msize.
+func readMessage(r io.Reader, msize uint32) (Message, error) {
+	hdr, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := hdr.check(msize); err != nil {
+		return nil, err
+	}
+	m := newMessage(MsgType(hdr.msgType))
+	if m == nil {
+		return nil, fmt.Errorf("unknown message type %d", hdr.msgType)
+	}
+	lr := &io.LimitedReader{R: r, N: int64(hdr.size - 7)}
+	if err := m.decode(hdr.tag, lr); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%v: %w", MsgType(hdr.msgType), err)
+	}
+	if lr.N > 0 {
+		// Skip the rest, so that the next message can be read.
+		if err := skip(lr, int(lr.N)); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%v: %w", MsgType(hdr.msgType), errTrailingBytes)
+	}
+	return m, nil
+}
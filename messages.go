@@ -0,0 +1,1465 @@
+package ninep
+
+import "io"
+
+// Tauth is the 9P message
+//
+//	size[4] Tauth tag[2] afid[4] uname[s] aname[s]
+//
+// 9P2000.u appends
+//
+//	n_uname[4]
+type Tauth struct {
+	Tag   uint16
+	AFID  uint32
+	Uname string
+	Aname string
+
+	// 9P2000.u fields, present if DotU is set
+	NUname uint32
+	DotU   bool
+}
+
+func (m *Tauth) Type() MsgType { return MsgTauth }
+
+func (m *Tauth) MessageTag() uint16 { return m.Tag }
+
+func (m *Tauth) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Tauth) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + (2 + len(m.Uname)) + (2 + len(m.Aname)))
+	if m.DotU {
+		size += uint32(4)
+	}
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTauth)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.AFID); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Uname); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Aname); err != nil {
+		return err
+	}
+	if m.DotU {
+		if err := writeUint32(w, m.NUname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Tauth) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.AFID); err != nil {
+		return err
+	}
+	if err := readString(r, &m.Uname); err != nil {
+		return err
+	}
+	if err := readString(r, &m.Aname); err != nil {
+		return err
+	}
+	if remaining(r) > 0 {
+		m.DotU = true
+		if err := readUint32(r, &m.NUname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rauth is the 9P message
+//
+//	size[4] Rauth tag[2] aqid[13]
+type Rauth struct {
+	Tag  uint16
+	AQID QID
+}
+
+func (m *Rauth) Type() MsgType { return MsgRauth }
+
+func (m *Rauth) MessageTag() uint16 { return m.Tag }
+
+func (m *Rauth) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rauth) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 13)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRauth)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeQID(w, m.AQID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rauth) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readQID(r, &m.AQID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Tattach is the 9P message
+//
+//	size[4] Tattach tag[2] fid[4] afid[4] uname[s] aname[s]
+//
+// 9P2000.u appends
+//
+//	n_uname[4]
+type Tattach struct {
+	Tag   uint16
+	FID   uint32
+	AFID  uint32
+	Uname string
+	Aname string
+
+	// 9P2000.u fields, present if DotU is set
+	NUname uint32
+	DotU   bool
+}
+
+func (m *Tattach) Type() MsgType { return MsgTattach }
+
+func (m *Tattach) MessageTag() uint16 { return m.Tag }
+
+func (m *Tattach) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Tattach) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + 4 + (2 + len(m.Uname)) + (2 + len(m.Aname)))
+	if m.DotU {
+		size += uint32(4)
+	}
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTattach)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.AFID); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Uname); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Aname); err != nil {
+		return err
+	}
+	if m.DotU {
+		if err := writeUint32(w, m.NUname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Tattach) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	if err := readUint32(r, &m.AFID); err != nil {
+		return err
+	}
+	if err := readString(r, &m.Uname); err != nil {
+		return err
+	}
+	if err := readString(r, &m.Aname); err != nil {
+		return err
+	}
+	if remaining(r) > 0 {
+		m.DotU = true
+		if err := readUint32(r, &m.NUname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rattach is the 9P message
+//
+//	size[4] Rattach tag[2] qid[13]
+type Rattach struct {
+	Tag uint16
+	QID QID
+}
+
+func (m *Rattach) Type() MsgType { return MsgRattach }
+
+func (m *Rattach) MessageTag() uint16 { return m.Tag }
+
+func (m *Rattach) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rattach) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 13)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRattach)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeQID(w, m.QID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rattach) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readQID(r, &m.QID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Tclunk is the 9P message
+//
+//	size[4] Tclunk tag[2] fid[4]
+type Tclunk struct {
+	Tag uint16
+	FID uint32
+}
+
+func (m *Tclunk) Type() MsgType { return MsgTclunk }
+
+func (m *Tclunk) MessageTag() uint16 { return m.Tag }
+
+func (m *Tclunk) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Tclunk) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTclunk)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Tclunk) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rclunk is the 9P message
+//
+//	size[4] Rclunk tag[2]
+type Rclunk struct {
+	Tag uint16
+}
+
+func (m *Rclunk) Type() MsgType { return MsgRclunk }
+
+func (m *Rclunk) MessageTag() uint16 { return m.Tag }
+
+func (m *Rclunk) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rclunk) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRclunk)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rclunk) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	return nil
+}
+
+// Rerror is the 9P message
+//
+//	size[4] Rerror tag[2] ename[s]
+//
+// 9P2000.u appends
+//
+//	errno[4]
+type Rerror struct {
+	Tag   uint16
+	Ename string
+
+	// 9P2000.u fields, present if DotU is set
+	Errno uint32
+	DotU  bool
+}
+
+func (m *Rerror) Type() MsgType { return MsgRerror }
+
+func (m *Rerror) MessageTag() uint16 { return m.Tag }
+
+func (m *Rerror) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rerror) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + (2 + len(m.Ename)))
+	if m.DotU {
+		size += uint32(4)
+	}
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRerror)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Ename); err != nil {
+		return err
+	}
+	if m.DotU {
+		if err := writeUint32(w, m.Errno); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Rerror) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readString(r, &m.Ename); err != nil {
+		return err
+	}
+	if remaining(r) > 0 {
+		m.DotU = true
+		if err := readUint32(r, &m.Errno); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tflush is the 9P message
+//
+//	size[4] Tflush tag[2] oldtag[2]
+type Tflush struct {
+	Tag    uint16
+	OldTag uint16
+}
+
+func (m *Tflush) Type() MsgType { return MsgTflush }
+
+func (m *Tflush) MessageTag() uint16 { return m.Tag }
+
+func (m *Tflush) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Tflush) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 2)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTflush)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.OldTag); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Tflush) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint16(r, &m.OldTag); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rflush is the 9P message
+//
+//	size[4] Rflush tag[2]
+type Rflush struct {
+	Tag uint16
+}
+
+func (m *Rflush) Type() MsgType { return MsgRflush }
+
+func (m *Rflush) MessageTag() uint16 { return m.Tag }
+
+func (m *Rflush) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rflush) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRflush)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rflush) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	return nil
+}
+
+// Topen is the 9P message
+//
+//	size[4] Topen tag[2] fid[4] mode[1]
+type Topen struct {
+	Tag  uint16
+	FID  uint32
+	Mode uint8
+}
+
+func (m *Topen) Type() MsgType { return MsgTopen }
+
+func (m *Topen) MessageTag() uint16 { return m.Tag }
+
+func (m *Topen) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Topen) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + 1)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTopen)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	if err := writeUint8(w, m.Mode); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Topen) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	if err := readUint8(r, &m.Mode); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Ropen is the 9P message
+//
+//	size[4] Ropen tag[2] qid[13] iounit[4]
+type Ropen struct {
+	Tag    uint16
+	QID    QID
+	IOUnit uint32
+}
+
+func (m *Ropen) Type() MsgType { return MsgRopen }
+
+func (m *Ropen) MessageTag() uint16 { return m.Tag }
+
+func (m *Ropen) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Ropen) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 13 + 4)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRopen)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeQID(w, m.QID); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.IOUnit); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Ropen) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readQID(r, &m.QID); err != nil {
+		return err
+	}
+	if err := readUint32(r, &m.IOUnit); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Tcreate is the 9P message
+//
+//	size[4] Tcreate tag[2] fid[4] name[s] perm[4] mode[1]
+//
+// 9P2000.u appends
+//
+//	extension[s]
+type Tcreate struct {
+	Tag  uint16
+	FID  uint32
+	Name string
+	Perm uint32
+	Mode uint8
+
+	// 9P2000.u fields, present if DotU is set
+	Extension string
+	DotU      bool
+}
+
+func (m *Tcreate) Type() MsgType { return MsgTcreate }
+
+func (m *Tcreate) MessageTag() uint16 { return m.Tag }
+
+func (m *Tcreate) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Tcreate) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + (2 + len(m.Name)) + 4 + 1)
+	if m.DotU {
+		size += uint32((2 + len(m.Extension)))
+	}
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTcreate)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Name); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.Perm); err != nil {
+		return err
+	}
+	if err := writeUint8(w, m.Mode); err != nil {
+		return err
+	}
+	if m.DotU {
+		if err := writeString(w, m.Extension); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Tcreate) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	if err := readString(r, &m.Name); err != nil {
+		return err
+	}
+	if err := readUint32(r, &m.Perm); err != nil {
+		return err
+	}
+	if err := readUint8(r, &m.Mode); err != nil {
+		return err
+	}
+	if remaining(r) > 0 {
+		m.DotU = true
+		if err := readString(r, &m.Extension); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rcreate is the 9P message
+//
+//	size[4] Rcreate tag[2] qid[13] iounit[4]
+type Rcreate struct {
+	Tag    uint16
+	QID    QID
+	IOUnit uint32
+}
+
+func (m *Rcreate) Type() MsgType { return MsgRcreate }
+
+func (m *Rcreate) MessageTag() uint16 { return m.Tag }
+
+func (m *Rcreate) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rcreate) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 13 + 4)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRcreate)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeQID(w, m.QID); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.IOUnit); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rcreate) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readQID(r, &m.QID); err != nil {
+		return err
+	}
+	if err := readUint32(r, &m.IOUnit); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Topenfd is the 9P message
+//
+//	size[4] Topenfd tag[2] fid[4] mode[1]
+type Topenfd struct {
+	Tag  uint16
+	FID  uint32
+	Mode uint8
+}
+
+func (m *Topenfd) Type() MsgType { return MsgTopenfd }
+
+func (m *Topenfd) MessageTag() uint16 { return m.Tag }
+
+func (m *Topenfd) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Topenfd) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + 1)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTopenfd)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	if err := writeUint8(w, m.Mode); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Topenfd) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	if err := readUint8(r, &m.Mode); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Ropenfd is the 9P message
+//
+//	size[4] Ropenfd tag[2] qid[13] iounit[4] unixfd[4]
+type Ropenfd struct {
+	Tag    uint16
+	QID    QID
+	IOUnit uint32
+	UnixFD uint32
+}
+
+func (m *Ropenfd) Type() MsgType { return MsgRopenfd }
+
+func (m *Ropenfd) MessageTag() uint16 { return m.Tag }
+
+func (m *Ropenfd) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Ropenfd) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 13 + 4 + 4)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRopenfd)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeQID(w, m.QID); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.IOUnit); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.UnixFD); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Ropenfd) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readQID(r, &m.QID); err != nil {
+		return err
+	}
+	if err := readUint32(r, &m.IOUnit); err != nil {
+		return err
+	}
+	if err := readUint32(r, &m.UnixFD); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Tread is the 9P message
+//
+//	size[4] Tread tag[2] fid[4] offset[8] count[4]
+type Tread struct {
+	Tag    uint16
+	FID    uint32
+	Offset uint64
+	Count  uint32
+}
+
+func (m *Tread) Type() MsgType { return MsgTread }
+
+func (m *Tread) MessageTag() uint16 { return m.Tag }
+
+func (m *Tread) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Tread) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + 8 + 4)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTread)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	if err := writeUint64(w, m.Offset); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.Count); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Tread) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	if err := readUint64(r, &m.Offset); err != nil {
+		return err
+	}
+	if err := readUint32(r, &m.Count); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rread is the 9P message
+//
+//	size[4] Rread tag[2] data[count[4]]
+type Rread struct {
+	Tag  uint16
+	Data []byte
+}
+
+func (m *Rread) Type() MsgType { return MsgRread }
+
+func (m *Rread) MessageTag() uint16 { return m.Tag }
+
+func (m *Rread) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rread) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + (4 + len(m.Data)))
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRread)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeByteSlice(w, m.Data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rread) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readByteSlice(r, &m.Data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Twrite is the 9P message
+//
+//	size[4] Twrite tag[2] fid[4] offset[8] data[count[4]]
+type Twrite struct {
+	Tag    uint16
+	FID    uint32
+	Offset uint64
+	Data   []byte
+}
+
+func (m *Twrite) Type() MsgType { return MsgTwrite }
+
+func (m *Twrite) MessageTag() uint16 { return m.Tag }
+
+func (m *Twrite) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Twrite) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + 8 + (4 + len(m.Data)))
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTwrite)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	if err := writeUint64(w, m.Offset); err != nil {
+		return err
+	}
+	if err := writeByteSlice(w, m.Data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Twrite) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	if err := readUint64(r, &m.Offset); err != nil {
+		return err
+	}
+	if err := readByteSlice(r, &m.Data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rwrite is the 9P message
+//
+//	size[4] Rwrite tag[2] count[4]
+type Rwrite struct {
+	Tag   uint16
+	Count uint32
+}
+
+func (m *Rwrite) Type() MsgType { return MsgRwrite }
+
+func (m *Rwrite) MessageTag() uint16 { return m.Tag }
+
+func (m *Rwrite) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rwrite) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRwrite)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.Count); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rwrite) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.Count); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Tremove is the 9P message
+//
+//	size[4] Tremove tag[2] fid[4]
+type Tremove struct {
+	Tag uint16
+	FID uint32
+}
+
+func (m *Tremove) Type() MsgType { return MsgTremove }
+
+func (m *Tremove) MessageTag() uint16 { return m.Tag }
+
+func (m *Tremove) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Tremove) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTremove)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Tremove) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rremove is the 9P message
+//
+//	size[4] Rremove tag[2]
+type Rremove struct {
+	Tag uint16
+}
+
+func (m *Rremove) Type() MsgType { return MsgRremove }
+
+func (m *Rremove) MessageTag() uint16 { return m.Tag }
+
+func (m *Rremove) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rremove) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRremove)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rremove) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	return nil
+}
+
+// Tstat is the 9P message
+//
+//	size[4] Tstat tag[2] fid[4]
+type Tstat struct {
+	Tag uint16
+	FID uint32
+}
+
+func (m *Tstat) Type() MsgType { return MsgTstat }
+
+func (m *Tstat) MessageTag() uint16 { return m.Tag }
+
+func (m *Tstat) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Tstat) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTstat)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Tstat) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rstat is the 9P message
+//
+//	size[4] Rstat tag[2] stat[n]
+type Rstat struct {
+	Tag  uint16
+	Stat Stat
+}
+
+func (m *Rstat) Type() MsgType { return MsgRstat }
+
+func (m *Rstat) MessageTag() uint16 { return m.Tag }
+
+func (m *Rstat) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rstat) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + (2 + 2 + int(statSize(m.Stat))))
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRstat)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint16(w, 2+statSize(m.Stat)); err != nil {
+		return err
+	}
+	if err := writeStat(w, m.Stat); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rstat) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	var outerStatSize uint16
+	if err := readUint16(r, &outerStatSize); err != nil {
+		return err
+	}
+	if err := readStat(r, &m.Stat); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Twstat is the 9P message
+//
+//	size[4] Twstat tag[2] fid[4] stat[n]
+type Twstat struct {
+	Tag  uint16
+	FID  uint32
+	Stat Stat
+}
+
+func (m *Twstat) Type() MsgType { return MsgTwstat }
+
+func (m *Twstat) MessageTag() uint16 { return m.Tag }
+
+func (m *Twstat) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Twstat) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + (2 + 2 + int(statSize(m.Stat))))
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTwstat)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	if err := writeUint16(w, 2+statSize(m.Stat)); err != nil {
+		return err
+	}
+	if err := writeStat(w, m.Stat); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Twstat) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	var outerStatSize uint16
+	if err := readUint16(r, &outerStatSize); err != nil {
+		return err
+	}
+	if err := readStat(r, &m.Stat); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rwstat is the 9P message
+//
+//	size[4] Rwstat tag[2]
+type Rwstat struct {
+	Tag uint16
+}
+
+func (m *Rwstat) Type() MsgType { return MsgRwstat }
+
+func (m *Rwstat) MessageTag() uint16 { return m.Tag }
+
+func (m *Rwstat) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rwstat) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2)
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRwstat)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rwstat) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	return nil
+}
+
+// Tversion is the 9P message
+//
+//	size[4] Tversion tag[2] msize[4] version[s]
+type Tversion struct {
+	Tag     uint16
+	Msize   uint32
+	Version string
+}
+
+func (m *Tversion) Type() MsgType { return MsgTversion }
+
+func (m *Tversion) MessageTag() uint16 { return m.Tag }
+
+func (m *Tversion) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Tversion) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + (2 + len(m.Version)))
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTversion)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.Msize); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Version); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Tversion) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.Msize); err != nil {
+		return err
+	}
+	if err := readString(r, &m.Version); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rversion is the 9P message
+//
+//	size[4] Rversion tag[2] msize[4] version[s]
+type Rversion struct {
+	Tag     uint16
+	Msize   uint32
+	Version string
+}
+
+func (m *Rversion) Type() MsgType { return MsgRversion }
+
+func (m *Rversion) MessageTag() uint16 { return m.Tag }
+
+func (m *Rversion) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rversion) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + (2 + len(m.Version)))
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRversion)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.Msize); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Version); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rversion) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.Msize); err != nil {
+		return err
+	}
+	if err := readString(r, &m.Version); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Twalk is the 9P message
+//
+//	size[4] Twalk tag[2] fid[4] newfid[4] nwname*(wname[s])
+type Twalk struct {
+	Tag    uint16
+	FID    uint32
+	NewFID uint32
+	Wnames []string
+}
+
+func (m *Twalk) Type() MsgType { return MsgTwalk }
+
+func (m *Twalk) MessageTag() uint16 { return m.Tag }
+
+func (m *Twalk) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Twalk) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + 4 + 4 + stringSliceSize(m.Wnames))
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgTwalk)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.FID); err != nil {
+		return err
+	}
+	if err := writeUint32(w, m.NewFID); err != nil {
+		return err
+	}
+	if err := writeStringSlice(w, m.Wnames); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Twalk) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readUint32(r, &m.FID); err != nil {
+		return err
+	}
+	if err := readUint32(r, &m.NewFID); err != nil {
+		return err
+	}
+	if err := readStringSlice(r, &m.Wnames); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rwalk is the 9P message
+//
+//	size[4] Rwalk tag[2] nwqid*(qid[13])
+type Rwalk struct {
+	Tag  uint16
+	QIDs []QID
+}
+
+func (m *Rwalk) Type() MsgType { return MsgRwalk }
+
+func (m *Rwalk) MessageTag() uint16 { return m.Tag }
+
+func (m *Rwalk) setTag(tag uint16) { m.Tag = tag }
+
+func (m *Rwalk) encode(w io.Writer) error {
+	size := uint32(4 + 1 + 2 + (2 + 13*len(m.QIDs)))
+	if err := writeUint32(w, size); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(MsgRwalk)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, m.Tag); err != nil {
+		return err
+	}
+	if err := writeQIDSlice(w, m.QIDs); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Rwalk) decode(tag uint16, r io.Reader) error {
+	m.Tag = tag
+	if err := readQIDSlice(r, &m.QIDs); err != nil {
+		return err
+	}
+	return nil
+}
+
+// newMessage returns a new message for the given type,
+// or nil if the type is unknown.
+func newMessage(t MsgType) Message {
+	switch t {
+	case MsgTauth:
+		return &Tauth{}
+	case MsgRauth:
+		return &Rauth{}
+	case MsgTattach:
+		return &Tattach{}
+	case MsgRattach:
+		return &Rattach{}
+	case MsgTclunk:
+		return &Tclunk{}
+	case MsgRclunk:
+		return &Rclunk{}
+	case MsgRerror:
+		return &Rerror{}
+	case MsgTflush:
+		return &Tflush{}
+	case MsgRflush:
+		return &Rflush{}
+	case MsgTopen:
+		return &Topen{}
+	case MsgRopen:
+		return &Ropen{}
+	case MsgTcreate:
+		return &Tcreate{}
+	case MsgRcreate:
+		return &Rcreate{}
+	case MsgTopenfd:
+		return &Topenfd{}
+	case MsgRopenfd:
+		return &Ropenfd{}
+	case MsgTread:
+		return &Tread{}
+	case MsgRread:
+		return &Rread{}
+	case MsgTwrite:
+		return &Twrite{}
+	case MsgRwrite:
+		return &Rwrite{}
+	case MsgTremove:
+		return &Tremove{}
+	case MsgRremove:
+		return &Rremove{}
+	case MsgTstat:
+		return &Tstat{}
+	case MsgRstat:
+		return &Rstat{}
+	case MsgTwstat:
+		return &Twstat{}
+	case MsgRwstat:
+		return &Rwstat{}
+	case MsgTversion:
+		return &Tversion{}
+	case MsgRversion:
+		return &Rversion{}
+	case MsgTwalk:
+		return &Twalk{}
+	case MsgRwalk:
+		return &Rwalk{}
+	}
+	return nil
+}
+
+// MessageFID returns the fid which the message refers to,
+// or false if the message does not refer to a fid.
+func MessageFID(m Message) (fid uint32, ok bool) {
+	switch m := m.(type) {
+	case *Tattach:
+		return m.FID, true
+	case *Tclunk:
+		return m.FID, true
+	case *Topen:
+		return m.FID, true
+	case *Tcreate:
+		return m.FID, true
+	case *Topenfd:
+		return m.FID, true
+	case *Tread:
+		return m.FID, true
+	case *Twrite:
+		return m.FID, true
+	case *Tremove:
+		return m.FID, true
+	case *Tstat:
+		return m.FID, true
+	case *Twstat:
+		return m.FID, true
+	case *Twalk:
+		return m.FID, true
+	}
+	return 0, false
+}
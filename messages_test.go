@@ -0,0 +1,121 @@
+package ninep
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("bad golden value %q: %v", s, err)
+	}
+	return b
+}
+
+var goldenMessages = []struct {
+	msg  Message
+	wire string
+}{
+	{&Tauth{Tag: 0x0a0b, AFID: 0x05060708, Uname: "glenda", Aname: ""}, "15000000 66 0b0a 08070605 0600 676c656e6461 0000"},
+	{&Tauth{Tag: 0x0a0b, AFID: 0x05060708, Uname: "glenda", Aname: "", NUname: 1000, DotU: true}, "19000000 66 0b0a 08070605 0600 676c656e6461 0000 e8030000"},
+	{&Rauth{Tag: 0x0a0b, AQID: QID{Kind: QTAUTH, Vers: 0, Path: 0x99}}, "14000000 67 0b0a 08 00000000 9900000000000000"},
+	{&Tattach{Tag: 0x0a0b, FID: 0x01020304, AFID: 0x05060708, Uname: "glenda", Aname: ""}, "19000000 68 0b0a 04030201 08070605 0600 676c656e6461 0000"},
+	{&Tattach{Tag: 0x0a0b, FID: 0x01020304, AFID: 0x05060708, Uname: "glenda", Aname: "", NUname: 1000, DotU: true}, "1d000000 68 0b0a 04030201 08070605 0600 676c656e6461 0000 e8030000"},
+	{&Rattach{Tag: 0x0a0b, QID: QID{Kind: QTDIR, Vers: 0x01020304, Path: 0x1122334455667788}}, "14000000 69 0b0a 80 04030201 8877665544332211"},
+	{&Tclunk{Tag: 0x0a0b, FID: 0x01020304}, "0b000000 78 0b0a 04030201"},
+	{&Rclunk{Tag: 0x0a0b}, "07000000 79 0b0a"},
+	{&Rerror{Tag: 0x0a0b, Ename: "permission denied"}, "1a000000 6b 0b0a 1100 7065726d697373696f6e2064656e696564"},
+	{&Rerror{Tag: 0x0a0b, Ename: "permission denied", Errno: 13, DotU: true}, "1e000000 6b 0b0a 1100 7065726d697373696f6e2064656e696564 0d000000"},
+	{&Tflush{Tag: 0x0a0b, OldTag: 0x0c0d}, "09000000 6c 0b0a 0d0c"},
+	{&Rflush{Tag: 0x0a0b}, "07000000 6d 0b0a"},
+	{&Topen{Tag: 0x0a0b, FID: 0x01020304, Mode: 0x11}, "0c000000 70 0b0a 04030201 11"},
+	{&Ropen{Tag: 0x0a0b, QID: QID{Kind: QTDIR, Vers: 0x01020304, Path: 0x1122334455667788}, IOUnit: 0x2000}, "18000000 71 0b0a 80 04030201 8877665544332211 00200000"},
+	{&Tcreate{Tag: 0x0a0b, FID: 0x01020304, Name: "lib", Perm: 0x800001ed, Mode: 0x11}, "15000000 72 0b0a 04030201 0300 6c6962 ed010080 11"},
+	{&Tcreate{Tag: 0x0a0b, FID: 0x01020304, Name: "lib", Perm: 0x800001ed, Mode: 0x11, Extension: "b 1 2", DotU: true}, "1c000000 72 0b0a 04030201 0300 6c6962 ed010080 11 0500 6220312032"},
+	{&Rcreate{Tag: 0x0a0b, QID: QID{Kind: QTDIR, Vers: 0x01020304, Path: 0x1122334455667788}, IOUnit: 0x2000}, "18000000 73 0b0a 80 04030201 8877665544332211 00200000"},
+	{&Topenfd{Tag: 0x0a0b, FID: 0x01020304, Mode: 0x11}, "0c000000 62 0b0a 04030201 11"},
+	{&Ropenfd{Tag: 0x0a0b, QID: QID{Kind: QTDIR, Vers: 0x01020304, Path: 0x1122334455667788}, IOUnit: 0x2000, UnixFD: 3}, "1c000000 63 0b0a 80 04030201 8877665544332211 00200000 03000000"},
+	{&Tread{Tag: 0x0a0b, FID: 0x01020304, Offset: 0x0102030405060708, Count: 0x0100}, "17000000 74 0b0a 04030201 0807060504030201 00010000"},
+	{&Rread{Tag: 0x0a0b, Data: []byte("hello")}, "10000000 75 0b0a 05000000 68656c6c6f"},
+	{&Twrite{Tag: 0x0a0b, FID: 0x01020304, Offset: 0x0102030405060708, Data: []byte("hello")}, "1c000000 76 0b0a 04030201 0807060504030201 05000000 68656c6c6f"},
+	{&Rwrite{Tag: 0x0a0b, Count: 0x0100}, "0b000000 77 0b0a 00010000"},
+	{&Tremove{Tag: 0x0a0b, FID: 0x01020304}, "0b000000 7a 0b0a 04030201"},
+	{&Rremove{Tag: 0x0a0b}, "07000000 7b 0b0a"},
+	{&Tstat{Tag: 0x0a0b, FID: 0x01020304}, "0b000000 7c 0b0a 04030201"},
+	{&Rstat{Tag: 0x0a0b, Stat: Stat{Type: 0x0102, Dev: 0x03040506, QID: QID{Kind: QTDIR, Vers: 7, Path: 0x1122334455667788}, Mode: 0x800001ed, Atime: 0x5f5e1000, Mtime: 0x5f5e2000, Name: "lib", UID: "glenda", GID: "sys", MUID: "glenda"}}, "4c000000 7d 0b0a 4300 4100 0201 06050403 80 07000000 8877665544332211 ed010080 00105e5f 00205e5f 0000000000000000 0300 6c6962 0600 676c656e6461 0300 737973 0600 676c656e6461"},
+	{&Rstat{Tag: 0x0a0b, Stat: Stat{Type: 0x0102, Dev: 0x03040506, QID: QID{Kind: QTDIR, Vers: 7, Path: 0x1122334455667788}, Mode: 0x800001ed, Atime: 0x5f5e1000, Mtime: 0x5f5e2000, Name: "lib", UID: "glenda", GID: "sys", MUID: "glenda", NUID: 1000, NGID: 1001, NMUID: 1000, DotU: true}}, "5a000000 7d 0b0a 5100 4f00 0201 06050403 80 07000000 8877665544332211 ed010080 00105e5f 00205e5f 0000000000000000 0300 6c6962 0600 676c656e6461 0300 737973 0600 676c656e6461 0000 e8030000 e9030000 e8030000"},
+	{&Twstat{Tag: 0x0a0b, FID: 0x01020304, Stat: Stat{Type: 0x0102, Dev: 0x03040506, QID: QID{Kind: QTDIR, Vers: 7, Path: 0x1122334455667788}, Mode: 0x800001ed, Atime: 0x5f5e1000, Mtime: 0x5f5e2000, Name: "lib", UID: "glenda", GID: "sys", MUID: "glenda"}}, "50000000 7e 0b0a 04030201 4300 4100 0201 06050403 80 07000000 8877665544332211 ed010080 00105e5f 00205e5f 0000000000000000 0300 6c6962 0600 676c656e6461 0300 737973 0600 676c656e6461"},
+	{&Twstat{Tag: 0x0a0b, FID: 0x01020304, Stat: Stat{Type: 0x0102, Dev: 0x03040506, QID: QID{Kind: QTDIR, Vers: 7, Path: 0x1122334455667788}, Mode: 0x800001ed, Atime: 0x5f5e1000, Mtime: 0x5f5e2000, Name: "lib", UID: "glenda", GID: "sys", MUID: "glenda", NUID: 1000, NGID: 1001, NMUID: 1000, DotU: true}}, "5e000000 7e 0b0a 04030201 5100 4f00 0201 06050403 80 07000000 8877665544332211 ed010080 00105e5f 00205e5f 0000000000000000 0300 6c6962 0600 676c656e6461 0300 737973 0600 676c656e6461 0000 e8030000 e9030000 e8030000"},
+	{&Rwstat{Tag: 0x0a0b}, "07000000 7f 0b0a"},
+	{&Tversion{Tag: 0x0a0b, Msize: 8192, Version: "9P2000"}, "13000000 64 0b0a 00200000 0600 395032303030"},
+	{&Rversion{Tag: 0x0a0b, Msize: 8192, Version: "9P2000"}, "13000000 65 0b0a 00200000 0600 395032303030"},
+	{&Twalk{Tag: 0x0a0b, FID: 0x01020304, NewFID: 0x090a0b0c, Wnames: []string{"lib", "font"}}, "1c000000 6e 0b0a 04030201 0c0b0a09 0200 0300 6c6962 0400 666f6e74"},
+	{&Rwalk{Tag: 0x0a0b, QIDs: []QID{{Kind: QTDIR, Vers: 1, Path: 2}, {Kind: QTFILE, Vers: 3, Path: 4}}}, "23000000 6f 0b0a 0200 80 01000000 0200000000000000 00 03000000 0400000000000000"},
+	{&Tversion{Tag: notag, Msize: 8192, Version: "9P2000"}, "13000000 64 ffff 00200000 0600 395032303030"},
+	{&Twalk{Tag: 1, FID: 2, NewFID: 2, Wnames: []string{}}, "11000000 6e 0100 02000000 02000000 0000"},
+	{&Rwalk{Tag: 1, QIDs: []QID{}}, "09000000 6f 0100 0000"},
+	{&Rread{Tag: 1, Data: []byte{}}, "0b000000 75 0100 00000000"},
+}
+
+func TestMarshalGolden(t *testing.T) {
+	for _, tc := range goldenMessages {
+		got, err := Marshal(tc.msg)
+		if err != nil {
+			t.Errorf("Marshal(%#v): %v", tc.msg, err)
+			continue
+		}
+		if want := unhex(t, tc.wire); !bytes.Equal(got, want) {
+			t.Errorf("Marshal(%#v) = %x, want %x", tc.msg, got, want)
+		}
+	}
+}
+
+func TestUnmarshalGolden(t *testing.T) {
+	for _, tc := range goldenMessages {
+		got, err := Unmarshal(unhex(t, tc.wire))
+		if err != nil {
+			t.Errorf("Unmarshal(%q): %v", tc.wire, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.msg) {
+			t.Errorf("Unmarshal(%q) = %#v, want %#v", tc.wire, got, tc.msg)
+		}
+	}
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	for _, tc := range goldenMessages {
+		wire := unhex(t, tc.wire)
+		for n := 0; n < len(wire); n++ {
+			if _, err := Unmarshal(wire[:n]); err == nil {
+				t.Errorf("Unmarshal(%x) succeeded for truncated %v", wire[:n], tc.msg.Type())
+			}
+		}
+	}
+}
+
+func TestReadMessageStream(t *testing.T) {
+	var stream bytes.Buffer
+	for _, tc := range goldenMessages {
+		stream.Write(unhex(t, tc.wire))
+	}
+	for _, tc := range goldenMessages {
+		got, err := ReadMessage(&stream)
+		if err != nil {
+			t.Fatalf("ReadMessage() for %v: %v", tc.msg.Type(), err)
+		}
+		if !reflect.DeepEqual(got, tc.msg) {
+			t.Errorf("ReadMessage() = %#v, want %#v", got, tc.msg)
+		}
+	}
+	if _, err := ReadMessage(&stream); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadMessage() at end of stream: got err %v, want %v", err, io.EOF)
+	}
+}
@@ -1,6 +1,7 @@
 package ninep
 
 import (
+	"io/fs"
 	"strings"
 )
 
@@ -20,8 +21,97 @@ const (
 	ModeSymlink   = 0x00400000
 	ModeNamedPipe = 0x00200000
 	ModeSocket    = 0x00100000
+	ModeSetuid    = 0x00080000
+	ModeSetgid    = 0x00040000
+	ModeSticky    = 0x00010000
 )
 
+// Correspondence between 9p mode flags and io/fs mode bits.
+var modeBits = []struct {
+	mode     uint32
+	fileMode fs.FileMode
+}{
+	{ModeDir, fs.ModeDir},
+	{ModeAppend, fs.ModeAppend},
+	{ModeExcl, fs.ModeExclusive},
+	{ModeTmp, fs.ModeTemporary},
+	{ModeSymlink, fs.ModeSymlink},
+	{ModeUnixDev, fs.ModeDevice},
+	{ModeNamedPipe, fs.ModeNamedPipe},
+	{ModeSocket, fs.ModeSocket},
+	{ModeSetuid, fs.ModeSetuid},
+	{ModeSetgid, fs.ModeSetgid},
+	{ModeSticky, fs.ModeSticky},
+}
+
+// FileMode converts a 9p mode, as in Stat.Mode, to a fs.FileMode.
+//
+// Mounted channels and authentication files have no equivalent in
+// io/fs and are reported as fs.ModeIrregular.
+func FileMode(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode & 0777)
+	for _, b := range modeBits {
+		if mode&b.mode != 0 {
+			m |= b.fileMode
+		}
+	}
+	if mode&(ModeMount|ModeAuth) != 0 {
+		m |= fs.ModeIrregular
+	}
+	return m
+}
+
+// Mode converts a fs.FileMode to a 9p mode, as in Stat.Mode.
+// Mode bits without 9p equivalent are dropped.
+func Mode(m fs.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	for _, b := range modeBits {
+		if m&b.fileMode != 0 {
+			mode |= b.mode
+		}
+	}
+	return mode
+}
+
+// Correspondence between QID type bits and io/fs mode bits.
+var qidTypeBits = []struct {
+	kind     uint8
+	fileMode fs.FileMode
+}{
+	{QTDIR, fs.ModeDir},
+	{QTAPPEND, fs.ModeAppend},
+	{QTEXCL, fs.ModeExclusive},
+	{QTTMP, fs.ModeTemporary},
+	{QTSYMLINK, fs.ModeSymlink},
+}
+
+// QIDFileMode converts a QID type, as in QID.Kind, to the type bits
+// of a fs.FileMode.
+func QIDFileMode(kind uint8) fs.FileMode {
+	var m fs.FileMode
+	for _, b := range qidTypeBits {
+		if kind&b.kind != 0 {
+			m |= b.fileMode
+		}
+	}
+	if kind&(QTMOUNT|QTAUTH) != 0 {
+		m |= fs.ModeIrregular
+	}
+	return m
+}
+
+// QIDType converts the type bits of a fs.FileMode to a QID type,
+// as in QID.Kind.
+func QIDType(m fs.FileMode) uint8 {
+	var kind uint8
+	for _, b := range qidTypeBits {
+		if m&b.fileMode != 0 {
+			kind |= b.kind
+		}
+	}
+	return kind
+}
+
 // The read, write and execute bits are stored in the three least
 // significant octets of Stat.Mode, for user, group and others.
 const (
@@ -1,6 +1,9 @@
 package ninep
 
-import "testing"
+import (
+	"io/fs"
+	"testing"
+)
 
 func TestModeStringSimple(t *testing.T) {
 	want := "-rwxr-xr-x"
@@ -30,3 +33,54 @@ func TestModeString(t *testing.T) {
 		}
 	}
 }
+
+func TestFileMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode uint32
+		want fs.FileMode
+	}{
+		{0644, 0644},
+		{ModeDir | 0755, fs.ModeDir | 0755},
+		{ModeAppend | 0600, fs.ModeAppend | 0600},
+		{ModeExcl | 0600, fs.ModeExclusive | 0600},
+		{ModeTmp | 0600, fs.ModeTemporary | 0600},
+		{ModeAuth | 0600, fs.ModeIrregular | 0600},
+		{ModeSymlink | 0777, fs.ModeSymlink | 0777},
+		{ModeUnixDev | 0660, fs.ModeDevice | 0660},
+		{ModeNamedPipe | 0600, fs.ModeNamedPipe | 0600},
+		{ModeSocket | 0755, fs.ModeSocket | 0755},
+		{ModeSetuid | ModeSetgid | ModeSticky | 0755, fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky | 0755},
+	} {
+		got := FileMode(tc.mode)
+		if got != tc.want {
+			t.Errorf("FileMode(%#x) = %v, want %v", tc.mode, got, tc.want)
+		}
+		if tc.mode&ModeAuth != 0 {
+			continue
+		}
+		if back := Mode(got); back != tc.mode {
+			t.Errorf("Mode(FileMode(%#x)) = %#x", tc.mode, back)
+		}
+	}
+}
+
+func TestQIDFileMode(t *testing.T) {
+	for _, tc := range []struct {
+		kind uint8
+		want fs.FileMode
+	}{
+		{QTFILE, 0},
+		{QTDIR, fs.ModeDir},
+		{QTAPPEND | QTEXCL, fs.ModeAppend | fs.ModeExclusive},
+		{QTTMP, fs.ModeTemporary},
+		{QTSYMLINK, fs.ModeSymlink},
+	} {
+		got := QIDFileMode(tc.kind)
+		if got != tc.want {
+			t.Errorf("QIDFileMode(%#x) = %v, want %v", tc.kind, got, tc.want)
+		}
+		if back := QIDType(got); back != tc.kind {
+			t.Errorf("QIDType(QIDFileMode(%#x)) = %#x", tc.kind, back)
+		}
+	}
+}
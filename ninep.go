@@ -1,5 +1,10 @@
 // Package ninep implements the 9P protocol.
+//
+// The package speaks 9P2000 and 9P2000.u, not 9P2000.L.  File times
+// are therefore whole seconds, and only the access and modification
+// times are known; there is no change or birth time, and Stat.ModTime
+// and Stat.AccessTime have no sub-second part.
 package ninep
 
-//go:generate go run cmd/generate/main.go -o writeT.go -prefix=writeT
-//go:generate go run cmd/generate/main.go -o readR.go -prefix=readR
+//go:generate go run ./cmd/generate -o messages.go
+//go:generate go run ./cmd/generate -o messages_test.go -tests
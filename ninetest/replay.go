@@ -0,0 +1,172 @@
+package ninetest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/gnoack/ninep"
+)
+
+// Replay is a 9P server which answers requests from a recorded trace,
+// as written by a client with ninep.DialOpts.Trace set.
+//
+// Each incoming request is matched to the first recorded request with
+// the same contents, apart from the tag, which was not used yet.  It
+// is answered with the reply recorded for that request, or not at all
+// if the recorded request was flushed before it was answered.  A
+// Tflush is matched by the position in the trace of the request it
+// flushes, instead of its oldtag.  Requests that do not appear in the
+// trace are answered with an Rerror, except for Tflush, which must
+// always succeed and is answered with an Rflush.  Requests are
+// answered in the order they arrive.
+type Replay struct {
+	exchanges []exchange
+}
+
+// exchange is a recorded request and its reply.
+type exchange struct {
+	req     []byte // Tag and oldtag set to zero
+	flushes int    // For a Tflush, the index of the flushed request, or -1
+	resp    []byte // nil if the request was never answered
+}
+
+// normalize returns the request msg with its tag, and the oldtag of a
+// Tflush, set to zero, and the index of the request flushed by a
+// Tflush or -1.  last maps tags to the index of the last request sent
+// with them.
+func normalize(msg []byte, last map[uint16]int) ([]byte, int) {
+	req := withTag(msg, 0)
+	flushes := -1
+	if ninep.MsgType(msg[4]) == ninep.MsgTflush && len(msg) == 9 {
+		if i, ok := last[binary.LittleEndian.Uint16(msg[7:9])]; ok {
+			flushes = i
+		}
+		binary.LittleEndian.PutUint16(req[7:9], 0)
+	}
+	return req, flushes
+}
+
+// NewReplay reads a trace and returns a server replaying it.
+func NewReplay(tr *ninep.TraceReader) (*Replay, error) {
+	var exchanges []exchange
+	pending := make(map[uint16]int) // Tag to index in exchanges
+	last := make(map[uint16]int)    // Tag to index of its last request
+	for {
+		rec, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec.Data) < 7 {
+			return nil, errors.New("trace record too short for a message")
+		}
+		tag := binary.LittleEndian.Uint16(rec.Data[5:7])
+		switch rec.Dir {
+		case ninep.TraceSent:
+			req, flushes := normalize(rec.Data, last)
+			pending[tag] = len(exchanges)
+			last[tag] = len(exchanges)
+			exchanges = append(exchanges, exchange{req: req, flushes: flushes})
+		case ninep.TraceReceived:
+			i, ok := pending[tag]
+			if !ok {
+				continue // Late reply to a flushed request.
+			}
+			delete(pending, tag)
+			exchanges[i].resp = rec.Data
+			// After the Rflush, the flushed request is not answered.
+			if j := exchanges[i].flushes; j >= 0 {
+				for t, k := range pending {
+					if k == j {
+						delete(pending, t)
+					}
+				}
+			}
+		}
+	}
+	return &Replay{exchanges: exchanges}, nil
+}
+
+// withTag returns a copy of the message msg with the tag replaced.
+func withTag(msg []byte, tag uint16) []byte {
+	msg = bytes.Clone(msg)
+	binary.LittleEndian.PutUint16(msg[5:7], tag)
+	return msg
+}
+
+// Pipe returns a new connection to rp, which rp serves in the background.
+func (rp *Replay) Pipe() net.Conn {
+	client, server := net.Pipe()
+	go rp.Serve(server)
+	return client
+}
+
+// Serve replays the trace on conn until the connection is closed.
+// Every connection replays the trace from the start.
+func (rp *Replay) Serve(conn io.ReadWriteCloser) error {
+	defer conn.Close()
+	used := make([]bool, len(rp.exchanges))
+	last := make(map[uint16]int) // Tag to index of its last request
+	for {
+		msg, err := readRaw(conn)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+				return nil
+			}
+			return err
+		}
+		tag := binary.LittleEndian.Uint16(msg[5:7])
+		req, flushes := normalize(msg, last)
+
+		var resp []byte
+		found := false
+		for i, ex := range rp.exchanges {
+			if !used[i] && ex.flushes == flushes && bytes.Equal(ex.req, req) {
+				used[i] = true
+				found = true
+				resp = ex.resp
+				last[tag] = i
+				break
+			}
+		}
+		if !found {
+			delete(last, tag)
+		}
+		switch {
+		case !found && ninep.MsgType(msg[4]) == ninep.MsgTflush:
+			err = ninep.WriteMessage(conn, &ninep.Rflush{Tag: tag})
+		case !found:
+			ename := fmt.Sprintf("replay: request not in trace: %v", ninep.MsgType(msg[4]))
+			err = ninep.WriteMessage(conn, &ninep.Rerror{Tag: tag, Ename: ename})
+		case resp != nil:
+			_, err = conn.Write(withTag(resp, tag))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readRaw reads the next message from r without decoding it.
+func readRaw(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < 7 || n > ninep.MaxMsize {
+		return nil, fmt.Errorf("message size %d out of bounds", n)
+	}
+	msg := make([]byte, n)
+	copy(msg, size[:])
+	if _, err := io.ReadFull(r, msg[4:]); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,177 @@
+package ninetest_test
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"slices"
+	"testing"
+
+	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/ninetest"
+)
+
+// session reads a few files from fsys and returns what it saw.
+func session(t *testing.T, fsys fs.FS) []string {
+	t.Helper()
+	var got []string
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	for _, name := range []string{"NOTICE", "lib/font/README"} {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatalf("ReadFile(%q): %v", name, err)
+		}
+		got = append(got, string(data))
+	}
+	return got
+}
+
+func TestReplay(t *testing.T) {
+	srv := &ninetest.Server{Files: map[string]ninetest.File{
+		"lib/font/README": {Data: []byte("fonts"), Mode: 0644},
+		"NOTICE":          {Data: []byte("copyright"), Mode: 0444},
+	}}
+
+	var trace bytes.Buffer
+	cc, err := ninep.NewClientConn(srv.Pipe(), ninep.DialOpts{Trace: ninep.NewTraceWriter(&trace)})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	fsys, err := ninep.Attach(cc, ninep.AttachOpts{Uname: "glenda"})
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	want := session(t, fsys)
+	fsys.Close()
+
+	rp, err := ninetest.NewReplay(ninep.NewTraceReader(bytes.NewReader(trace.Bytes())))
+	if err != nil {
+		t.Fatalf("NewReplay: %v", err)
+	}
+	// Each connection replays the trace from the start.
+	for i := 0; i < 2; i++ {
+		cc, err := ninep.NewClientConn(rp.Pipe(), ninep.DialOpts{})
+		if err != nil {
+			t.Fatalf("NewClientConn: %v", err)
+		}
+		fsys, err := ninep.Attach(cc, ninep.AttachOpts{Uname: "glenda"})
+		if err != nil {
+			t.Fatalf("Attach: %v", err)
+		}
+		if got := session(t, fsys); !slices.Equal(got, want) {
+			t.Errorf("replayed session: got %q, want %q", got, want)
+		}
+
+		// Requests that were not recorded fail.
+		if _, err := fsys.Open("lib/namespace"); err == nil {
+			t.Errorf("Open of file not in trace succeeded")
+		}
+		// Flushes succeed even if they were not recorded.
+		if err := cc.Flush(1234); err != nil {
+			t.Errorf("Flush of request not in trace: %v", err)
+		}
+		fsys.Close()
+	}
+}
+
+// A recorded flush is replayed, also when the client uses other tags:
+// the flushed request is not answered, and the Tflush is.
+func TestReplayFlush(t *testing.T) {
+	arrived := make(chan struct{})
+	wait := make(chan struct{})
+	defer close(wait)
+	srv := &ninetest.Server{Fault: func(req ninep.Message) ninetest.Fault {
+		if _, ok := req.(*ninep.Tstat); ok {
+			close(arrived)
+			return ninetest.Fault{Wait: wait}
+		}
+		return ninetest.Fault{}
+	}}
+	var trace bytes.Buffer
+	cc, err := ninep.NewClientConn(srv.Pipe(), ninep.DialOpts{Trace: ninep.NewTraceWriter(&trace)})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	if _, err := cc.Attach(context.Background(), 0, ^uint32(0), "glenda", ""); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-arrived
+		cancel()
+	}()
+	if _, err := cc.Stat(ctx, 0); err == nil {
+		t.Fatalf("flushed Stat succeeded")
+	}
+	cc.Close()
+
+	rp, err := ninetest.NewReplay(ninep.NewTraceReader(bytes.NewReader(trace.Bytes())))
+	if err != nil {
+		t.Fatalf("NewReplay: %v", err)
+	}
+	conn := rp.Pipe()
+	defer conn.Close()
+	for _, tc := range []struct {
+		req  ninep.Message
+		want ninep.MsgType // Zero if no reply is expected.
+	}{
+		{&ninep.Tversion{Tag: 0xffff, Msize: 8192, Version: "9P2000"}, ninep.MsgRversion},
+		{&ninep.Tattach{Tag: 100, FID: 0, AFID: ^uint32(0), Uname: "glenda"}, ninep.MsgRattach},
+		{&ninep.Tstat{Tag: 101, FID: 0}, 0},
+		{&ninep.Tflush{Tag: 102, OldTag: 101}, ninep.MsgRflush},
+		// Not in the trace any more; the Rerror shows that the first
+		// Tstat was not answered in between.
+		{&ninep.Tstat{Tag: 103, FID: 0}, ninep.MsgRerror},
+	} {
+		if err := ninep.WriteMessage(conn, tc.req); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+		if tc.want == 0 {
+			continue
+		}
+		m, err := ninep.ReadMessage(conn)
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if m.Type() != tc.want || m.MessageTag() != tc.req.MessageTag() {
+			t.Errorf("%v: got %v tag %d, want %v tag %d", tc.req.Type(), m.Type(), m.MessageTag(), tc.want, tc.req.MessageTag())
+		}
+	}
+}
+
+func TestTraceRecords(t *testing.T) {
+	srv := &ninetest.Server{}
+	var trace bytes.Buffer
+	cc, err := ninep.NewClientConn(srv.Pipe(), ninep.DialOpts{Trace: ninep.NewTraceWriter(&trace)})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	cc.Close()
+
+	tr := ninep.NewTraceReader(&trace)
+	for _, want := range []struct {
+		dir ninep.TraceDir
+		msg ninep.Message
+	}{
+		{ninep.TraceSent, &ninep.Tversion{Tag: 0xffff, Msize: 8192, Version: "9P2000"}},
+		{ninep.TraceReceived, &ninep.Rversion{Tag: 0xffff, Msize: 8192, Version: "9P2000"}},
+	} {
+		rec, err := tr.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		wire, _ := ninep.Marshal(want.msg)
+		if rec.Dir != want.dir || !bytes.Equal(rec.Data, wire) {
+			t.Errorf("got %v record %x, want %v record %x", rec.Dir, rec.Data, want.dir, wire)
+		}
+		if rec.Time.IsZero() {
+			t.Errorf("record has no timestamp")
+		}
+	}
+}
@@ -0,0 +1,795 @@
+// Package ninetest provides an in-memory 9P server for testing 9P
+// clients, with the ability to inject faults.
+package ninetest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gnoack/ninep"
+)
+
+// File is a file or directory served by a Server.
+type File struct {
+	// Contents of the file.
+	Data []byte
+	// Permissions and flags, as in ninep.Stat.Mode.
+	// Directories must have ninep.ModeDir set.
+	Mode uint32
+}
+
+// Fault describes how a Server misbehaves when replying to a request.
+// The zero value is a well-behaved reply.
+type Fault struct {
+	// Delay delays the reply by the given duration.
+	Delay time.Duration
+	// If Wait is non-nil, the reply is delayed until Wait is closed.
+	Wait <-chan struct{}
+	// If Error is set, the server replies with an Rerror carrying
+	// this message instead of doing the operation.
+	Error string
+	// If Drop is set, the server closes the connection instead of
+	// replying.
+	Drop bool
+}
+
+// Server is an in-memory 9P server.
+//
+// Requests are handled concurrently, so replies to delayed requests
+// may overtake each other.  Requests flushed while they are delayed
+// by a Fault are not replied to.  Other flushed requests are answered
+// before the Rflush, as by a real server.
+type Server struct {
+	// Files maps slash-separated paths without leading slash, like
+	// "lib/font", to files.  The server updates the map on writes,
+	// creation and removal.  Parent directories are implied where
+	// they are not given.
+	Files map[string]File
+
+	// Fault, if non-nil, is called for every request and returns
+	// the misbehavior to apply when replying to it.
+	Fault func(req ninep.Message) Fault
+
+	mu    sync.Mutex // Guards Files and the fields below.
+	paths map[string]uint64
+	vers  map[string]uint32
+}
+
+// Pipe returns a new connection to s, which s serves in the background.
+func (s *Server) Pipe() net.Conn {
+	client, server := net.Pipe()
+	go s.Serve(server)
+	return client
+}
+
+// Dial returns a new client connection to s.
+func (s *Server) Dial() (*ninep.ClientConn, error) {
+	return ninep.NewClientConn(s.Pipe(), ninep.DialOpts{})
+}
+
+// DialFS returns a new file system connected to s.
+func (s *Server) DialFS() (*ninep.FS, error) {
+	cc, err := s.Dial()
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := ninep.Attach(cc, ninep.AttachOpts{Uname: "glenda"})
+	if err != nil {
+		cc.Close()
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// Serve serves 9P on conn until the connection is closed.
+func (s *Server) Serve(conn io.ReadWriteCloser) error {
+	c := &serverConn{
+		srv:     s,
+		conn:    conn,
+		fids:    make(map[uint32]fid),
+		pending: make(map[uint16]*request),
+	}
+	defer c.close()
+	for {
+		m, err := ninep.ReadMessage(conn)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+				return nil
+			}
+			return err
+		}
+		c.start(m)
+	}
+}
+
+type fid struct {
+	path string
+	open bool
+	mode uint8
+}
+
+type request struct {
+	flushed chan struct{} // Closed when flushed.
+	done    chan struct{} // Closed when replied or abandoned.
+
+	// Guarded by serverConn.mu.
+	isFlushed bool
+	isDone    bool
+	lastFlush *request // The latest Tflush of this request.
+	flushes   *request // For a Tflush, the request it flushes,
+	flushTag  uint16   // its tag,
+	prevFlush *request // and the Tflush of it before this one.
+}
+
+type serverConn struct {
+	srv  *Server
+	conn io.ReadWriteCloser
+
+	wmu sync.Mutex // Write mutex.
+
+	mu      sync.Mutex
+	fids    map[uint32]fid
+	pending map[uint16]*request
+}
+
+func (c *serverConn) close() {
+	c.conn.Close()
+}
+
+func (c *serverConn) start(m ninep.Message) {
+	req := &request{
+		flushed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	c.mu.Lock()
+	c.pending[m.MessageTag()] = req
+	if f, ok := m.(*ninep.Tflush); ok {
+		c.flushLocked(req, f)
+	}
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			req.isDone = true
+			c.release(m.MessageTag(), req)
+			if req.flushes != nil {
+				c.release(req.flushTag, req.flushes)
+			}
+			c.mu.Unlock()
+			close(req.done)
+		}()
+		c.handle(m, req)
+	}()
+}
+
+// release unregisters the request req with the given tag, once it
+// and its latest Tflush are done, so that further Tflushes of the
+// same tag are answered after the earlier ones.  c.mu must be held.
+func (c *serverConn) release(tag uint16, req *request) {
+	if c.pending[tag] != req || !req.isDone {
+		return
+	}
+	if req.lastFlush != nil && !req.lastFlush.isDone {
+		return
+	}
+	delete(c.pending, tag)
+}
+
+// flushLocked flushes the request which the Tflush m refers to.  It
+// runs when m arrives, so that Tflushes of the same request are
+// ordered as they were received.  c.mu must be held.
+func (c *serverConn) flushLocked(self *request, m *ninep.Tflush) {
+	req, ok := c.pending[m.OldTag]
+	if !ok || m.OldTag == m.Tag {
+		return
+	}
+	self.flushes, self.flushTag = req, m.OldTag
+	self.prevFlush = req.lastFlush
+	req.lastFlush = self
+	if !req.isFlushed {
+		req.isFlushed = true
+		close(req.flushed)
+	}
+}
+
+// awaitFlush waits until the request flushed by the Tflush with the
+// given tag and the earlier Tflushes of it are finished, so that their
+// replies precede the Rflush.  It returns false if the Tflush is
+// flushed itself while waiting.
+func (c *serverConn) awaitFlush(tag uint16) bool {
+	c.mu.Lock()
+	self := c.pending[tag]
+	c.mu.Unlock()
+	for _, r := range []*request{self.flushes, self.prevFlush} {
+		if r == nil {
+			continue
+		}
+		select {
+		case <-r.done:
+		case <-self.flushed:
+			return false
+		}
+	}
+	return true
+}
+
+func (c *serverConn) handle(m ninep.Message, req *request) {
+	var f Fault
+	if c.srv.Fault != nil {
+		f = c.srv.Fault(m)
+	}
+	if f.Drop {
+		c.close()
+		return
+	}
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-req.flushed:
+			return
+		}
+	}
+	if f.Wait != nil {
+		select {
+		case <-f.Wait:
+		case <-req.flushed:
+			return
+		}
+	}
+
+	var resp ninep.Message
+	if f.Error != "" {
+		resp = &ninep.Rerror{Tag: m.MessageTag(), Ename: f.Error}
+	} else {
+		resp = c.dispatch(m)
+	}
+	if resp == nil {
+		return // A flushed Tflush.
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	ninep.WriteMessage(c.conn, resp)
+}
+
+func rerror(tag uint16, ename string) ninep.Message {
+	return &ninep.Rerror{Tag: tag, Ename: ename}
+}
+
+// Error messages, as used by Plan 9.
+const (
+	errNotExist  = "file does not exist"
+	errExist     = "file already exists"
+	errPerm      = "permission denied"
+	errBadFid    = "unknown fid"
+	errFidInUse  = "fid already in use"
+	errNotDir    = "not a directory"
+	errIsDir     = "is a directory"
+	errNotOpen   = "fid not open"
+	errOpen      = "fid already open"
+	errBadOffset = "bad offset in directory read"
+	errNotEmpty  = "directory not empty"
+	errAuth      = "authentication not required"
+	errBadMsg    = "unexpected message"
+	errTooBig    = "file too big"
+	errShort     = "read count too small for directory entry"
+)
+
+// maxFileSize is the maximum length of a file, so that clients cannot
+// make the server allocate unbounded memory.
+const maxFileSize = 1 << 30
+
+func (c *serverConn) dispatch(m ninep.Message) ninep.Message {
+	s := c.srv
+	tag := m.MessageTag()
+	switch m := m.(type) {
+	case *ninep.Tversion:
+		msize := min(m.Msize, 8192)
+		if !strings.HasPrefix(m.Version, "9P2000") {
+			return &ninep.Rversion{Tag: tag, Msize: msize, Version: "unknown"}
+		}
+		c.mu.Lock()
+		clear(c.fids)
+		c.mu.Unlock()
+		return &ninep.Rversion{Tag: tag, Msize: msize, Version: "9P2000"}
+
+	case *ninep.Tauth:
+		return rerror(tag, errAuth)
+
+	case *ninep.Tflush:
+		if !c.awaitFlush(tag) {
+			return nil
+		}
+		return &ninep.Rflush{Tag: tag}
+
+	case *ninep.Tattach:
+		if err := c.newFid(m.FID, ""); err != "" {
+			return rerror(tag, err)
+		}
+		return &ninep.Rattach{Tag: tag, QID: s.qid("")}
+
+	case *ninep.Twalk:
+		f, ok := c.fid(m.FID)
+		if !ok {
+			return rerror(tag, errBadFid)
+		}
+		p := f.path
+		qids := []ninep.QID{}
+		for _, name := range m.Wnames {
+			if !s.isDir(p) || strings.Contains(name, "/") {
+				break
+			}
+			next := path.Join(p, name)
+			if name == ".." {
+				next = path.Dir(p)
+			}
+			if next == "." {
+				next = ""
+			}
+			if _, ok := s.lookup(next); !ok {
+				break
+			}
+			p = next
+			qids = append(qids, s.qid(p))
+		}
+		if len(qids) < len(m.Wnames) {
+			if len(qids) == 0 {
+				return rerror(tag, errNotExist)
+			}
+			return &ninep.Rwalk{Tag: tag, QIDs: qids}
+		}
+		if m.NewFID == m.FID {
+			f.path = p
+			c.setFid(m.FID, f)
+		} else if err := c.newFid(m.NewFID, p); err != "" {
+			return rerror(tag, err)
+		}
+		return &ninep.Rwalk{Tag: tag, QIDs: qids}
+
+	case *ninep.Topen:
+		f, ok := c.fid(m.FID)
+		if !ok {
+			return rerror(tag, errBadFid)
+		}
+		if f.open {
+			return rerror(tag, errOpen)
+		}
+		if err := s.open(f.path, m.Mode); err != "" {
+			return rerror(tag, err)
+		}
+		f.open = true
+		f.mode = m.Mode
+		c.setFid(m.FID, f)
+		return &ninep.Ropen{Tag: tag, QID: s.qid(f.path)}
+
+	case *ninep.Tcreate:
+		f, ok := c.fid(m.FID)
+		if !ok {
+			return rerror(tag, errBadFid)
+		}
+		if f.open {
+			return rerror(tag, errOpen)
+		}
+		p := path.Join(f.path, m.Name)
+		if err := s.create(f.path, p, m.Perm); err != "" {
+			return rerror(tag, err)
+		}
+		f.path = p
+		f.open = true
+		f.mode = m.Mode
+		c.setFid(m.FID, f)
+		return &ninep.Rcreate{Tag: tag, QID: s.qid(p)}
+
+	case *ninep.Tread:
+		f, ok := c.fid(m.FID)
+		if !ok {
+			return rerror(tag, errBadFid)
+		}
+		if !f.open || f.mode&3 == ninep.OWrite {
+			return rerror(tag, errNotOpen)
+		}
+		data, err := s.read(f.path, m.Offset, m.Count)
+		if err != "" {
+			return rerror(tag, err)
+		}
+		return &ninep.Rread{Tag: tag, Data: data}
+
+	case *ninep.Twrite:
+		f, ok := c.fid(m.FID)
+		if !ok {
+			return rerror(tag, errBadFid)
+		}
+		if !f.open || (f.mode&3 != ninep.OWrite && f.mode&3 != ninep.ORdWr) {
+			return rerror(tag, errNotOpen)
+		}
+		if err := s.write(f.path, m.Offset, m.Data); err != "" {
+			return rerror(tag, err)
+		}
+		return &ninep.Rwrite{Tag: tag, Count: uint32(len(m.Data))}
+
+	case *ninep.Tclunk:
+		if _, ok := c.fid(m.FID); !ok {
+			return rerror(tag, errBadFid)
+		}
+		c.mu.Lock()
+		delete(c.fids, m.FID)
+		c.mu.Unlock()
+		return &ninep.Rclunk{Tag: tag}
+
+	case *ninep.Tremove:
+		f, ok := c.fid(m.FID)
+		if !ok {
+			return rerror(tag, errBadFid)
+		}
+		c.mu.Lock()
+		delete(c.fids, m.FID)
+		c.mu.Unlock()
+		if err := s.remove(f.path); err != "" {
+			return rerror(tag, err)
+		}
+		return &ninep.Rremove{Tag: tag}
+
+	case *ninep.Tstat:
+		f, ok := c.fid(m.FID)
+		if !ok {
+			return rerror(tag, errBadFid)
+		}
+		st, ok := s.stat(f.path)
+		if !ok {
+			return rerror(tag, errNotExist)
+		}
+		return &ninep.Rstat{Tag: tag, Stat: st}
+
+	case *ninep.Twstat:
+		f, ok := c.fid(m.FID)
+		if !ok {
+			return rerror(tag, errBadFid)
+		}
+		p, err := s.wstat(f.path, m.Stat)
+		if err != "" {
+			return rerror(tag, err)
+		}
+		f.path = p
+		c.setFid(m.FID, f)
+		return &ninep.Rwstat{Tag: tag}
+	}
+	return rerror(tag, errBadMsg)
+}
+
+func (c *serverConn) fid(n uint32) (fid, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.fids[n]
+	return f, ok
+}
+
+func (c *serverConn) setFid(n uint32, f fid) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fids[n] = f
+}
+
+func (c *serverConn) newFid(n uint32, p string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.fids[n]; ok {
+		return errFidInUse
+	}
+	c.fids[n] = fid{path: p}
+	return ""
+}
+
+// lookup returns the file at p, including implied directories.
+func (s *Server) lookup(p string) (File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookupLocked(p)
+}
+
+func (s *Server) lookupLocked(p string) (File, bool) {
+	if f, ok := s.Files[p]; ok {
+		return f, true
+	}
+	if p == "" {
+		return File{Mode: ninep.ModeDir | 0777}, true
+	}
+	for name := range s.Files {
+		if strings.HasPrefix(name, p+"/") {
+			return File{Mode: ninep.ModeDir | 0777}, true
+		}
+	}
+	return File{}, false
+}
+
+func (s *Server) isDir(p string) bool {
+	f, ok := s.lookup(p)
+	return ok && f.Mode&ninep.ModeDir != 0
+}
+
+// childrenLocked returns the sorted names of the directory entries of p.
+func (s *Server) childrenLocked(p string) []string {
+	prefix := p + "/"
+	if p == "" {
+		prefix = ""
+	}
+	seen := make(map[string]bool)
+	for name := range s.Files {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok || rest == "" || name == p {
+			continue
+		}
+		first, _, _ := strings.Cut(rest, "/")
+		seen[first] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) qid(p string) ninep.QID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.qidLocked(p)
+}
+
+func (s *Server) qidLocked(p string) ninep.QID {
+	s.initLocked()
+	id, ok := s.paths[p]
+	if !ok {
+		id = uint64(len(s.paths))
+		s.paths[p] = id
+	}
+	f, _ := s.lookupLocked(p)
+	return ninep.QID{Kind: uint8(f.Mode >> 24), Vers: s.vers[p], Path: id}
+}
+
+func (s *Server) initLocked() {
+	if s.paths == nil {
+		s.paths = make(map[string]uint64)
+		s.vers = make(map[string]uint32)
+	}
+}
+
+// bumpLocked increments the QID version of p after modification.
+func (s *Server) bumpLocked(p string) {
+	s.initLocked()
+	s.vers[p]++
+}
+
+func (s *Server) stat(p string) (ninep.Stat, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statLocked(p)
+}
+
+func (s *Server) statLocked(p string) (ninep.Stat, bool) {
+	f, ok := s.lookupLocked(p)
+	if !ok {
+		return ninep.Stat{}, false
+	}
+	name := path.Base(p)
+	if p == "" {
+		name = "/"
+	}
+	length := uint64(len(f.Data))
+	if f.Mode&ninep.ModeDir != 0 {
+		length = 0
+	}
+	return ninep.Stat{
+		QID:    s.qidLocked(p),
+		Mode:   f.Mode,
+		Length: length,
+		Name:   name,
+		UID:    "glenda",
+		GID:    "glenda",
+		MUID:   "glenda",
+	}, true
+}
+
+// permitted reports whether the open mode is allowed by the file
+// permissions, which are checked for the owner.
+func permitted(f File, mode uint8) bool {
+	var need uint32
+	switch mode & 3 {
+	case ninep.ORead:
+		need = ninep.ModeUserRead
+	case ninep.OWrite:
+		need = ninep.ModeUserWrite
+	case ninep.ORdWr:
+		need = ninep.ModeUserRead | ninep.ModeUserWrite
+	case ninep.OExec:
+		need = ninep.ModeUserExec
+	}
+	if mode&ninep.OTrunc != 0 {
+		need |= ninep.ModeUserWrite
+	}
+	return f.Mode&need == need
+}
+
+func (s *Server) open(p string, mode uint8) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.lookupLocked(p)
+	if !ok {
+		return errNotExist
+	}
+	if f.Mode&ninep.ModeDir != 0 && mode&3 != ninep.ORead {
+		return errIsDir
+	}
+	if !permitted(f, mode) {
+		return errPerm
+	}
+	if mode&ninep.OTrunc != 0 {
+		f.Data = nil
+		s.Files[p] = f
+		s.bumpLocked(p)
+	}
+	return ""
+}
+
+func (s *Server) create(dir, p string, perm uint32) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.lookupLocked(dir)
+	if !ok {
+		return errNotExist
+	}
+	if d.Mode&ninep.ModeDir == 0 {
+		return errNotDir
+	}
+	if d.Mode&ninep.ModeUserWrite == 0 {
+		return errPerm
+	}
+	if _, ok := s.lookupLocked(p); ok {
+		return errExist
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]File)
+	}
+	s.Files[p] = File{Mode: perm}
+	return ""
+}
+
+func (s *Server) read(p string, offset uint64, count uint32) ([]byte, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.lookupLocked(p)
+	if !ok {
+		return nil, errNotExist
+	}
+	if f.Mode&ninep.ModeDir == 0 {
+		if offset >= uint64(len(f.Data)) {
+			return []byte{}, ""
+		}
+		data := f.Data[offset:]
+		if uint64(len(data)) > uint64(count) {
+			data = data[:count]
+		}
+		return append([]byte{}, data...), ""
+	}
+
+	// Directory reads return whole entries only,
+	// and may only start at entry boundaries.
+	var data []byte
+	var pos uint64
+	for _, name := range s.childrenLocked(p) {
+		st, _ := s.statLocked(path.Join(p, name))
+		buf, err := st.MarshalBinary()
+		if err != nil {
+			return nil, err.Error()
+		}
+		switch {
+		case pos < offset:
+			pos += uint64(len(buf))
+			continue
+		case pos > offset && len(data) == 0:
+			return nil, errBadOffset
+		}
+		if len(data)+len(buf) > int(count) {
+			if len(data) == 0 {
+				return nil, errShort
+			}
+			break
+		}
+		data = append(data, buf...)
+		pos += uint64(len(buf))
+	}
+	if pos < offset {
+		return nil, errBadOffset
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, ""
+}
+
+func (s *Server) write(p string, offset uint64, data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.lookupLocked(p)
+	if !ok {
+		return errNotExist
+	}
+	if f.Mode&ninep.ModeAppend != 0 {
+		offset = uint64(len(f.Data))
+	}
+	if offset > maxFileSize || uint64(len(data)) > maxFileSize-offset {
+		return errTooBig
+	}
+	end := offset + uint64(len(data))
+	if end > uint64(len(f.Data)) {
+		f.Data = append(f.Data, make([]byte, end-uint64(len(f.Data)))...)
+	}
+	copy(f.Data[offset:], data)
+	s.Files[p] = f
+	s.bumpLocked(p)
+	return ""
+}
+
+func (s *Server) remove(p string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lookupLocked(p); !ok || p == "" {
+		return errNotExist
+	}
+	if len(s.childrenLocked(p)) > 0 {
+		return errNotEmpty
+	}
+	delete(s.Files, p)
+	return ""
+}
+
+// wstat applies the changes in st to the file at p, and returns its
+// new path.  Only the name, mode and length can be changed.
+func (s *Server) wstat(p string, st ninep.Stat) (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.lookupLocked(p)
+	if !ok {
+		return p, errNotExist
+	}
+	if st.Mode != ^uint32(0) {
+		if (st.Mode^f.Mode)&ninep.ModeDir != 0 {
+			return p, errPerm
+		}
+		f.Mode = st.Mode
+	}
+	if st.Length != ^uint64(0) {
+		if f.Mode&ninep.ModeDir != 0 {
+			return p, errIsDir
+		}
+		if st.Length > maxFileSize {
+			return p, errTooBig
+		}
+		data := make([]byte, st.Length)
+		copy(data, f.Data)
+		f.Data = data
+		s.bumpLocked(p)
+	}
+	newp := p
+	if st.Name != "" && st.Name != path.Base(p) {
+		if p == "" || strings.Contains(st.Name, "/") {
+			return p, errPerm
+		}
+		newp = path.Join(path.Dir(p), st.Name)
+		if _, ok := s.lookupLocked(newp); ok {
+			return p, errExist
+		}
+		if len(s.childrenLocked(p)) > 0 {
+			return p, errNotEmpty
+		}
+		delete(s.Files, p)
+	}
+	s.Files[newp] = f
+	return newp, ""
+}
@@ -0,0 +1,135 @@
+package ninetest_test
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+
+	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/ninetest"
+)
+
+func TestServerReadFile(t *testing.T) {
+	srv := &ninetest.Server{Files: map[string]ninetest.File{
+		"lib/font/README": {Data: []byte("fonts"), Mode: 0644},
+		"NOTICE":          {Data: []byte("copyright"), Mode: 0444},
+	}}
+	fsys, err := srv.DialFS()
+	if err != nil {
+		t.Fatalf("DialFS: %v", err)
+	}
+	defer fsys.Close()
+
+	got, err := fs.ReadFile(fsys, "lib/font/README")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "fonts" {
+		t.Errorf("ReadFile = %q, want %q", got, "fonts")
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 2 || names[0] != "NOTICE" || names[1] != "lib" {
+		t.Errorf("ReadDir = %v, want [NOTICE lib]", names)
+	}
+}
+
+func TestServerPermissions(t *testing.T) {
+	srv := &ninetest.Server{Files: map[string]ninetest.File{
+		"ro": {Data: []byte("x"), Mode: 0444},
+	}}
+	fsys, err := srv.DialFS()
+	if err != nil {
+		t.Fatalf("DialFS: %v", err)
+	}
+	defer fsys.Close()
+
+	if _, err := fsys.OpenFile("ro", ninep.OWrite); err == nil {
+		t.Errorf("OpenFile(ro, OWrite) succeeded, want error")
+	}
+}
+
+// The fake server is robust against requests which would make it
+// allocate unbounded memory, and reports short directory reads.
+func TestServerLimits(t *testing.T) {
+	srv := &ninetest.Server{Files: map[string]ninetest.File{
+		"f":     {Mode: 0644},
+		"dir/a": {Mode: 0644},
+	}}
+	c, err := srv.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if _, err := c.Attach(ctx, 0, ^uint32(0), "glenda", ""); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	if _, err := c.Walk(ctx, 0, 1, []string{"f"}); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if _, _, err := c.Open(ctx, 1, ninep.OWrite); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, off := range []uint64{1 << 40, ^uint64(0) - 1} {
+		if _, err := c.Write(ctx, 1, off, []byte("xyz")); err == nil || err.Error() != "file too big" {
+			t.Errorf("Write at %#x: got %v, want %q", off, err, "file too big")
+		}
+	}
+	s := ninep.NullStat()
+	s.Length = 1 << 62
+	if err := c.Wstat(ctx, 1, s); err == nil || err.Error() != "file too big" {
+		t.Errorf("Wstat to length 2^62: got %v, want %q", err, "file too big")
+	}
+
+	if _, err := c.Walk(ctx, 0, 2, []string{"dir"}); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if _, _, err := c.Open(ctx, 2, ninep.ORead); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := c.Read(ctx, 2, 0, make([]byte, 10)); err == nil {
+		t.Errorf("directory read shorter than an entry succeeded")
+	}
+}
+
+// Tflushes of the same request are answered in order.
+func TestServerFlushOrder(t *testing.T) {
+	wait := make(chan struct{})
+	defer close(wait)
+	srv := &ninetest.Server{Fault: func(req ninep.Message) ninetest.Fault {
+		if _, ok := req.(*ninep.Tstat); ok {
+			return ninetest.Fault{Wait: wait}
+		}
+		return ninetest.Fault{}
+	}}
+	conn := srv.Pipe()
+	defer conn.Close()
+	for range 100 {
+		for _, m := range []ninep.Message{
+			&ninep.Tstat{Tag: 1, FID: 0},
+			&ninep.Tflush{Tag: 2, OldTag: 1},
+			&ninep.Tflush{Tag: 3, OldTag: 1},
+		} {
+			if err := ninep.WriteMessage(conn, m); err != nil {
+				t.Fatalf("WriteMessage: %v", err)
+			}
+		}
+		for _, want := range []uint16{2, 3} {
+			m, err := ninep.ReadMessage(conn)
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			if _, ok := m.(*ninep.Rflush); !ok || m.MessageTag() != want {
+				t.Fatalf("got %v tag %d, want Rflush tag %d", m.Type(), m.MessageTag(), want)
+			}
+		}
+	}
+}
@@ -11,6 +11,9 @@ const (
 	QTAUTH   = 0x08 // type bit for authentication file
 	QTTMP    = 0x04 // type bit for not-backed-up file
 	QTFILE   = 0x00 // plain file
+
+	// 9P2000.u extension
+	QTSYMLINK = 0x02 // type bit for symbolic links
 )
 
 // QID in Plan9 is defined in libc.h
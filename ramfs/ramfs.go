@@ -0,0 +1,423 @@
+// Package ramfs implements a writable in-memory file tree, to be
+// served with ninep.Server.
+//
+// Files and directories follow the semantics of Plan 9's ramfs(4):
+// permissions are checked against the attaching user, exclusive-use
+// files can only be open once at a time, writes to append-only files
+// go to the end of the file, and the QID version of a file changes on
+// every modification.
+package ramfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gnoack/ninep"
+)
+
+// Errors, as used by Plan 9.
+var (
+	errNotEmpty     = errors.New("directory not empty")
+	errExclusive    = errors.New("exclusive use file already open")
+	errNotDir       = errors.New("not a directory")
+	errIsDir        = errors.New("is a directory")
+	errRemoved      = errors.New("file has been removed")
+	errDirBit       = errors.New("can't change directory bit")
+	errChangeOwner  = errors.New("can't change owner")
+	errDirLength    = errors.New("can't change length of directory")
+	errBadName      = errors.New("bad file name")
+	errRenameRoot   = errors.New("can't rename root")
+	errNotOwner     = errors.New("not owner")
+	errImmutableQID = errors.New("can't change qid, type or dev")
+	errNegOffset    = errors.New("negative i/o offset")
+	errTooBig       = errors.New("file too big")
+)
+
+// maxFileSize is the maximum length of a file, so that clients cannot
+// make the server allocate arbitrary amounts of memory.
+const maxFileSize = 1 << 30
+
+// FS is an in-memory file tree.  It implements ninep.FileServer.
+type FS struct {
+	mu       sync.Mutex
+	root     *file
+	nextPath uint64
+}
+
+// New returns an empty file tree, whose root directory is owned by
+// owner and writable by everyone.
+func New(owner string) *FS {
+	fsys := &FS{}
+	fsys.root = fsys.newFile("/", ninep.ModeDir|0o777, owner, owner)
+	return fsys
+}
+
+// file is a file or directory.  All fields are guarded by FS.mu.
+type file struct {
+	stat     ninep.Stat // Without Length.
+	parent   *file      // nil for the root and removed files.
+	children map[string]*file
+	data     []byte
+	opens    int  // Number of open handles.
+	removed  bool // Set when the file has been removed.
+}
+
+func (fsys *FS) newFile(name string, mode uint32, uid, gid string) *file {
+	fsys.nextPath++
+	now := uint32(time.Now().Unix())
+	f := &file{
+		stat: ninep.Stat{
+			QID:   ninep.QID{Kind: uint8(mode >> 24), Path: fsys.nextPath},
+			Mode:  mode,
+			Atime: now,
+			Mtime: now,
+			Name:  name,
+			UID:   uid,
+			GID:   gid,
+			MUID:  uid,
+		},
+	}
+	if f.isDir() {
+		f.children = make(map[string]*file)
+	}
+	return f
+}
+
+func (f *file) isDir() bool { return f.stat.Mode&ninep.ModeDir != 0 }
+
+// modified updates the version and modification time after a change
+// by user.
+func (f *file) modified(user string) {
+	f.stat.QID.Vers++
+	f.stat.Mtime = uint32(time.Now().Unix())
+	f.stat.MUID = user
+}
+
+// Permission bits, as in access(2).
+const (
+	permRead  = 4
+	permWrite = 2
+	permExec  = 1
+)
+
+// allowed reports whether user has the permissions perm on f.
+func (f *file) allowed(user string, perm uint32) bool {
+	mode := f.stat.Mode
+	if mode&perm == perm {
+		return true
+	}
+	if user == f.stat.GID && (mode>>3)&perm == perm {
+		return true
+	}
+	return user == f.stat.UID && (mode>>6)&perm == perm
+}
+
+// openPerm returns the permissions needed to open a file with mode.
+func openPerm(mode uint8) uint32 {
+	var perm uint32
+	switch mode & 3 {
+	case ninep.ORead:
+		perm = permRead
+	case ninep.OWrite:
+		perm = permWrite
+	case ninep.ORdWr:
+		perm = permRead | permWrite
+	case ninep.OExec:
+		perm = permExec
+	}
+	if mode&ninep.OTrunc != 0 {
+		perm |= permWrite
+	}
+	return perm
+}
+
+// Attach implements ninep.FileServer.
+func (fsys *FS) Attach(ctx context.Context, uname, aname string) (ninep.Node, error) {
+	if aname != "" {
+		return nil, fs.ErrNotExist
+	}
+	return &node{fsys: fsys, f: fsys.root, user: uname}, nil
+}
+
+// node is a file as accessed by user.
+type node struct {
+	fsys *FS
+	f    *file
+	user string
+}
+
+func (n *node) Stat(ctx context.Context) (ninep.Stat, error) {
+	n.fsys.mu.Lock()
+	defer n.fsys.mu.Unlock()
+	return n.f.statLocked(), nil
+}
+
+func (f *file) statLocked() ninep.Stat {
+	st := f.stat
+	st.Length = uint64(len(f.data))
+	return st
+}
+
+func (n *node) Walk(ctx context.Context, name string) (ninep.Node, error) {
+	n.fsys.mu.Lock()
+	defer n.fsys.mu.Unlock()
+	if !n.f.isDir() {
+		return nil, errNotDir
+	}
+	if !n.f.allowed(n.user, permExec) {
+		return nil, fs.ErrPermission
+	}
+	c, ok := n.f.children[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return &node{fsys: n.fsys, f: c, user: n.user}, nil
+}
+
+func (n *node) Open(ctx context.Context, mode uint8) (ninep.Handle, error) {
+	n.fsys.mu.Lock()
+	defer n.fsys.mu.Unlock()
+	if err := n.checkOpenLocked(n.f, mode); err != nil {
+		return nil, err
+	}
+	if mode&ninep.OTrunc != 0 && !n.f.isDir() && n.f.stat.Mode&ninep.ModeAppend == 0 {
+		n.f.data = nil
+		n.f.modified(n.user)
+	}
+	return n.openLocked(n.f, mode), nil
+}
+
+// checkOpenLocked checks whether f can be opened with mode.
+func (n *node) checkOpenLocked(f *file, mode uint8) error {
+	if f.removed {
+		return errRemoved
+	}
+	if !f.allowed(n.user, openPerm(mode)) {
+		return fs.ErrPermission
+	}
+	if mode&ninep.ORClose != 0 && (f.parent == nil || !f.parent.allowed(n.user, permWrite)) {
+		return fs.ErrPermission
+	}
+	if f.stat.Mode&ninep.ModeExcl != 0 && f.opens > 0 {
+		return errExclusive
+	}
+	return nil
+}
+
+func (n *node) openLocked(f *file, mode uint8) ninep.Handle {
+	f.opens++
+	f.stat.Atime = uint32(time.Now().Unix())
+	h := &handle{fsys: n.fsys, f: f, user: n.user}
+	if f.isDir() {
+		return &dirHandle{h}
+	}
+	return h
+}
+
+func (n *node) Create(ctx context.Context, name string, perm uint32, mode uint8) (ninep.Node, ninep.Handle, error) {
+	n.fsys.mu.Lock()
+	defer n.fsys.mu.Unlock()
+	dir := n.f
+	switch {
+	case dir.removed:
+		return nil, nil, errRemoved
+	case !dir.isDir():
+		return nil, nil, errNotDir
+	case !dir.allowed(n.user, permWrite):
+		return nil, nil, fs.ErrPermission
+	case dir.children[name] != nil:
+		return nil, nil, fs.ErrExist
+	}
+	// The new file's permissions are limited by the directory's,
+	// as in open(5).
+	if perm&ninep.ModeDir != 0 {
+		if mode&3 != ninep.ORead || mode&ninep.OTrunc != 0 {
+			return nil, nil, errIsDir
+		}
+		perm &= ^uint32(0o777) | dir.stat.Mode&0o777
+	} else {
+		perm &= ^uint32(0o666) | dir.stat.Mode&0o666
+	}
+	f := n.fsys.newFile(name, perm, n.user, dir.stat.GID)
+	f.parent = dir
+	dir.children[name] = f
+	dir.modified(n.user)
+	// Open permissions are not checked for the creator.
+	return &node{fsys: n.fsys, f: f, user: n.user}, n.openLocked(f, mode), nil
+}
+
+func (n *node) Remove(ctx context.Context) error {
+	n.fsys.mu.Lock()
+	defer n.fsys.mu.Unlock()
+	f := n.f
+	switch {
+	case f.removed:
+		return errRemoved
+	case f.parent == nil:
+		return fs.ErrPermission
+	case !f.parent.allowed(n.user, permWrite):
+		return fs.ErrPermission
+	case len(f.children) > 0:
+		return errNotEmpty
+	}
+	delete(f.parent.children, f.stat.Name)
+	f.parent.modified(n.user)
+	f.parent = nil
+	f.removed = true
+	return nil
+}
+
+// Wstat implements ninep.Wstater.  The changes are applied only if
+// all of them are permitted.
+func (n *node) Wstat(ctx context.Context, s ninep.Stat) error {
+	n.fsys.mu.Lock()
+	defer n.fsys.mu.Unlock()
+	f := n.f
+	if f.removed {
+		return errRemoved
+	}
+	null := ninep.NullStat()
+	isOwner := n.user == f.stat.UID
+	if s.Type != null.Type || s.Dev != null.Dev || s.QID != null.QID {
+		return errImmutableQID
+	}
+	if s.UID != "" && s.UID != f.stat.UID {
+		return errChangeOwner
+	}
+	if s.Name != "" && s.Name != f.stat.Name {
+		switch {
+		case f.parent == nil:
+			return errRenameRoot
+		case strings.Contains(s.Name, "/") || s.Name == "." || s.Name == "..":
+			return errBadName
+		case !f.parent.allowed(n.user, permWrite):
+			return fs.ErrPermission
+		case f.parent.children[s.Name] != nil:
+			return fs.ErrExist
+		}
+	}
+	if s.Length != null.Length {
+		if f.isDir() {
+			if s.Length != 0 {
+				return errDirLength
+			}
+		} else if !f.allowed(n.user, permWrite) {
+			return fs.ErrPermission
+		}
+		if s.Length > maxFileSize {
+			return errTooBig
+		}
+	}
+	if s.Mode != null.Mode && s.Mode != f.stat.Mode {
+		if !isOwner {
+			return errNotOwner
+		}
+		if s.Mode&ninep.ModeDir != f.stat.Mode&ninep.ModeDir {
+			return errDirBit
+		}
+	}
+	if s.Mtime != null.Mtime && s.Mtime != f.stat.Mtime && !isOwner {
+		return errNotOwner
+	}
+	if s.GID != "" && s.GID != f.stat.GID && !isOwner {
+		return errNotOwner
+	}
+
+	if s.Name != "" && s.Name != f.stat.Name {
+		delete(f.parent.children, f.stat.Name)
+		f.parent.children[s.Name] = f
+		f.parent.modified(n.user)
+		f.stat.Name = s.Name
+	}
+	if s.Length != null.Length && !f.isDir() {
+		f.data = resize(f.data, int(s.Length))
+		f.modified(n.user)
+	}
+	if s.Mode != null.Mode {
+		f.stat.Mode = s.Mode
+		f.stat.QID.Kind = uint8(s.Mode >> 24)
+	}
+	if s.GID != "" {
+		f.stat.GID = s.GID
+	}
+	if s.Mtime != null.Mtime {
+		f.stat.Mtime = s.Mtime
+	}
+	return nil
+}
+
+// resize returns data truncated or zero-extended to size n.
+func resize(data []byte, n int) []byte {
+	if n <= len(data) {
+		return data[:n:n]
+	}
+	return append(data, make([]byte, n-len(data))...)
+}
+
+// handle is an open file.
+type handle struct {
+	fsys *FS
+	f    *file
+	user string
+}
+
+func (h *handle) Close() error {
+	h.fsys.mu.Lock()
+	defer h.fsys.mu.Unlock()
+	h.f.opens--
+	return nil
+}
+
+func (h *handle) ReadAt(ctx context.Context, p []byte, off int64) (int, error) {
+	h.fsys.mu.Lock()
+	defer h.fsys.mu.Unlock()
+	if off < 0 {
+		return 0, errNegOffset
+	}
+	if off >= int64(len(h.f.data)) {
+		return 0, io.EOF
+	}
+	return copy(p, h.f.data[off:]), nil
+}
+
+func (h *handle) WriteAt(ctx context.Context, p []byte, off int64) (int, error) {
+	h.fsys.mu.Lock()
+	defer h.fsys.mu.Unlock()
+	f := h.f
+	if f.stat.Mode&ninep.ModeAppend != 0 {
+		off = int64(len(f.data))
+	}
+	if off < 0 {
+		return 0, errNegOffset
+	}
+	if off > maxFileSize-int64(len(p)) {
+		return 0, errTooBig
+	}
+	if end := off + int64(len(p)); end > int64(len(f.data)) {
+		f.data = resize(f.data, int(end))
+	}
+	copy(f.data[off:], p)
+	f.modified(h.user)
+	return len(p), nil
+}
+
+type dirHandle struct{ h *handle }
+
+func (d *dirHandle) Close() error { return d.h.Close() }
+
+func (d *dirHandle) ReadDir(ctx context.Context) ([]ninep.Stat, error) {
+	d.h.fsys.mu.Lock()
+	defer d.h.fsys.mu.Unlock()
+	var stats []ninep.Stat
+	for _, c := range d.h.f.children {
+		stats = append(stats, c.statLocked())
+	}
+	slices.SortFunc(stats, func(a, b ninep.Stat) int { return strings.Compare(a.Name, b.Name) })
+	return stats, nil
+}
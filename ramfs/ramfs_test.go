@@ -0,0 +1,335 @@
+package ramfs_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/ramfs"
+)
+
+var ctx = context.Background()
+
+// dial serves fsys on a pipe and attaches to it as uname with fid 0.
+func dial(t *testing.T, fsys *ramfs.FS, uname string) *ninep.ClientConn {
+	t.Helper()
+	srv := &ninep.Server{Files: fsys}
+	sc, cc := net.Pipe()
+	go srv.ServeConn(sc)
+	c, err := ninep.NewClientConn(cc, ninep.DialOpts{})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, err := c.Attach(ctx, 0, ^uint32(0), uname, ""); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	return c
+}
+
+// create creates name in the root directory as fid, opened with mode.
+func create(t *testing.T, c *ninep.ClientConn, fid uint32, name string, perm uint32, mode uint8) ninep.QID {
+	t.Helper()
+	if _, err := c.Walk(ctx, 0, fid, nil); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	qid, _, err := c.Create(ctx, fid, name, perm, mode)
+	if err != nil {
+		t.Fatalf("Create(%q): %v", name, err)
+	}
+	return qid
+}
+
+// open walks fid to name and opens it with mode.
+func open(c *ninep.ClientConn, fid uint32, name string, mode uint8) error {
+	if _, err := c.Walk(ctx, 0, fid, []string{name}); err != nil {
+		return err
+	}
+	if _, _, err := c.Open(ctx, fid, mode); err != nil {
+		c.Clunk(ctx, fid)
+		return err
+	}
+	return nil
+}
+
+func write(t *testing.T, c *ninep.ClientConn, fid uint32, off uint64, s string) {
+	t.Helper()
+	if n, err := c.Write(ctx, fid, off, []byte(s)); err != nil || int(n) != len(s) {
+		t.Fatalf("Write(%q) = %v, %v", s, n, err)
+	}
+}
+
+// contents reads the file name from the root directory.
+func contents(t *testing.T, c *ninep.ClientConn, name string) string {
+	t.Helper()
+	const fid = 99
+	if err := open(c, fid, name, ninep.ORead); err != nil {
+		t.Fatalf("open(%q): %v", name, err)
+	}
+	defer c.Clunk(ctx, fid)
+	buf := make([]byte, 1024)
+	n, err := c.Read(ctx, fid, 0, buf)
+	if err != nil {
+		t.Fatalf("Read(%q): %v", name, err)
+	}
+	return string(buf[:n])
+}
+
+func stat(t *testing.T, c *ninep.ClientConn, name string) ninep.Stat {
+	t.Helper()
+	const fid = 98
+	if _, err := c.Walk(ctx, 0, fid, []string{name}); err != nil {
+		t.Fatalf("Walk(%q): %v", name, err)
+	}
+	defer c.Clunk(ctx, fid)
+	st, err := c.Stat(ctx, fid)
+	if err != nil {
+		t.Fatalf("Stat(%q): %v", name, err)
+	}
+	return st
+}
+
+func exists(c *ninep.ClientConn, name string) bool {
+	const fid = 97
+	if _, err := c.Walk(ctx, 0, fid, []string{name}); err != nil {
+		return false
+	}
+	c.Clunk(ctx, fid)
+	return true
+}
+
+func TestCreateWriteRead(t *testing.T) {
+	c := dial(t, ramfs.New("glenda"), "glenda")
+	qid := create(t, c, 1, "a", 0o644, ninep.ORdWr)
+	write(t, c, 1, 0, "hello")
+	write(t, c, 1, 5, ", world")
+	write(t, c, 1, 0, "H")
+	if got, want := contents(t, c, "a"), "Hello, world"; got != want {
+		t.Errorf("contents = %q, want %q", got, want)
+	}
+	st := stat(t, c, "a")
+	if st.Length != 12 || st.Mode != 0o644 || st.UID != "glenda" || st.MUID != "glenda" {
+		t.Errorf("stat = %+v", st)
+	}
+	if st.QID.Path != qid.Path || st.QID.Vers != qid.Vers+3 {
+		t.Errorf("qid after three writes = %v, created with %v", st.QID, qid)
+	}
+
+	// The permissions are limited by the directory's.
+	if _, err := c.Walk(ctx, 0, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Create(ctx, 2, "d", ninep.ModeDir|0o700, ninep.ORead); err != nil {
+		t.Fatalf("Create(d): %v", err)
+	}
+	if _, err := c.Walk(ctx, 0, 5, []string{"d"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Create(ctx, 5, "x", 0o666, ninep.OWrite); err != nil {
+		t.Fatalf("Create(d/x): %v", err)
+	}
+	if _, err := c.Walk(ctx, 0, 3, []string{"d", "x"}); err != nil {
+		t.Fatalf("Walk(d/x): %v", err)
+	}
+	if st, _ := c.Stat(ctx, 3); st.Mode != 0o600 {
+		t.Errorf("d/x mode = %o, want %o", st.Mode, 0o600)
+	}
+
+	if _, err := c.Walk(ctx, 0, 4, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Create(ctx, 4, "a", 0o644, ninep.OWrite); err == nil {
+		t.Errorf("Create of existing file succeeded")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c := dial(t, ramfs.New("glenda"), "glenda")
+	create(t, c, 3, "d", ninep.ModeDir|0o755, ninep.ORead)
+	if _, err := c.Walk(ctx, 0, 1, []string{"d"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Create(ctx, 1, "f", 0o644, ninep.OWrite); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Walk(ctx, 0, 2, []string{"d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Remove(ctx, 2); err == nil || err.Error() != "directory not empty" {
+		t.Errorf("Remove(d) = %v, want %q", err, "directory not empty")
+	}
+	if err := c.Remove(ctx, 1); err != nil {
+		t.Errorf("Remove(d/f): %v", err)
+	}
+	if _, err := c.Walk(ctx, 0, 2, []string{"d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Remove(ctx, 2); err != nil {
+		t.Errorf("Remove(d): %v", err)
+	}
+	if exists(c, "d") {
+		t.Errorf("d exists after Remove")
+	}
+	if _, err := c.Walk(ctx, 0, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Remove(ctx, 2); err == nil {
+		t.Errorf("Remove of root succeeded")
+	}
+}
+
+func TestWstat(t *testing.T) {
+	fsys := ramfs.New("glenda")
+	c := dial(t, fsys, "glenda")
+	create(t, c, 1, "a", 0o644, ninep.OWrite)
+	write(t, c, 1, 0, "hello, world")
+	create(t, c, 2, "b", 0o644, ninep.OWrite)
+
+	wstat := func(fid uint32, f func(*ninep.Stat)) error {
+		s := ninep.NullStat()
+		f(&s)
+		return c.Wstat(ctx, fid, s)
+	}
+	if err := wstat(1, func(s *ninep.Stat) { s.Name = "b" }); err == nil {
+		t.Errorf("rename to existing file succeeded")
+	}
+	if err := wstat(1, func(s *ninep.Stat) { s.Name = "c"; s.Length = 5; s.Mode = 0o600; s.Mtime = 1234 }); err != nil {
+		t.Fatalf("Wstat: %v", err)
+	}
+	if exists(c, "a") || !exists(c, "c") {
+		t.Errorf("a was not renamed to c")
+	}
+	st := stat(t, c, "c")
+	if st.Length != 5 || st.Mode != 0o600 || st.Mtime != 1234 {
+		t.Errorf("stat after wstat = %+v", st)
+	}
+	if got, want := contents(t, c, "c"), "hello"; got != want {
+		t.Errorf("contents after truncate = %q, want %q", got, want)
+	}
+	if err := wstat(1, func(s *ninep.Stat) { s.Mode = ninep.ModeDir | 0o755 }); err == nil {
+		t.Errorf("setting the directory bit succeeded")
+	}
+	if err := wstat(1, func(s *ninep.Stat) { s.Length = 20; s.Name = "b" }); err == nil {
+		t.Errorf("Wstat with a forbidden change succeeded")
+	}
+	if st := stat(t, c, "c"); st.Length != 5 {
+		t.Errorf("failed Wstat changed length to %v", st.Length)
+	}
+
+	// Only the owner can change the mode.
+	other := dial(t, fsys, "bootes")
+	if _, err := other.Walk(ctx, 0, 1, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	s := ninep.NullStat()
+	s.Mode = 0o666
+	if err := other.Wstat(ctx, 1, s); err == nil {
+		t.Errorf("chmod by non-owner succeeded")
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	fsys := ramfs.New("glenda")
+	c := dial(t, fsys, "glenda")
+	create(t, c, 1, "private", 0o600, ninep.OWrite)
+	create(t, c, 2, "public", 0o644, ninep.OWrite)
+
+	other := dial(t, fsys, "bootes")
+	if err := open(other, 1, "private", ninep.ORead); err == nil {
+		t.Errorf("bootes could read private file")
+	}
+	if err := open(other, 1, "public", ninep.ORead); err != nil {
+		t.Errorf("bootes could not read public file: %v", err)
+	}
+	if err := open(other, 2, "public", ninep.OWrite); err == nil {
+		t.Errorf("bootes could write public file")
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	c := dial(t, ramfs.New("glenda"), "glenda")
+	create(t, c, 1, "lock", ninep.ModeExcl|0o644, ninep.OWrite)
+	if st := stat(t, c, "lock"); st.QID.Kind != ninep.QTEXCL {
+		t.Errorf("qid type = %#x, want QTEXCL", st.QID.Kind)
+	}
+	if err := open(c, 2, "lock", ninep.ORead); err == nil || err.Error() != "exclusive use file already open" {
+		t.Errorf("second open = %v, want exclusive use error", err)
+	}
+	c.Clunk(ctx, 1)
+	if err := open(c, 2, "lock", ninep.ORead); err != nil {
+		t.Errorf("open after clunk: %v", err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	c := dial(t, ramfs.New("glenda"), "glenda")
+	create(t, c, 1, "log", ninep.ModeAppend|0o644, ninep.OWrite)
+	write(t, c, 1, 0, "one\n")
+	write(t, c, 1, 0, "two\n")
+	if err := open(c, 2, "log", ninep.OWrite|ninep.OTrunc); err != nil {
+		t.Fatal(err)
+	}
+	write(t, c, 2, 0, "three\n")
+	if got, want := contents(t, c, "log"), "one\ntwo\nthree\n"; got != want {
+		t.Errorf("contents = %q, want %q", got, want)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	c := dial(t, ramfs.New("glenda"), "glenda")
+	create(t, c, 1, "a", 0o644, ninep.OWrite)
+	write(t, c, 1, 0, "hello")
+	if err := open(c, 2, "a", ninep.OWrite|ninep.OTrunc); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(t, c, "a"); got != "" {
+		t.Errorf("contents after OTRUNC = %q, want empty", got)
+	}
+}
+
+func TestRemoveOnClose(t *testing.T) {
+	c := dial(t, ramfs.New("glenda"), "glenda")
+	create(t, c, 1, "tmp", 0o644, ninep.OWrite|ninep.ORClose)
+	create(t, c, 2, "keep", 0o644, ninep.OWrite)
+	if err := open(c, 3, "keep", ninep.ORead|ninep.ORClose); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(c, "tmp") {
+		t.Fatalf("tmp does not exist before clunk")
+	}
+	for fid := range uint32(3) {
+		if err := c.Clunk(ctx, fid+1); err != nil {
+			t.Errorf("Clunk: %v", err)
+		}
+	}
+	if exists(c, "tmp") || exists(c, "keep") {
+		t.Errorf("files opened with ORCLOSE exist after clunk")
+	}
+}
+
+// Offsets and lengths which do not fit into a file are rejected,
+// instead of crashing the server or exhausting its memory.
+func TestHugeOffsets(t *testing.T) {
+	c := dial(t, ramfs.New("glenda"), "glenda")
+	create(t, c, 1, "a", 0o644, ninep.ORdWr)
+	write(t, c, 1, 0, "hello")
+
+	if _, err := c.Read(ctx, 1, 1<<63, make([]byte, 10)); err == nil {
+		t.Errorf("Read at offset 2^63 succeeded")
+	}
+	if _, err := c.Write(ctx, 1, 1<<63, []byte("x")); err == nil {
+		t.Errorf("Write at offset 2^63 succeeded")
+	}
+	if _, err := c.Write(ctx, 1, 1<<62, []byte("x")); err == nil {
+		t.Errorf("Write at offset 2^62 succeeded")
+	}
+	s := ninep.NullStat()
+	s.Length = 1 << 62
+	if err := c.Wstat(ctx, 1, s); err == nil {
+		t.Errorf("Wstat with length 2^62 succeeded")
+	}
+	if got, want := contents(t, c, "a"), "hello"; got != want {
+		t.Errorf("contents = %q, want %q", got, want)
+	}
+}
@@ -5,11 +5,38 @@ import (
 	"io"
 )
 
+// checkLen returns an error if fewer than n bytes are left to read
+// from r.  This is used to bound allocations based on length fields
+// read from the wire by the size of the surrounding message.
+//
+// Readers which don't know their remaining length are not checked.
+func checkLen(r io.Reader, n int64) error {
+	if left := remaining(r); left >= 0 && n > left {
+		return errLengthExceedsMsg
+	}
+	return nil
+}
+
+// remaining returns the number of bytes left to read from r,
+// or -1 if r does not know its remaining length.
+func remaining(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *io.LimitedReader:
+		return r.N
+	case interface{ Len() int }:
+		return int64(r.Len())
+	}
+	return -1
+}
+
 func readString(r io.Reader, s *string) error {
 	var sz uint16
 	if err := binary.Read(r, binary.LittleEndian, &sz); err != nil {
 		return err
 	}
+	if err := checkLen(r, int64(sz)); err != nil {
+		return err
+	}
 	buf := make([]byte, sz)
 	if err := binary.Read(r, binary.LittleEndian, &buf); err != nil {
 		return err
@@ -19,12 +46,16 @@ func readString(r io.Reader, s *string) error {
 }
 
 func readStringSlice(r io.Reader, ss *[]string) error {
-	var size int16
+	var size uint16
 	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
 		return err
 	}
+	// Every string takes at least 2 bytes for its size.
+	if err := checkLen(r, 2*int64(size)); err != nil {
+		return err
+	}
 	*ss = make([]string, 0, size)
-	for i := int16(0); i < size; i++ {
+	for i := uint16(0); i < size; i++ {
 		var s string
 		if err := readString(r, &s); err != nil {
 			return err
@@ -39,6 +70,9 @@ func readQIDSlice(r io.Reader, qs *[]QID) error {
 	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
 		return err
 	}
+	if err := checkLen(r, 13*int64(size)); err != nil {
+		return err
+	}
 	*qs = make([]QID, 0, size)
 	for i := uint16(0); i < size; i++ {
 		var q QID
@@ -54,24 +88,17 @@ func readQID(r io.Reader, q *QID) error {
 	return binary.Read(r, binary.LittleEndian, q)
 }
 
-// Note: This *populates* a byte slice passed in from the outside.
-func readAndFillByteSlice(r io.Reader, bs []byte) (uint32, error) {
+func readByteSlice(r io.Reader, bs *[]byte) error {
 	var size uint32
 	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
-		return 0, err
-	}
-	n := size
-	if n > uint32(len(bs)) {
-		n = uint32(len(bs))
-	}
-	bs = bs[:n]
-	if _, err := io.ReadFull(r, bs); err != nil {
-		return 0, err
+		return err
 	}
-	if err := skip(r, int(size-n)); err != nil {
-		return 0, err
+	if err := checkLen(r, int64(size)); err != nil {
+		return err
 	}
-	return n, nil
+	*bs = make([]byte, size)
+	_, err := io.ReadFull(r, *bs)
+	return err
 }
 
 func readUint8(r io.Reader, out *uint8) error {
@@ -0,0 +1,909 @@
+package ninep
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileServer is a file tree served by a Server.
+type FileServer interface {
+	// Attach returns the root of the file tree aname, as accessed by
+	// the user uname.
+	Attach(ctx context.Context, uname, aname string) (Node, error)
+}
+
+// Node is a file or directory of a FileServer.  The Server refers to
+// nodes with fids.
+//
+// Nodes may implement Creator, Remover and Wstater to support the
+// corresponding requests.
+type Node interface {
+	// Stat returns the node's metadata.  Stat.QID identifies the node.
+	Stat(ctx context.Context) (Stat, error)
+	// Walk returns the directory entry called name.  It is only
+	// called on directories, and never with "." or "..", which are
+	// resolved by the Server.
+	Walk(ctx context.Context, name string) (Node, error)
+	// Open opens the node for I/O, with mode as in Topen.  The
+	// returned handle must implement FileHandle, or DirHandle for
+	// directories.
+	Open(ctx context.Context, mode uint8) (Handle, error)
+}
+
+// Creator is implemented by directories in which files can be created.
+type Creator interface {
+	// Create creates the file name in the directory with permissions
+	// and mode as in Tcreate, and opens it.
+	Create(ctx context.Context, name string, perm uint32, mode uint8) (Node, Handle, error)
+}
+
+// Remover is implemented by nodes which can be removed.
+type Remover interface {
+	Remove(ctx context.Context) error
+}
+
+// Wstater is implemented by nodes whose metadata can be changed.
+type Wstater interface {
+	// Wstat changes the metadata as in Twstat.  Fields which are
+	// not to be changed are set to their maximum value, or are
+	// empty for strings.
+	Wstat(ctx context.Context, s Stat) error
+}
+
+// Handle is an open node.
+type Handle interface {
+	Close() error
+}
+
+// FileHandle is a Handle of a file.
+//
+// ReadAt may block until data is available, for example for event
+// files.  Each request runs in its own goroutine, and its context is
+// canceled when the client flushes the request or the connection ends.
+// A flushed request which fails with the context's error is not
+// answered; one which completes anyway is.
+type FileHandle interface {
+	Handle
+	ReadAt(ctx context.Context, p []byte, off int64) (int, error)
+	WriteAt(ctx context.Context, p []byte, off int64) (int, error)
+}
+
+// DirHandle is a Handle of a directory.
+type DirHandle interface {
+	Handle
+	// ReadDir returns the directory entries.  It is called when
+	// reading the directory from offset 0.
+	ReadDir(ctx context.Context) ([]Stat, error)
+}
+
+// ConnInfo describes the connection on which a request arrived.
+type ConnInfo struct {
+	RemoteAddr net.Addr
+	// TLS is the state of the TLS connection, or nil if the
+	// connection does not use TLS.
+	TLS *tls.ConnectionState
+}
+
+type connInfoKey struct{}
+
+// ConnInfoFromContext returns information about the connection, in
+// the context passed to FileServer and Node methods.  It returns nil
+// for other contexts.
+func ConnInfoFromContext(ctx context.Context) *ConnInfo {
+	info, _ := ctx.Value(connInfoKey{}).(*ConnInfo)
+	return info
+}
+
+// DefaultMsize is the maximum message size of a Server, unless
+// configured differently.
+const DefaultMsize = 64 << 10
+
+// ioHdrSize is the size of the header of read and write messages, to
+// be subtracted from msize to get the maximum payload.
+const ioHdrSize = 24
+
+// Server serves a FileServer over 9P connections.
+type Server struct {
+	// Files is the file tree to serve.
+	Files FileServer
+
+	// Msize is the maximum message size; zero means DefaultMsize.
+	Msize uint32
+
+	// Auth, if non-nil, authenticates users before they can attach.
+	// If it is nil, Tauth is answered with the error
+	// "authentication not required".
+	Auth Auth
+
+	// TLSConfig, if non-nil, makes Serve and ListenAndServe accept
+	// TLS connections only.  To authenticate clients with
+	// certificates, set its ClientAuth and ClientCAs, and check
+	// ConnInfo.TLS in the FileServer.
+	TLSConfig *tls.Config
+
+	// Logger, if non-nil, receives a debug-level record for every
+	// message received and sent.
+	Logger *slog.Logger
+}
+
+// ListenAndServe listens on addr and serves connections.  The
+// address is one understood by ListenNet, or a dial string
+// "tls!host!port", which requires TLSConfig to be set.
+func (s *Server) ListenAndServe(addr string) error {
+	if rest, ok := strings.CutPrefix(addr, "tls!"); ok {
+		if s.TLSConfig == nil {
+			return errors.New("9p server: tls address without TLSConfig")
+		}
+		addr = "tcp!" + rest
+	}
+	l, err := ListenNet(addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l and serves each of them, until
+// accepting fails.
+func (s *Server) Serve(l net.Listener) error {
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves 9P on conn until the connection is closed.  TLS
+// connections are passed as *tls.Conn.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+	info := &ConnInfo{RemoteAddr: conn.RemoteAddr()}
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return fmt.Errorf("9p server: %w", err)
+		}
+		state := tc.ConnectionState()
+		info.TLS = &state
+	}
+	msize := s.Msize
+	if msize == 0 {
+		msize = DefaultMsize
+	}
+	c := &serverConn{
+		srv:      s,
+		conn:     conn,
+		ctx:      context.WithValue(context.Background(), connInfoKey{}, info),
+		maxMsize: msize,
+		msize:    msize,
+		fids:     make(map[uint32]*serverFid),
+		pending:  make(map[uint16]*serverReq),
+	}
+	defer c.close()
+	for {
+		m, err := readMessage(conn, c.maxMsize)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+				return nil
+			}
+			return fmt.Errorf("9p server: %w", err)
+		}
+		if v, ok := m.(*Tversion); ok {
+			// Version negotiation aborts everything in progress.
+			c.abortAll()
+			c.wg.Wait()
+			c.reply(m, c.version(v), time.Now(), nil)
+			continue
+		}
+		req := c.start(m)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			start := time.Now()
+			logRequest(req.ctx, c.srv.Logger, m)
+			resp := c.safeDispatch(req.ctx, m)
+			c.reply(m, resp, start, req.flushed)
+			c.finish(m.MessageTag(), req)
+		}()
+	}
+}
+
+type serverConn struct {
+	srv      *Server
+	conn     net.Conn
+	ctx      context.Context
+	maxMsize uint32
+	msize    uint32 // Negotiated; only changed while no requests run.
+
+	wmu sync.Mutex // Write mutex.
+	wg  sync.WaitGroup
+
+	mu      sync.Mutex
+	fids    map[uint32]*serverFid
+	pending map[uint16]*serverReq // Requests in progress, by tag.
+
+	authPath atomic.Uint64 // Qid paths of auth fids.
+}
+
+// serverReq is a request in progress.
+type serverReq struct {
+	ctx     context.Context // Canceled when flushed.
+	cancel  context.CancelFunc
+	flushed chan struct{} // Closed when flushed.
+	done    chan struct{} // Closed when replied or abandoned.
+
+	// Guarded by serverConn.mu.
+	isFlushed bool
+	isDone    bool
+	lastFlush *serverReq // The latest Tflush of this request.
+	flushes   *serverReq // For a Tflush, the request it flushes,
+	flushTag  uint16     // its tag,
+	prevFlush *serverReq // and the Tflush of it before this one.
+}
+
+// start registers the request m as in progress.  A Tflush takes
+// effect here, as it arrives, so that Tflushes of the same request are
+// ordered as they were received.
+func (c *serverConn) start(m Message) *serverReq {
+	ctx, cancel := context.WithCancel(c.ctx)
+	req := &serverReq{
+		ctx:     ctx,
+		cancel:  cancel,
+		flushed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[m.MessageTag()] = req
+	if f, ok := m.(*Tflush); ok && f.OldTag != f.Tag {
+		if old, ok := c.pending[f.OldTag]; ok {
+			req.flushes, req.flushTag = old, f.OldTag
+			req.prevFlush = old.lastFlush
+			old.lastFlush = req
+			old.abort()
+		}
+	}
+	return req
+}
+
+// finish marks the request req with the given tag as done, after its
+// reply was sent or abandoned.
+func (c *serverConn) finish(tag uint16, req *serverReq) {
+	req.cancel()
+	c.mu.Lock()
+	req.isDone = true
+	c.release(tag, req)
+	if req.flushes != nil {
+		c.release(req.flushTag, req.flushes)
+	}
+	c.mu.Unlock()
+	close(req.done)
+}
+
+// release unregisters the request req with the given tag, once it
+// and its latest Tflush are done.  Flushed requests stay registered
+// until then, so that further Tflushes of the same tag are answered
+// after the earlier ones.  c.mu must be held.
+func (c *serverConn) release(tag uint16, req *serverReq) {
+	if c.pending[tag] != req || !req.isDone {
+		return
+	}
+	if req.lastFlush != nil && !req.lastFlush.isDone {
+		return
+	}
+	delete(c.pending, tag)
+}
+
+// abort flushes req, without waiting for it.  c.mu must be held.
+func (req *serverReq) abort() {
+	if !req.isFlushed {
+		req.isFlushed = true
+		close(req.flushed)
+		req.cancel()
+	}
+}
+
+// flush waits until the request flushed by the Tflush with the given
+// tag and all earlier Tflushes of it are finished, so that their
+// replies, if any, precede the Rflush.  If the Tflush is flushed itself
+// while waiting, it stops waiting and returns false.
+func (c *serverConn) flush(ctx context.Context, tag uint16) bool {
+	c.mu.Lock()
+	self := c.pending[tag]
+	c.mu.Unlock()
+	if self == nil {
+		return true // The tag was reused by the client.
+	}
+	for _, r := range []*serverReq{self.flushes, self.prevFlush} {
+		if r == nil {
+			continue
+		}
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// abortAll flushes all requests in progress, without waiting for them.
+func (c *serverConn) abortAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, req := range c.pending {
+		req.abort()
+	}
+}
+
+// serverFid is the state of a fid.  Auth fids have a conversation
+// instead of a path.
+type serverFid struct {
+	mu     sync.Mutex
+	user   string // Authenticated user, see UserFromContext.
+	auth   AuthConv
+	uname  string // User and tree of an auth fid.
+	aname  string
+	path   []Node // Nodes from the attach root to the current node.
+	qid    QID
+	handle Handle // Set when opened.
+	mode   uint8
+
+	dir       []Stat // Directory entries not read yet.
+	dirOffset uint64 // Offset of the next directory read.
+}
+
+func (f *serverFid) node() Node { return f.path[len(f.path)-1] }
+
+// Error messages, as used by Plan 9.
+var (
+	errBadFid      = errors.New("unknown fid")
+	errFidInUse    = errors.New("fid already in use")
+	errNotDir      = errors.New("not a directory")
+	errIsDir       = errors.New("is a directory")
+	errNotOpen     = errors.New("fid not open")
+	errOpen        = errors.New("fid already open")
+	errBadOffset   = errors.New("bad offset in directory read")
+	errNegOffset   = errors.New("negative i/o offset")
+	errInternal    = errors.New("internal server error")
+	errPerm        = errors.New("permission denied")
+	errBadName     = errors.New("bad file name")
+	errNoAuth      = errors.New("authentication not required")
+	errNoCreate    = errors.New("create prohibited")
+	errNoRemove    = errors.New("remove prohibited")
+	errNoWstat     = errors.New("wstat prohibited")
+	errShortCount  = errors.New("read count too small for directory entry")
+	errTooManyElem = errors.New("too many names in walk")
+)
+
+func (c *serverConn) close() {
+	c.abortAll()
+	c.wg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.fids {
+		f.clunk(c.ctx)
+	}
+	clear(c.fids)
+}
+
+// interrupted is the reply of a request which gave up because its
+// context was canceled.
+type interrupted struct{ Message }
+
+// reply sends resp as the reply to req.  If req was flushed and gave
+// up because of it, the reply is left out.  Flushed requests which
+// completed anyway are answered, as in lib9p, so that the client
+// learns about their effects; the Rflush follows their reply.
+func (c *serverConn) reply(req, resp Message, start time.Time, flushed <-chan struct{}) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if r, ok := resp.(interrupted); ok {
+		select {
+		case <-flushed:
+			return
+		default:
+		}
+		resp = r.Message
+	}
+	resp.setTag(req.MessageTag())
+	logReply(c.ctx, c.srv.Logger, req, resp, time.Since(start))
+	WriteMessage(c.conn, resp)
+}
+
+func (c *serverConn) version(m *Tversion) Message {
+	c.mu.Lock()
+	for _, f := range c.fids {
+		f.clunk(c.ctx)
+	}
+	clear(c.fids)
+	c.mu.Unlock()
+	c.msize = min(m.Msize, c.maxMsize)
+	if !strings.HasPrefix(m.Version, "9P2000") {
+		return &Rversion{Msize: c.msize, Version: "unknown"}
+	}
+	return &Rversion{Msize: c.msize, Version: "9P2000"}
+}
+
+func (c *serverConn) fid(fid uint32) (*serverFid, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.fids[fid]
+	if !ok {
+		return nil, errBadFid
+	}
+	return f, nil
+}
+
+func (c *serverConn) newFid(fid uint32, f *serverFid) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.fids[fid]; ok {
+		return errFidInUse
+	}
+	c.fids[fid] = f
+	return nil
+}
+
+// nodeFid returns the fid, which must not be an auth fid.
+func (c *serverConn) nodeFid(fid uint32) (*serverFid, error) {
+	f, err := c.fid(fid)
+	if err != nil {
+		return nil, err
+	}
+	if f.auth != nil {
+		return nil, errBadUse
+	}
+	return f, nil
+}
+
+// removeFid removes the fid from the table and returns it.
+func (c *serverConn) removeFid(fid uint32) (*serverFid, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.fids[fid]
+	if !ok {
+		return nil, errBadFid
+	}
+	delete(c.fids, fid)
+	return f, nil
+}
+
+func (c *serverConn) iounit() uint32 {
+	return c.msize - ioHdrSize
+}
+
+func rerror(err error) Message {
+	if errors.Is(err, context.Canceled) {
+		return interrupted{&Rerror{Ename: err.Error()}}
+	}
+	return &Rerror{Ename: err.Error()}
+}
+
+// safeDispatch is dispatch, but turns panics into Rerror replies, so
+// that a bug in a FileServer does not bring down the server.
+func (c *serverConn) safeDispatch(ctx context.Context, m Message) (resp Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			if c.srv.Logger != nil {
+				c.srv.Logger.ErrorContext(ctx, "9p server: panic serving request",
+					"type", m.Type().String(), "panic", r, "stack", string(debug.Stack()))
+			}
+			resp = rerror(errInternal)
+		}
+	}()
+	return c.dispatch(ctx, m)
+}
+
+func (c *serverConn) dispatch(ctx context.Context, m Message) Message {
+	if fid, ok := MessageFID(m); ok {
+		if f, err := c.fid(fid); err == nil && f.user != "" {
+			ctx = context.WithValue(ctx, userKey{}, f.user)
+		}
+	}
+	switch m := m.(type) {
+	case *Tauth:
+		if c.srv.Auth == nil {
+			return rerror(errNoAuth)
+		}
+		conv, err := c.srv.Auth.Start(ctx, m.Uname, m.Aname)
+		if err != nil {
+			return rerror(err)
+		}
+		f := &serverFid{auth: conv, uname: m.Uname, aname: m.Aname}
+		if err := c.newFid(m.AFID, f); err != nil {
+			conv.Close()
+			return rerror(err)
+		}
+		return &Rauth{AQID: QID{Kind: QTAUTH, Path: c.authPath.Add(1)}}
+
+	case *Tflush:
+		if !c.flush(ctx, m.MessageTag()) {
+			return interrupted{&Rflush{}}
+		}
+		return &Rflush{}
+
+	case *Tattach:
+		user, err := c.attachUser(m)
+		if err != nil {
+			return rerror(err)
+		}
+		if user != "" {
+			ctx = context.WithValue(ctx, userKey{}, user)
+		}
+		root, err := c.srv.Files.Attach(ctx, m.Uname, m.Aname)
+		if err != nil {
+			return rerror(err)
+		}
+		st, err := root.Stat(ctx)
+		if err != nil {
+			return rerror(err)
+		}
+		if err := c.newFid(m.FID, &serverFid{user: user, path: []Node{root}, qid: st.QID}); err != nil {
+			return rerror(err)
+		}
+		return &Rattach{QID: st.QID}
+
+	case *Twalk:
+		return c.walk(ctx, m)
+
+	case *Topen:
+		f, err := c.nodeFid(m.FID)
+		if err != nil {
+			return rerror(err)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.handle != nil {
+			return rerror(errOpen)
+		}
+		if f.qid.IsDirectory() && (m.Mode&3 == OWrite || m.Mode&3 == ORdWr || m.Mode&OTrunc != 0) {
+			return rerror(errIsDir)
+		}
+		h, err := f.node().Open(ctx, m.Mode)
+		if err != nil {
+			return rerror(err)
+		}
+		if st, err := f.node().Stat(ctx); err == nil {
+			f.qid = st.QID
+		}
+		f.handle, f.mode = h, m.Mode
+		return &Ropen{QID: f.qid, IOUnit: c.iounit()}
+
+	case *Tcreate:
+		f, err := c.nodeFid(m.FID)
+		if err != nil {
+			return rerror(err)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.handle != nil {
+			return rerror(errOpen)
+		}
+		if !f.qid.IsDirectory() {
+			return rerror(errNotDir)
+		}
+		if m.Name == "" || m.Name == "." || m.Name == ".." || strings.Contains(m.Name, "/") {
+			return rerror(errBadName)
+		}
+		cr, ok := f.node().(Creator)
+		if !ok {
+			return rerror(errNoCreate)
+		}
+		n, h, err := cr.Create(ctx, m.Name, m.Perm, m.Mode)
+		if err != nil {
+			return rerror(err)
+		}
+		st, err := n.Stat(ctx)
+		if err != nil {
+			h.Close()
+			return rerror(err)
+		}
+		f.path = append(f.path, n)
+		f.qid, f.handle, f.mode = st.QID, h, m.Mode
+		return &Rcreate{QID: f.qid, IOUnit: c.iounit()}
+
+	case *Tread:
+		return c.read(ctx, m)
+
+	case *Twrite:
+		f, err := c.fid(m.FID)
+		if err != nil {
+			return rerror(err)
+		}
+		if f.auth != nil {
+			n, err := f.auth.Write(ctx, m.Data)
+			if err != nil {
+				return rerror(err)
+			}
+			return &Rwrite{Count: uint32(n)}
+		}
+		f.mu.Lock()
+		h, mode := f.handle, f.mode
+		f.mu.Unlock()
+		if h == nil {
+			return rerror(errNotOpen)
+		}
+		if mode&3 != OWrite && mode&3 != ORdWr {
+			return rerror(errPerm)
+		}
+		fh, ok := h.(FileHandle)
+		if !ok {
+			return rerror(errIsDir)
+		}
+		if m.Offset > math.MaxInt64 {
+			return rerror(errNegOffset)
+		}
+		n, err := fh.WriteAt(ctx, m.Data, int64(m.Offset))
+		if err != nil && n == 0 {
+			return rerror(err)
+		}
+		return &Rwrite{Count: uint32(n)}
+
+	case *Tclunk:
+		f, err := c.removeFid(m.FID)
+		if err != nil {
+			return rerror(err)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if err := f.clunk(ctx); err != nil {
+			return rerror(err)
+		}
+		return &Rclunk{}
+
+	case *Tremove:
+		// The fid is clunked even if the removal fails.
+		f, err := c.removeFid(m.FID)
+		if err != nil {
+			return rerror(err)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.mode &^= ORClose // Removed below.
+		f.clunk(ctx)
+		if f.auth != nil {
+			return rerror(errBadUse)
+		}
+		r, ok := f.node().(Remover)
+		if !ok || len(f.path) == 1 {
+			return rerror(errNoRemove)
+		}
+		if err := r.Remove(ctx); err != nil {
+			return rerror(err)
+		}
+		return &Rremove{}
+
+	case *Tstat:
+		f, err := c.nodeFid(m.FID)
+		if err != nil {
+			return rerror(err)
+		}
+		st, err := f.node().Stat(ctx)
+		if err != nil {
+			return rerror(err)
+		}
+		return &Rstat{Stat: st}
+
+	case *Twstat:
+		f, err := c.nodeFid(m.FID)
+		if err != nil {
+			return rerror(err)
+		}
+		w, ok := f.node().(Wstater)
+		if !ok {
+			return rerror(errNoWstat)
+		}
+		if strings.Contains(m.Stat.Name, "/") || m.Stat.Name == "." || m.Stat.Name == ".." {
+			return rerror(errBadName)
+		}
+		if err := w.Wstat(ctx, m.Stat); err != nil {
+			return rerror(err)
+		}
+		return &Rwstat{}
+	}
+	return rerror(errUnexpectedMsg)
+}
+
+// clunk closes the fid's handle or auth conversation, and removes
+// the file if it was opened with ORCLOSE.
+func (f *serverFid) clunk(ctx context.Context) error {
+	if f.auth != nil {
+		return f.auth.Close()
+	}
+	if f.handle == nil {
+		return nil
+	}
+	h := f.handle
+	f.handle = nil
+	err := h.Close()
+	if r, ok := f.node().(Remover); ok && f.mode&ORClose != 0 && len(f.path) > 1 {
+		if rerr := r.Remove(ctx); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// attachUser returns the user authenticated by the auth fid of a
+// Tattach, or the empty string if the server does not authenticate.
+func (c *serverConn) attachUser(m *Tattach) (string, error) {
+	if c.srv.Auth == nil {
+		if m.AFID != nofid {
+			return "", errNoAuth
+		}
+		return "", nil
+	}
+	if m.AFID == nofid {
+		return "", errAuthRequired
+	}
+	af, err := c.fid(m.AFID)
+	if err != nil {
+		return "", err
+	}
+	if af.auth == nil {
+		return "", errNotAuthFid
+	}
+	if af.uname != m.Uname || af.aname != m.Aname {
+		return "", errAuthFailed
+	}
+	return af.auth.User()
+}
+
+func (c *serverConn) walk(ctx context.Context, m *Twalk) Message {
+	if len(m.Wnames) > maxWalkElem {
+		return rerror(errTooManyElem)
+	}
+	f, err := c.nodeFid(m.FID)
+	if err != nil {
+		return rerror(err)
+	}
+	f.mu.Lock()
+	if f.handle != nil {
+		f.mu.Unlock()
+		return rerror(errOpen)
+	}
+	path, qid := slices.Clone(f.path), f.qid
+	f.mu.Unlock()
+
+	qids := []QID{}
+	for _, name := range m.Wnames {
+		if !qid.IsDirectory() {
+			err = errNotDir
+			break
+		}
+		switch {
+		case name == ".":
+		case name == "..":
+			if len(path) > 1 {
+				path = path[:len(path)-1]
+			}
+		case name == "" || strings.Contains(name, "/"):
+			err = errBadName
+		default:
+			var n Node
+			if n, err = path[len(path)-1].Walk(ctx, name); err == nil {
+				path = append(path, n)
+			}
+		}
+		if err != nil {
+			break
+		}
+		var st Stat
+		if st, err = path[len(path)-1].Stat(ctx); err != nil {
+			break
+		}
+		qid = st.QID
+		qids = append(qids, qid)
+	}
+	if len(qids) < len(m.Wnames) {
+		if len(qids) == 0 {
+			return rerror(err)
+		}
+		return &Rwalk{QIDs: qids}
+	}
+
+	if m.NewFID == m.FID {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.handle != nil {
+			return rerror(errOpen)
+		}
+		f.path, f.qid = path, qid
+	} else if err := c.newFid(m.NewFID, &serverFid{user: f.user, path: path, qid: qid}); err != nil {
+		return rerror(err)
+	}
+	return &Rwalk{QIDs: qids}
+}
+
+func (c *serverConn) read(ctx context.Context, m *Tread) Message {
+	f, err := c.fid(m.FID)
+	if err != nil {
+		return rerror(err)
+	}
+	if f.auth != nil {
+		buf := make([]byte, min(m.Count, c.iounit()))
+		n, err := f.auth.Read(ctx, buf)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return rerror(err)
+		}
+		return &Rread{Data: buf[:n]}
+	}
+	f.mu.Lock()
+	h, mode := f.handle, f.mode
+	f.mu.Unlock()
+	if h == nil {
+		return rerror(errNotOpen)
+	}
+	if mode&3 == OWrite {
+		return rerror(errPerm)
+	}
+	count := min(m.Count, c.iounit())
+	if dh, ok := h.(DirHandle); ok {
+		return c.readDir(ctx, f, dh, m.Offset, count)
+	}
+	fh, ok := h.(FileHandle)
+	if !ok {
+		return rerror(errPerm)
+	}
+	if m.Offset > math.MaxInt64 {
+		return rerror(errNegOffset)
+	}
+	buf := make([]byte, count)
+	n, err := fh.ReadAt(ctx, buf, int64(m.Offset))
+	if err != nil && !errors.Is(err, io.EOF) && n == 0 {
+		return rerror(err)
+	}
+	return &Rread{Data: buf[:n]}
+}
+
+// readDir returns as many directory entries as fit into count bytes.
+// Directory reads must start at offset 0 or continue where the
+// previous read ended.
+func (c *serverConn) readDir(ctx context.Context, f *serverFid, dh DirHandle, offset uint64, count uint32) Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if offset == 0 {
+		entries, err := dh.ReadDir(ctx)
+		if err != nil {
+			return rerror(err)
+		}
+		f.dir, f.dirOffset = entries, 0
+	} else if offset != f.dirOffset {
+		return rerror(errBadOffset)
+	}
+	data := []byte{}
+	for len(f.dir) > 0 {
+		buf, err := f.dir[0].MarshalBinary()
+		if err != nil {
+			return rerror(err)
+		}
+		if len(data)+len(buf) > int(count) {
+			if len(data) == 0 {
+				return rerror(errShortCount)
+			}
+			break
+		}
+		data = append(data, buf...)
+		f.dir = f.dir[1:]
+	}
+	f.dirOffset += uint64(len(data))
+	return &Rread{Data: data}
+}
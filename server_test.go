@@ -0,0 +1,776 @@
+package ninep_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gnoack/ninep"
+)
+
+// memNode is a file or directory in a read-only test file tree.
+// The contents of files are computed on open.
+type memNode struct {
+	stat     ninep.Stat
+	children []*memNode
+	contents func(ctx context.Context) string
+}
+
+func memDir(name string, path uint64, children ...*memNode) *memNode {
+	return &memNode{
+		stat: ninep.Stat{
+			QID:  ninep.QID{Kind: ninep.QTDIR, Path: path},
+			Mode: ninep.ModeDir | 0o555,
+			Name: name, UID: "glenda", GID: "glenda", MUID: "glenda",
+		},
+		children: children,
+	}
+}
+
+func memFile(name string, path uint64, contents func(ctx context.Context) string) *memNode {
+	return &memNode{
+		stat: ninep.Stat{
+			QID:  ninep.QID{Kind: ninep.QTFILE, Path: path},
+			Mode: 0o444,
+			Name: name, UID: "glenda", GID: "glenda", MUID: "glenda",
+		},
+		contents: contents,
+	}
+}
+
+func (n *memNode) Attach(ctx context.Context, uname, aname string) (ninep.Node, error) {
+	return n, nil
+}
+
+func (n *memNode) Stat(ctx context.Context) (ninep.Stat, error) { return n.stat, nil }
+
+func (n *memNode) Walk(ctx context.Context, name string) (ninep.Node, error) {
+	for _, c := range n.children {
+		if c.stat.Name == name {
+			return c, nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (n *memNode) Open(ctx context.Context, mode uint8) (ninep.Handle, error) {
+	if mode&3 != ninep.ORead {
+		return nil, fs.ErrPermission
+	}
+	if n.contents == nil {
+		return memDirHandle{n}, nil
+	}
+	return memFileHandle{strings.NewReader(n.contents(ctx))}, nil
+}
+
+type memDirHandle struct{ n *memNode }
+
+func (h memDirHandle) Close() error { return nil }
+
+func (h memDirHandle) ReadDir(ctx context.Context) ([]ninep.Stat, error) {
+	var stats []ninep.Stat
+	for _, c := range h.n.children {
+		stats = append(stats, c.stat)
+	}
+	return stats, nil
+}
+
+type memFileHandle struct{ r *strings.Reader }
+
+func (h memFileHandle) Close() error { return nil }
+
+func (h memFileHandle) ReadAt(ctx context.Context, p []byte, off int64) (int, error) {
+	return h.r.ReadAt(p, off)
+}
+
+func (h memFileHandle) WriteAt(ctx context.Context, p []byte, off int64) (int, error) {
+	return 0, fs.ErrPermission
+}
+
+// peerName returns the common name of the client certificate.
+func peerName(ctx context.Context) string {
+	info := ninep.ConnInfoFromContext(ctx)
+	if info == nil || info.TLS == nil || len(info.TLS.PeerCertificates) == 0 {
+		return "anonymous"
+	}
+	return info.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func testTree() *memNode {
+	return memDir("/", 1,
+		memFile("hello", 2, func(context.Context) string { return "hello, world\n" }),
+		memFile("whoami", 3, peerName),
+		memFile("user", 6, ninep.UserFromContext),
+		memDir("lib", 4,
+			memFile("motd", 5, func(context.Context) string { return "welcome\n" }),
+		),
+	)
+}
+
+// serve serves srv on a local TCP port and returns its address.
+func serve(t *testing.T, srv *ninep.Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go srv.Serve(l)
+	return l.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	host, port, _ := net.SplitHostPort(serve(t, &ninep.Server{Files: testTree()}))
+	service := "tcp!" + host + "!" + port
+	fsys, err := ninep.DialFS(service, ninep.DialFSOpts{})
+	if err != nil {
+		t.Fatalf("DialFS: %v", err)
+	}
+	defer fsys.Close()
+
+	for name, want := range map[string]string{
+		"hello":    "hello, world\n",
+		"whoami":   "anonymous",
+		"lib/motd": "welcome\n",
+	} {
+		got, err := fs.ReadFile(fsys, name)
+		if err != nil || string(got) != want {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := fs.ReadFile(fsys, "nope"); err == nil {
+		t.Errorf("ReadFile(%q) succeeded, want error", "nope")
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"hello", "lib", "user", "whoami"}; !slices.Equal(names, want) {
+		t.Errorf("ReadDir = %q, want %q", names, want)
+	}
+
+	// Walking to ".." goes up, but not beyond the root, and "." stays.
+	cc, err := ninep.Dial(service, ninep.DialOpts{})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer cc.Close()
+	ctx := context.Background()
+	if _, err := cc.Attach(ctx, 1, ^uint32(0), "glenda", ""); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	qids, err := cc.Walk(ctx, 1, 2, []string{"lib", "..", "..", "lib", ".", "motd"})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	var paths []uint64
+	for _, q := range qids {
+		paths = append(paths, q.Path)
+	}
+	if want := []uint64{4, 1, 1, 4, 4, 5}; !slices.Equal(paths, want) {
+		t.Errorf("Walk: got qid paths %v, want %v", paths, want)
+	}
+
+	// Walks of more than 16 names are rejected, as in walk(5).
+	dots := strings.Split(strings.Repeat(".", 17), "")
+	if _, err := cc.Walk(ctx, 1, 3, dots[:16]); err != nil {
+		t.Errorf("Walk of 16 names: %v", err)
+	}
+	if _, err := cc.Walk(ctx, 1, 4, dots); err == nil {
+		t.Errorf("Walk of 17 names succeeded")
+	}
+}
+
+// newCert returns a certificate for name, signed by parent, or
+// self-signed if parent is nil.
+func newCert(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestServerTLS(t *testing.T) {
+	ca := newCert(t, "ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	srv := &ninep.Server{
+		Files: testTree(),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{newCert(t, "server", &ca)},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pool,
+		},
+	}
+	host, port, _ := net.SplitHostPort(serve(t, srv))
+	service := "tls!" + host + "!" + port
+
+	t.Run("ClientCert", func(t *testing.T) {
+		fsys, err := ninep.DialFS(service, ninep.DialFSOpts{
+			DialOpts: ninep.DialOpts{TLSConfig: &tls.Config{
+				RootCAs:      pool,
+				Certificates: []tls.Certificate{newCert(t, "glenda", &ca)},
+			}},
+		})
+		if err != nil {
+			t.Fatalf("DialFS: %v", err)
+		}
+		defer fsys.Close()
+		got, err := fs.ReadFile(fsys, "whoami")
+		if err != nil || string(got) != "glenda" {
+			t.Errorf("ReadFile(whoami) = %q, %v; want %q", got, err, "glenda")
+		}
+	})
+	t.Run("NoClientCert", func(t *testing.T) {
+		fsys, err := ninep.DialFS(service, ninep.DialFSOpts{
+			DialOpts: ninep.DialOpts{TLSConfig: &tls.Config{RootCAs: pool}},
+		})
+		if err == nil {
+			fsys.Close()
+			t.Errorf("DialFS without client certificate succeeded")
+		}
+	})
+	t.Run("UnknownServer", func(t *testing.T) {
+		// Without RootCAs, the server's certificate is not trusted.
+		fsys, err := ninep.DialFS(service, ninep.DialFSOpts{})
+		if err == nil {
+			fsys.Close()
+			t.Errorf("DialFS with untrusted server succeeded")
+		}
+	})
+	t.Run("Plaintext", func(t *testing.T) {
+		conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		ninep.WriteMessage(conn, &ninep.Tversion{Tag: ^uint16(0), Msize: 8192, Version: "9P2000"})
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := ninep.ReadMessage(conn); err == nil {
+			t.Errorf("plaintext Tversion on TLS port got a reply")
+		}
+	})
+}
+
+func TestServerAuth(t *testing.T) {
+	srv := &ninep.Server{
+		Files: testTree(),
+		Auth:  &ninep.SharedSecret{Secrets: map[string][]byte{"glenda": []byte("secret")}},
+	}
+	host, port, _ := net.SplitHostPort(serve(t, srv))
+	service := "tcp!" + host + "!" + port
+
+	for _, tc := range []struct {
+		name   string
+		uname  string
+		auth   ninep.Authenticator
+		wantOK bool
+	}{
+		{"ok", "glenda", ninep.SharedSecretAuthenticator([]byte("secret")), true},
+		{"wrong secret", "glenda", ninep.SharedSecretAuthenticator([]byte("guess")), false},
+		{"unknown user", "bootes", ninep.SharedSecretAuthenticator([]byte("secret")), false},
+		{"no authenticator", "glenda", nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys, err := ninep.DialFS(service, ninep.DialFSOpts{
+				AttachOpts: ninep.AttachOpts{Uname: tc.uname, Authenticator: tc.auth},
+			})
+			if !tc.wantOK {
+				if err == nil {
+					fsys.Close()
+					t.Errorf("DialFS succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DialFS: %v", err)
+			}
+			defer fsys.Close()
+			got, err := fs.ReadFile(fsys, "user")
+			if err != nil || string(got) != tc.uname {
+				t.Errorf("ReadFile(user) = %q, %v; want %q", got, err, tc.uname)
+			}
+		})
+	}
+
+	t.Run("attach without afid", func(t *testing.T) {
+		cc, err := ninep.Dial(service, ninep.DialOpts{})
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		defer cc.Close()
+		_, err = cc.Attach(context.Background(), 1, ^uint32(0), "glenda", "")
+		if err == nil || err.Error() != "authentication required" {
+			t.Errorf("Attach without afid: got err %v, want %q", err, "authentication required")
+		}
+	})
+}
+
+func TestServerNoAuth(t *testing.T) {
+	host, port, _ := net.SplitHostPort(serve(t, &ninep.Server{Files: testTree()}))
+	cc, err := ninep.Dial("tcp!"+host+"!"+port, ninep.DialOpts{})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer cc.Close()
+	_, err = cc.Auth(context.Background(), 1, "glenda", "")
+	if err == nil || err.Error() != "authentication not required" {
+		t.Errorf("Auth: got err %v, want %q", err, "authentication not required")
+	}
+}
+
+func TestFileServerFS(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string]string{
+		"hello":    "hello, world\n",
+		"lib/motd": "welcome\n",
+	} {
+		w, _ := zw.Create(name)
+		io.WriteString(w, data)
+	}
+	zw.Close()
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, fsys := range map[string]fs.FS{
+		"MapFS": fstest.MapFS{
+			"hello":    {Data: []byte("hello, world\n"), Mode: 0o644},
+			"lib/motd": {Data: []byte("welcome\n"), Mode: 0o644},
+		},
+		// Files in zip archives can only be read sequentially.
+		"zip": zr,
+	} {
+		t.Run(name, func(t *testing.T) {
+			host, port, _ := net.SplitHostPort(serve(t, &ninep.Server{Files: ninep.FileServerFS(fsys)}))
+			cc, err := ninep.Dial("tcp!"+host+"!"+port, ninep.DialOpts{})
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer cc.Close()
+			fsys, err := ninep.Attach(cc, ninep.AttachOpts{})
+			if err != nil {
+				t.Fatalf("Attach: %v", err)
+			}
+			if err := fstest.TestFS(fsys, "hello", "lib/motd"); err != nil {
+				t.Error(err)
+			}
+
+			// Reading backwards, and writing.
+			f, err := fsys.OpenFile("hello", ninep.ORead)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			p := make([]byte, 5)
+			for _, off := range []int64{7, 0} {
+				n, err := f.(io.ReaderAt).ReadAt(p, off)
+				if want := "hello, world\n"[off : off+5]; err != nil || string(p[:n]) != want {
+					t.Errorf("ReadAt(%v) = %q, %v; want %q", off, p[:n], err, want)
+				}
+			}
+			if _, err := fsys.OpenFile("hello", ninep.OWrite); err == nil {
+				t.Errorf("opening for writing succeeded")
+			}
+		})
+	}
+}
+
+// blockingFile is a file tree consisting of a single file, whose
+// reads are implemented by read.  If walk is set, the file is a
+// directory instead, whose walks to any name call walk and return the
+// directory itself.
+type blockingFile struct {
+	read func(ctx context.Context) (string, error)
+	walk func(ctx context.Context)
+}
+
+func (f *blockingFile) Attach(ctx context.Context, uname, aname string) (ninep.Node, error) {
+	return f, nil
+}
+
+func (f *blockingFile) Stat(ctx context.Context) (ninep.Stat, error) {
+	st := ninep.Stat{Mode: 0o444, Name: "/", UID: "glenda", GID: "glenda", MUID: "glenda"}
+	if f.walk != nil {
+		st.Mode |= ninep.ModeDir
+		st.QID.Kind = ninep.QTDIR
+	}
+	return st, nil
+}
+
+func (f *blockingFile) Walk(ctx context.Context, name string) (ninep.Node, error) {
+	if f.walk == nil {
+		return nil, fs.ErrNotExist
+	}
+	f.walk(ctx)
+	return f, nil
+}
+
+func (f *blockingFile) Open(ctx context.Context, mode uint8) (ninep.Handle, error) { return f, nil }
+
+func (f *blockingFile) Close() error { return nil }
+
+func (f *blockingFile) ReadAt(ctx context.Context, p []byte, off int64) (int, error) {
+	s, err := f.read(ctx)
+	return copy(p, s), err
+}
+
+func (f *blockingFile) WriteAt(ctx context.Context, p []byte, off int64) (int, error) {
+	return 0, fs.ErrPermission
+}
+
+// tagHandler is a slog.Handler which sends the types and tags of the
+// messages logged by a Server to a channel, in the order in which
+// they are received and sent.
+type tagHandler chan [2]string
+
+func (h tagHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h tagHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h tagHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h tagHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Message != "9p request" && r.Message != "9p reply" {
+		return nil
+	}
+	var typ, tag string
+	r.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "type":
+			typ = a.Value.String()
+		case "tag":
+			tag = a.Value.String()
+		}
+		return true
+	})
+	h <- [2]string{typ, tag}
+	return nil
+}
+
+// nextTag returns the tag of the next message of type typ.
+func (h tagHandler) nextTag(t *testing.T, typ ninep.MsgType) uint16 {
+	t.Helper()
+	for m := range h {
+		if m[0] == typ.String() {
+			tag, err := strconv.Atoi(m[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return uint16(tag)
+		}
+	}
+	panic("unreachable")
+}
+
+// serveBlocking serves f on a pipe and opens it as fid 1.  It returns
+// the client, the server's messages, and the server end of the pipe.
+func serveBlocking(t *testing.T, f *blockingFile) (*ninep.ClientConn, tagHandler, net.Conn) {
+	t.Helper()
+	sc, cc := net.Pipe()
+	tags := make(tagHandler, 1000)
+	go (&ninep.Server{Files: f, Logger: slog.New(tags)}).ServeConn(sc)
+	c, err := ninep.NewClientConn(cc, ninep.DialOpts{})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	ctx := context.Background()
+	if _, err := c.Attach(ctx, 1, ^uint32(0), "glenda", ""); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	if _, _, err := c.Open(ctx, 1, ninep.ORead); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return c, tags, sc
+}
+
+// startRead starts reading fid 1 in the background, and returns the
+// result of the read.  Reads of flushed requests only return once ctx
+// is canceled, as the server does not reply to them.
+func startRead(ctx context.Context, c *ninep.ClientConn) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Read(ctx, 1, 0, make([]byte, 10))
+		errc <- err
+	}()
+	return errc
+}
+
+func TestServerFlush(t *testing.T) {
+	t.Run("CancelsRequest", func(t *testing.T) {
+		canceled := make(chan struct{})
+		c, tags, _ := serveBlocking(t, &blockingFile{read: func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			close(canceled)
+			return "", ctx.Err()
+		}})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		errc := startRead(ctx, c)
+		if err := c.Flush(tags.nextTag(t, ninep.MsgTread)); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+		<-canceled
+		// Any reply to the read would have arrived before the Rflush.
+		cancel()
+		if err := <-errc; err != context.Canceled {
+			t.Errorf("Read: got %v, want %v", err, context.Canceled)
+		}
+		// The connection still works.
+		if _, err := c.Stat(context.Background(), 1); err != nil {
+			t.Errorf("Stat: %v", err)
+		}
+	})
+
+	t.Run("WaitsForRequest", func(t *testing.T) {
+		release := make(chan struct{})
+		c, tags, _ := serveBlocking(t, &blockingFile{read: func(ctx context.Context) (string, error) {
+			<-release
+			return "late", nil
+		}})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		errc := startRead(ctx, c)
+		tag := tags.nextTag(t, ninep.MsgTread)
+		flushed := make(chan error)
+		go func() { flushed <- c.Flush(tag) }()
+		select {
+		case err := <-flushed:
+			t.Fatalf("Flush returned %v before the flushed request finished", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(release)
+		if err := <-flushed; err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+		// The read completed, so it was answered before the Rflush.
+		if err := <-errc; err != nil {
+			t.Errorf("Read: %v", err)
+		}
+	})
+
+	t.Run("AnswersCompletedRequest", func(t *testing.T) {
+		release := make(chan struct{})
+		c, tags, _ := serveBlocking(t, &blockingFile{walk: func(ctx context.Context) {
+			<-release
+		}})
+		// Fid 1 is open, so walk from a second attach.
+		if _, err := c.Attach(context.Background(), 3, ^uint32(0), "glenda", ""); err != nil {
+			t.Fatalf("Attach: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() {
+			_, err := c.Walk(ctx, 3, 2, []string{"a"})
+			errc <- err
+		}()
+		tags.nextTag(t, ninep.MsgTwalk)
+		cancel()
+		tags.nextTag(t, ninep.MsgTflush)
+		close(release)
+		if err := <-errc; err != context.Canceled {
+			t.Errorf("Walk: got %v, want %v", err, context.Canceled)
+		}
+		// The walk was answered before the Rflush, so the client
+		// knows that the new fid is in use.
+		var got []string
+		for range 2 {
+			select {
+			case m := <-tags:
+				got = append(got, m[0])
+			case <-time.After(time.Second):
+				t.Fatalf("replies %q, want Rwalk and Rflush", got)
+			}
+		}
+		if want := []string{"Rwalk", "Rflush"}; !slices.Equal(got, want) {
+			t.Errorf("replies %q, want %q", got, want)
+		}
+		if err := c.Clunk(context.Background(), 2); err != nil {
+			t.Errorf("Clunk of the new fid: %v", err)
+		}
+		if _, err := c.Walk(context.Background(), 3, 2, []string{"a"}); err != nil {
+			t.Errorf("Walk to the reused fid: %v", err)
+		}
+	})
+
+	t.Run("FlushOfFlush", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		c, tags, sc := serveBlocking(t, &blockingFile{read: func(ctx context.Context) (string, error) {
+			<-release
+			return "late", nil
+		}})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		startRead(ctx, c)
+		tag := tags.nextTag(t, ninep.MsgTread)
+		flushed := make(chan error, 1)
+		go func() { flushed <- c.Flush(tag) }()
+		// The second Tflush is answered although the read is still
+		// blocked, and the first Tflush is never answered.
+		if err := c.Flush(tags.nextTag(t, ninep.MsgTflush)); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+		select {
+		case err := <-flushed:
+			t.Errorf("flushed Tflush was answered: %v", err)
+		default:
+		}
+		// The first Flush only returns when the connection breaks.
+		sc.Close()
+		if err := <-flushed; err == nil {
+			t.Errorf("flushed Tflush was answered")
+		}
+	})
+
+	t.Run("FlushesInOrder", func(t *testing.T) {
+		release := make(chan struct{})
+		c, tags, _ := serveBlocking(t, &blockingFile{read: func(ctx context.Context) (string, error) {
+			<-release
+			return "late", nil
+		}})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		errc := startRead(ctx, c)
+		tag := tags.nextTag(t, ninep.MsgTread)
+		flushed := make(chan error, 2)
+		var flushTags []uint16
+		for range 2 {
+			go func() { flushed <- c.Flush(tag) }()
+			flushTags = append(flushTags, tags.nextTag(t, ninep.MsgTflush))
+		}
+		close(release)
+		for range 2 {
+			if err := <-flushed; err != nil {
+				t.Errorf("Flush: %v", err)
+			}
+		}
+		var replyTags []uint16
+		for range 2 {
+			replyTags = append(replyTags, tags.nextTag(t, ninep.MsgRflush))
+		}
+		if !slices.Equal(replyTags, flushTags) {
+			t.Errorf("Rflush tags %v, want %v", replyTags, flushTags)
+		}
+		if err := <-errc; err != nil {
+			t.Errorf("Read: %v", err)
+		}
+	})
+
+	t.Run("BackToBackFlushesInOrder", func(t *testing.T) {
+		sc, cc := net.Pipe()
+		defer cc.Close()
+		go (&ninep.Server{Files: &blockingFile{read: func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}}}).ServeConn(sc)
+		rpc := func(m ninep.Message) ninep.Message {
+			t.Helper()
+			if err := ninep.WriteMessage(cc, m); err != nil {
+				t.Fatalf("WriteMessage: %v", err)
+			}
+			resp, err := ninep.ReadMessage(cc)
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			return resp
+		}
+		rpc(&ninep.Tversion{Tag: ^uint16(0), Msize: 8192, Version: "9P2000"})
+		rpc(&ninep.Tattach{FID: 1, AFID: ^uint32(0), Uname: "glenda"})
+		rpc(&ninep.Topen{FID: 1, Mode: ninep.ORead})
+		// The Tflushes are sent without waiting, so that the server
+		// handles them concurrently.
+		for range 100 {
+			for _, m := range []ninep.Message{
+				&ninep.Tread{Tag: 1, FID: 1, Count: 10},
+				&ninep.Tflush{Tag: 2, OldTag: 1},
+				&ninep.Tflush{Tag: 3, OldTag: 1},
+			} {
+				if err := ninep.WriteMessage(cc, m); err != nil {
+					t.Fatalf("WriteMessage: %v", err)
+				}
+			}
+			for _, want := range []uint16{2, 3} {
+				m, err := ninep.ReadMessage(cc)
+				if err != nil {
+					t.Fatalf("ReadMessage: %v", err)
+				}
+				if _, ok := m.(*ninep.Rflush); !ok || m.MessageTag() != want {
+					t.Fatalf("got %v tag %d, want Rflush tag %d", m.Type(), m.MessageTag(), want)
+				}
+			}
+		}
+	})
+
+	t.Run("UnknownTag", func(t *testing.T) {
+		c, _, _ := serveBlocking(t, &blockingFile{})
+		if err := c.Flush(42); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+	})
+}
+
+// Offsets beyond 2^63-1 and panicking file servers result in errors,
+// and the connection keeps working.
+func TestServerBadRequests(t *testing.T) {
+	c, _, _ := serveBlocking(t, &blockingFile{read: func(ctx context.Context) (string, error) {
+		panic("boom")
+	}})
+	if _, err := c.Read(context.Background(), 1, 1<<63, make([]byte, 10)); err == nil || err.Error() != "negative i/o offset" {
+		t.Errorf("Read at offset 2^63: got %v, want %q", err, "negative i/o offset")
+	}
+	if _, err := c.Read(context.Background(), 1, 0, make([]byte, 10)); err == nil || err.Error() != "internal server error" {
+		t.Errorf("Read from panicking file: got %v, want %q", err, "internal server error")
+	}
+	if _, err := c.Stat(context.Background(), 1); err != nil {
+		t.Errorf("Stat: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package ninep
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Auth authenticates the users of a Server.
+//
+// A client authenticates by sending Tauth, which starts a
+// conversation, and then reading and writing the auth fid until the
+// conversation is done.  It then passes the auth fid to Tattach.
+type Auth interface {
+	// Start starts a conversation which authenticates uname for
+	// attaching to aname.
+	Start(ctx context.Context, uname, aname string) (AuthConv, error)
+}
+
+// AuthConv is an authentication conversation, run by the client
+// through reads and writes on the auth fid.
+type AuthConv interface {
+	Read(ctx context.Context, p []byte) (int, error)
+	Write(ctx context.Context, p []byte) (int, error)
+
+	// User returns the authenticated user when the conversation
+	// has succeeded, or an error otherwise.
+	User() (string, error)
+
+	// Close is called when the auth fid is clunked.
+	Close() error
+}
+
+type userKey struct{}
+
+// UserFromContext returns the user authenticated by the Server's Auth,
+// in the context passed to FileServer and Node methods.  It returns
+// the empty string if the server does not authenticate users.
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+var (
+	errAuthRequired = errors.New("authentication required")
+	errAuthFailed   = errors.New("authentication failed")
+	errNotAuthFid   = errors.New("not an auth fid")
+	errBadUse       = errors.New("bad use of fid")
+)
+
+// challengeLen is the size of a SharedSecret challenge.
+const challengeLen = 32
+
+// SharedSecret is an Auth which authenticates users with a secret
+// shared between client and server.
+//
+// The client reads a random challenge from the auth fid and writes
+// back the HMAC-SHA256 of the challenge, keyed with the secret.
+// SharedSecretAuthenticator does that on the client side.
+//
+// The protocol does not protect the connection; an eavesdropper can
+// attach with the auth fid as well.  Use it over TLS, or only on
+// trusted networks.
+type SharedSecret struct {
+	// Secrets maps user names to their secrets.
+	Secrets map[string][]byte
+}
+
+// Start implements Auth.
+func (s *SharedSecret) Start(ctx context.Context, uname, aname string) (AuthConv, error) {
+	// Unknown users only fail at the end, like users with a wrong
+	// secret.
+	conv := &secretConv{uname: uname, secret: s.Secrets[uname]}
+	if _, err := rand.Read(conv.challenge[:]); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+type secretConv struct {
+	uname     string
+	secret    []byte // nil for unknown users.
+	challenge [challengeLen]byte
+
+	mu   sync.Mutex
+	read int // Number of challenge bytes read.
+	resp []byte
+	done bool
+	ok   bool
+}
+
+func (c *secretConv) Read(ctx context.Context, p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return 0, io.EOF
+	}
+	n := copy(p, c.challenge[c.read:])
+	c.read += n
+	return n, nil
+}
+
+func (c *secretConv) Write(ctx context.Context, p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return 0, errBadUse
+	}
+	if c.read < challengeLen {
+		return 0, errors.New("challenge not read")
+	}
+	n := min(len(p), sha256.Size-len(c.resp))
+	c.resp = append(c.resp, p[:n]...)
+	if len(c.resp) == sha256.Size {
+		c.done = true
+		c.ok = c.secret != nil && hmac.Equal(c.resp, secretResponse(c.secret, c.challenge[:]))
+	}
+	return n, nil
+}
+
+func (c *secretConv) User() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.ok {
+		return "", errAuthFailed
+	}
+	return c.uname, nil
+}
+
+func (c *secretConv) Close() error { return nil }
+
+func secretResponse(secret, challenge []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(challenge)
+	return mac.Sum(nil)
+}
+
+// SharedSecretAuthenticator returns an Authenticator for servers which
+// use SharedSecret.
+func SharedSecretAuthenticator(secret []byte) Authenticator {
+	return func(rw io.ReadWriter) error {
+		challenge := make([]byte, challengeLen)
+		if _, err := io.ReadFull(rw, challenge); err != nil {
+			return fmt.Errorf("shared secret: reading challenge: %w", err)
+		}
+		if _, err := rw.Write(secretResponse(secret, challenge)); err != nil {
+			return fmt.Errorf("shared secret: writing response: %w", err)
+		}
+		return nil
+	}
+}
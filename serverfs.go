@@ -0,0 +1,181 @@
+package ninep
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// FileServerFS returns a FileServer which serves fsys read-only, for
+// example an archive opened with archive/zip.
+//
+// QIDs are derived from the file names, so a file which is replaced
+// by a different one under the same name keeps its QID path.  Files
+// are owned by the user "none".
+func FileServerFS(fsys fs.FS) FileServer {
+	return &fsServer{fsys: fsys}
+}
+
+type fsServer struct {
+	fsys fs.FS
+}
+
+func (s *fsServer) Attach(ctx context.Context, uname, aname string) (Node, error) {
+	if aname != "" {
+		return nil, fs.ErrNotExist
+	}
+	return &fsNode{fsys: s.fsys, name: "."}, nil
+}
+
+// fsNode is a file, named as in fs.FS.
+type fsNode struct {
+	fsys fs.FS
+	name string
+}
+
+// fileInfoStat converts fi to a Stat, for the file at name in an fs.FS.
+func fileInfoStat(name string, fi fs.FileInfo) Stat {
+	h := fnv.New64a()
+	io.WriteString(h, name)
+	mode := uint32(fi.Mode().Perm())
+	var kind uint8
+	length := uint64(fi.Size())
+	if fi.IsDir() {
+		mode |= ModeDir
+		kind = QTDIR
+		length = 0
+	}
+	mtime := uint32(fi.ModTime().Unix())
+	base := path.Base(name)
+	if name == "." {
+		base = "/"
+	}
+	return Stat{
+		QID:    QID{Kind: kind, Vers: mtime ^ uint32(length<<8), Path: h.Sum64()},
+		Mode:   mode,
+		Atime:  mtime,
+		Mtime:  mtime,
+		Length: length,
+		Name:   base,
+		UID:    "none",
+		GID:    "none",
+		MUID:   "none",
+	}
+}
+
+func (n *fsNode) Stat(ctx context.Context) (Stat, error) {
+	fi, err := fs.Stat(n.fsys, n.name)
+	if err != nil {
+		return Stat{}, err
+	}
+	return fileInfoStat(n.name, fi), nil
+}
+
+func (n *fsNode) Walk(ctx context.Context, name string) (Node, error) {
+	c := &fsNode{fsys: n.fsys, name: path.Join(n.name, name)}
+	if _, err := fs.Stat(n.fsys, c.name); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (n *fsNode) Open(ctx context.Context, mode uint8) (Handle, error) {
+	if m := mode & 3; m == OWrite || m == ORdWr || mode&(OTrunc|ORClose) != 0 {
+		return nil, fs.ErrPermission
+	}
+	f, err := n.fsys.Open(n.name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		f.Close()
+		return &fsDirHandle{n}, nil
+	}
+	return &fsFileHandle{node: n, f: f}, nil
+}
+
+type fsDirHandle struct{ node *fsNode }
+
+func (h *fsDirHandle) Close() error { return nil }
+
+func (h *fsDirHandle) ReadDir(ctx context.Context) ([]Stat, error) {
+	entries, err := fs.ReadDir(h.node.fsys, h.node.name)
+	if err != nil {
+		return nil, err
+	}
+	var stats []Stat
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			continue // Removed in the meantime.
+		}
+		stats = append(stats, fileInfoStat(path.Join(h.node.name, e.Name()), fi))
+	}
+	return stats, nil
+}
+
+// fsFileHandle is an open file.  Files which do not implement
+// io.ReaderAt or io.Seeker are read sequentially, and reopened for
+// reading backwards.
+type fsFileHandle struct {
+	node *fsNode
+
+	mu  sync.Mutex
+	f   fs.File
+	pos int64 // Position of f, when read sequentially.
+}
+
+func (h *fsFileHandle) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.f.Close()
+}
+
+func (h *fsFileHandle) ReadAt(ctx context.Context, p []byte, off int64) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ra, ok := h.f.(io.ReaderAt); ok {
+		return ra.ReadAt(p, off)
+	}
+	if err := h.seek(off); err != nil {
+		return 0, err
+	}
+	n, err := h.f.Read(p)
+	h.pos += int64(n)
+	return n, err
+}
+
+// seek moves the read position to off.
+func (h *fsFileHandle) seek(off int64) error {
+	if off == h.pos {
+		return nil
+	}
+	if s, ok := h.f.(io.Seeker); ok {
+		pos, err := s.Seek(off, io.SeekStart)
+		h.pos = pos
+		return err
+	}
+	if off < h.pos {
+		f, err := h.node.fsys.Open(h.node.name)
+		if err != nil {
+			return err
+		}
+		h.f.Close()
+		h.f, h.pos = f, 0
+	}
+	n, err := io.CopyN(io.Discard, h.f, off-h.pos)
+	h.pos += n
+	return err
+}
+
+func (h *fsFileHandle) WriteAt(ctx context.Context, p []byte, off int64) (int, error) {
+	return 0, fs.ErrPermission
+}
@@ -1,8 +1,10 @@
 package ninep
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"time"
 )
 
 // TODO: Rename Stat to 'Dir', to be in sync with Plan9 structs.
@@ -23,6 +25,67 @@ type Stat struct {
 	UID    string // owner's name
 	GID    string // group's name
 	MUID   string // name of the user who last modified the file
+
+	// 9P2000.u fields, present if DotU is set
+	Extension string // special file information, e.g. symlink target
+	NUID      uint32 // numeric owner id
+	NGID      uint32 // numeric group id
+	NMUID     uint32 // numeric id of the user who last modified the file
+	DotU      bool
+}
+
+// NullStat returns a Stat whose fields all have their "don't touch"
+// values, for changing individual fields with Twstat, like nulldir(2).
+func NullStat() Stat {
+	return Stat{
+		Type:   ^uint16(0),
+		Dev:    ^uint32(0),
+		QID:    QID{Kind: ^uint8(0), Vers: ^uint32(0), Path: ^uint64(0)},
+		Mode:   ^uint32(0),
+		Atime:  ^uint32(0),
+		Mtime:  ^uint32(0),
+		Length: ^uint64(0),
+	}
+}
+
+// ModTime returns the last modification time of the file, in whole
+// seconds.
+func (s Stat) ModTime() time.Time {
+	return unixTime(s.Mtime)
+}
+
+// AccessTime returns the last access time of the file, in whole
+// seconds.
+func (s Stat) AccessTime() time.Time {
+	return unixTime(s.Atime)
+}
+
+// unixTime converts a 9p timestamp, in unsigned seconds since the
+// epoch, to a time.Time.
+func unixTime(t uint32) time.Time {
+	return time.Unix(int64(t), 0)
+}
+
+// MarshalBinary returns the wire representation of s,
+// as it is used in directory reads.
+func (s Stat) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeStat(&buf, s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary parses the wire representation of a Stat.
+func (s *Stat) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	if err := readStat(r, s); err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return errors.New("stat is longer than its size")
+	}
+	return nil
 }
 
 func readStat(r io.Reader, s *Stat) error {
@@ -30,6 +93,9 @@ func readStat(r io.Reader, s *Stat) error {
 	if err := readUint16(r, &size); err != nil {
 		return err
 	}
+	if err := checkLen(r, int64(size)); err != nil {
+		return err
+	}
 	lr := &io.LimitedReader{R: r, N: int64(size)}
 	if err := readUint16(lr, &s.Type); err != nil {
 		return err
@@ -70,6 +136,21 @@ func readStat(r io.Reader, s *Stat) error {
 	if err := readString(lr, &s.MUID); err != nil {
 		return err
 	}
+	if lr.N > 0 {
+		s.DotU = true
+		if err := readString(lr, &s.Extension); err != nil {
+			return err
+		}
+		if err := readUint32(lr, &s.NUID); err != nil {
+			return err
+		}
+		if err := readUint32(lr, &s.NGID); err != nil {
+			return err
+		}
+		if err := readUint32(lr, &s.NMUID); err != nil {
+			return err
+		}
+	}
 	if lr.N > 0 {
 		return errors.New("stat is shorter than allocated size")
 	}
@@ -88,6 +169,9 @@ func statSize(s Stat) (size uint16) {
 	size += stringSize(s.UID)
 	size += stringSize(s.GID)
 	size += stringSize(s.MUID)
+	if s.DotU {
+		size += stringSize(s.Extension) + 12
+	}
 	return size
 }
 
@@ -134,5 +218,19 @@ func writeStat(w io.Writer, s Stat) error {
 	if err := writeString(w, s.MUID); err != nil {
 		return err
 	}
+	if s.DotU {
+		if err := writeString(w, s.Extension); err != nil {
+			return err
+		}
+		if err := writeUint32(w, s.NUID); err != nil {
+			return err
+		}
+		if err := writeUint32(w, s.NGID); err != nil {
+			return err
+		}
+		if err := writeUint32(w, s.NMUID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
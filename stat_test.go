@@ -0,0 +1,25 @@
+package ninep
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatTimes(t *testing.T) {
+	for _, tc := range []struct {
+		secs uint32
+		want time.Time
+	}{
+		{0, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{1 << 31, time.Date(2038, 1, 19, 3, 14, 8, 0, time.UTC)},
+		{1<<32 - 1, time.Date(2106, 2, 7, 6, 28, 15, 0, time.UTC)},
+	} {
+		s := Stat{Mtime: tc.secs, Atime: tc.secs}
+		if got := s.ModTime(); !got.Equal(tc.want) {
+			t.Errorf("Stat{Mtime: %d}.ModTime() = %v, want %v", tc.secs, got, tc.want)
+		}
+		if got := s.AccessTime(); !got.Equal(tc.want) {
+			t.Errorf("Stat{Atime: %d}.AccessTime() = %v, want %v", tc.secs, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package ninep
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of the statistics of a ClientConn,
+// as returned by ClientConn.Stats.
+//
+// Version negotiation is not included.
+type Stats struct {
+	// Requests counts the requests sent, by message type.
+	Requests map[MsgType]uint64
+	// Errors counts the Rerror replies received, by error string.
+	Errors map[string]uint64
+
+	// Bytes written to and read from the transport.
+	BytesSent     uint64
+	BytesReceived uint64
+
+	// InFlight is the number of requests awaiting a reply.
+	// PeakInFlight is the highest InFlight so far.
+	InFlight     int
+	PeakInFlight int
+
+	// FIDs is the number of FIDs in use.
+	FIDs int
+
+	// Latency distribution of RPCs which received a reply.
+	Latency LatencyStats
+}
+
+// LatencyStats summarizes a latency distribution.
+//
+// Percentiles are estimated from a histogram and are accurate to
+// within 1/8 of the true value.
+type LatencyStats struct {
+	Count uint64
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// Number of histogram buckets per power of two.
+const subBuckets = 8
+
+// histogram is a logarithmic histogram of durations.
+type histogram struct {
+	counts [64 * subBuckets]uint64
+	total  uint64
+	max    time.Duration
+}
+
+// bucket returns the index of the histogram bucket for d.
+// Durations below subBuckets nanoseconds get a bucket each.
+func (h *histogram) bucket(d time.Duration) int {
+	n := uint64(max(d, 0))
+	if n < subBuckets {
+		return int(n)
+	}
+	e := bits.Len64(n) - 1 // 2^e <= n < 2^(e+1)
+	m := (n >> (e - 3)) & (subBuckets - 1)
+	return (e-2)*subBuckets + int(m)
+}
+
+// upperBound returns the largest duration that falls into bucket b.
+func (h *histogram) upperBound(b int) time.Duration {
+	if b < subBuckets {
+		return time.Duration(b)
+	}
+	e, m := b/subBuckets+2, uint64(b%subBuckets)
+	upper := (subBuckets+m+1)<<(e-3) - 1
+	if upper > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(upper)
+}
+
+func (h *histogram) add(d time.Duration) {
+	h.counts[h.bucket(d)]++
+	h.total++
+	h.max = max(h.max, d)
+}
+
+// percentile returns an estimate of the p-th percentile, 0 < p <= 100.
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.total)))
+	var seen uint64
+	for b, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return min(h.upperBound(b), h.max)
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) summary() LatencyStats {
+	return LatencyStats{
+		Count: h.total,
+		P50:   h.percentile(50),
+		P90:   h.percentile(90),
+		P99:   h.percentile(99),
+		Max:   h.max,
+	}
+}
+
+// connStats collects the statistics of a ClientConn.
+type connStats struct {
+	mu            sync.Mutex
+	requests      map[MsgType]uint64
+	errors        map[string]uint64
+	bytesSent     uint64
+	bytesReceived uint64
+	inFlight      int
+	peakInFlight  int
+	latency       histogram
+}
+
+// sent records a request of n bytes which is now awaiting a reply.
+func (s *connStats) sent(t MsgType, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.requests == nil {
+		s.requests = make(map[MsgType]uint64)
+	}
+	s.requests[t]++
+	s.bytesSent += uint64(n)
+	s.inFlight++
+	s.peakInFlight = max(s.peakInFlight, s.inFlight)
+}
+
+// received records n bytes read from the transport.
+func (s *connStats) received(n uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bytesReceived += uint64(n)
+}
+
+// done records the end of a request which was sent.
+// resp is nil if no reply was received.
+func (s *connStats) done(resp Message, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight--
+	if resp == nil {
+		return
+	}
+	s.latency.add(latency)
+	if e, ok := resp.(*Rerror); ok {
+		if s.errors == nil {
+			s.errors = make(map[string]uint64)
+		}
+		s.errors[e.Ename]++
+	}
+}
+
+func (s *connStats) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Stats{
+		Requests:      make(map[MsgType]uint64, len(s.requests)),
+		Errors:        make(map[string]uint64, len(s.errors)),
+		BytesSent:     s.bytesSent,
+		BytesReceived: s.bytesReceived,
+		InFlight:      s.inFlight,
+		PeakInFlight:  s.peakInFlight,
+		Latency:       s.latency.summary(),
+	}
+	for t, n := range s.requests {
+		st.Requests[t] = n
+	}
+	for e, n := range s.errors {
+		st.Errors[e] = n
+	}
+	return st
+}
+
+// Stats returns a snapshot of the connection's statistics.
+func (c *ClientConn) Stats() Stats {
+	st := c.stats.snapshot()
+	st.FIDs = c.fidPool.InUse()
+	return st
+}
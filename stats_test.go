@@ -0,0 +1,52 @@
+package ninep
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	var h histogram
+	prev := -1
+	for _, d := range []time.Duration{0, 1, 7, 8, 9, 15, 16, 17, 1000, time.Millisecond, time.Hour, math.MaxInt64} {
+		b := h.bucket(d)
+		if b < prev {
+			t.Errorf("bucket(%v) = %d, less than bucket of smaller duration %d", d, b, prev)
+		}
+		prev = b
+		if upper := h.upperBound(b); upper < d || float64(upper-d) > float64(d)/8 {
+			t.Errorf("upperBound(bucket(%v)) = %v, want within 1/8 above", d, upper)
+		}
+		if b > 0 && h.upperBound(b-1) >= d {
+			t.Errorf("upperBound(bucket(%v)-1) = %v, want below %v", d, h.upperBound(b-1), d)
+		}
+	}
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	var h histogram
+	if got := h.summary(); got != (LatencyStats{}) {
+		t.Errorf("empty histogram: got %+v, want zero", got)
+	}
+	for i := 1; i <= 1000; i++ {
+		h.add(time.Duration(i) * time.Microsecond)
+	}
+	got := h.summary()
+	for _, tc := range []struct {
+		name      string
+		got, want time.Duration
+	}{
+		{"P50", got.P50, 500 * time.Microsecond},
+		{"P90", got.P90, 900 * time.Microsecond},
+		{"P99", got.P99, 990 * time.Microsecond},
+		{"Max", got.Max, 1000 * time.Microsecond},
+	} {
+		if tc.got < tc.want || tc.got > tc.want+tc.want/8 {
+			t.Errorf("%v = %v, want %v (+1/8)", tc.name, tc.got, tc.want)
+		}
+	}
+	if got.Count != 1000 {
+		t.Errorf("Count = %d, want 1000", got.Count)
+	}
+}
@@ -0,0 +1,124 @@
+package synthfs
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"sync"
+)
+
+// EventQueue distributes messages to the open fids of EventFiles.
+// The zero value is ready to use.
+//
+// Messages are queued for each fid until they are read.  When a fid
+// falls behind by more than Limit messages, its oldest messages are
+// dropped.
+type EventQueue struct {
+	// Limit is the number of messages queued for each fid;
+	// DefaultEventLimit if zero.
+	Limit int
+
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+// DefaultEventLimit is the number of messages queued for each fid if
+// EventQueue.Limit is zero.
+const DefaultEventLimit = 1024
+
+// Publish sends msg to every fid which has an EventFile of q open.
+// The caller may reuse msg afterwards.
+func (q *EventQueue) Publish(msg []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.subs) == 0 {
+		return
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultEventLimit
+	}
+	msg = bytes.Clone(msg)
+	for s := range q.subs {
+		s.push(msg, limit)
+	}
+}
+
+func (q *EventQueue) subscribe() *subscriber {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.subs == nil {
+		q.subs = make(map[*subscriber]struct{})
+	}
+	s := &subscriber{q: q, ready: make(chan struct{}, 1)}
+	q.subs[s] = struct{}{}
+	return s
+}
+
+// subscriber is an open EventFile.
+type subscriber struct {
+	q     *EventQueue
+	ready chan struct{} // Signaled when msgs becomes non-empty.
+
+	mu   sync.Mutex
+	msgs [][]byte
+}
+
+// push queues msg, dropping the oldest messages beyond limit.
+func (s *subscriber) push(msg []byte, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if drop := len(s.msgs) + 1 - limit; drop > 0 {
+		clear(s.msgs[:drop])
+		s.msgs = s.msgs[drop:]
+	}
+	s.msgs = append(s.msgs, msg)
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) Close() error {
+	s.q.mu.Lock()
+	defer s.q.mu.Unlock()
+	delete(s.q.subs, s)
+	return nil
+}
+
+// ReadAt returns the next message, waiting for it if necessary.  If
+// the message does not fit into p, the rest is returned by the next
+// read.  The offset is ignored.
+func (s *subscriber) ReadAt(ctx context.Context, p []byte, off int64) (int, error) {
+	for {
+		s.mu.Lock()
+		if len(s.msgs) > 0 {
+			n := copy(p, s.msgs[0])
+			if n < len(s.msgs[0]) {
+				s.msgs[0] = s.msgs[0][n:]
+			} else {
+				s.msgs = s.msgs[1:]
+			}
+			if len(s.msgs) > 0 {
+				// Keep the signal for concurrent readers.
+				select {
+				case s.ready <- struct{}{}:
+				default:
+				}
+			}
+			s.mu.Unlock()
+			return n, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (s *subscriber) WriteAt(ctx context.Context, p []byte, off int64) (int, error) {
+	return 0, fs.ErrPermission
+}
@@ -0,0 +1,320 @@
+// Package synthfs declares synthetic file trees from Go values, in
+// the style of Plan 9's /net: static files, files generated when they
+// are opened, ctl files which take commands, event files whose reads
+// block until something happens, and directories whose entries are
+// computed when they are read.
+//
+// For example:
+//
+//	root := &synthfs.Dir{Entries: []synthfs.Entry{
+//		&synthfs.StaticFile{Name: "version", Data: []byte("1.0\n")},
+//		&synthfs.GenFile{Name: "status", Gen: status},
+//		&synthfs.CtlFile{Name: "ctl", Commands: synthfs.Commands{
+//			"reset": reset,
+//		}},
+//		&synthfs.EventFile{Name: "log", Queue: events},
+//		&synthfs.DynDir{Name: "clients", List: listClients},
+//	}}
+//	srv := &ninep.Server{Files: synthfs.New(root)}
+//
+// The contents of generated files are computed once per open, so that
+// a client reading a file in several requests sees a consistent
+// snapshot.  QIDs are derived from the file paths, and files are owned
+// by the attaching user.
+package synthfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gnoack/ninep"
+)
+
+// Entry is a file or directory in a synthetic tree.  It is one of
+// *StaticFile, *GenFile, *CtlFile, *EventFile, *Dir or *DynDir.
+type Entry interface {
+	entryName() string
+}
+
+// StaticFile is a read-only file with fixed contents.
+type StaticFile struct {
+	Name string
+	Data []byte
+	Mode uint32 // Permissions; 0444 if zero.
+}
+
+// GenFile is a read-only file whose contents are generated by Gen
+// each time it is opened.
+type GenFile struct {
+	Name string
+	Gen  func(ctx context.Context) ([]byte, error)
+	Mode uint32 // Permissions; 0444 if zero.
+}
+
+// Commands maps command names to their implementations, for CtlFile.
+// The arguments do not include the command name.
+type Commands map[string]func(ctx context.Context, args []string) error
+
+// CtlFile is a control file.  Each line written to it is split into
+// space-separated fields and run as a command, with the first field as
+// the command name.  An error from a command fails the write.
+//
+// If Read is set, the file can also be read, with contents generated
+// on open as for GenFile.
+type CtlFile struct {
+	Name     string
+	Commands Commands
+	Read     func(ctx context.Context) ([]byte, error)
+	Mode     uint32 // Permissions; 0644 or 0200 if zero.
+}
+
+// EventFile is a read-only file from which the messages published to
+// Queue can be read, like acme's event file.  Every open fid receives
+// all messages published after it was opened.  Reads block until a
+// message is available, and return at most one message.
+type EventFile struct {
+	Name  string
+	Queue *EventQueue
+	Mode  uint32 // Permissions; 0444 if zero.
+}
+
+// Dir is a directory with fixed entries.  The name of the root
+// directory is ignored.
+type Dir struct {
+	Name    string
+	Entries []Entry
+	Mode    uint32 // Permissions; 0555 if zero.
+}
+
+// DynDir is a directory whose entries are computed by List each time
+// the directory is read or walked.
+type DynDir struct {
+	Name string
+	List func(ctx context.Context) ([]Entry, error)
+	Mode uint32 // Permissions; 0555 if zero.
+}
+
+func (f *StaticFile) entryName() string { return f.Name }
+func (f *GenFile) entryName() string    { return f.Name }
+func (f *CtlFile) entryName() string    { return f.Name }
+func (f *EventFile) entryName() string  { return f.Name }
+func (d *Dir) entryName() string        { return d.Name }
+func (d *DynDir) entryName() string     { return d.Name }
+
+var errUnknownCmd = errors.New("unknown control message")
+
+// New returns a FileServer which serves the tree root.
+func New(root Entry) ninep.FileServer {
+	return &server{root: root, start: uint32(time.Now().Unix())}
+}
+
+type server struct {
+	root  Entry
+	start uint32 // Modification time of all files.
+}
+
+func (s *server) Attach(ctx context.Context, uname, aname string) (ninep.Node, error) {
+	if aname != "" {
+		return nil, fs.ErrNotExist
+	}
+	return &node{srv: s, e: s.root, path: "/", uname: uname}, nil
+}
+
+// node is an entry at a path in the tree.
+type node struct {
+	srv   *server
+	e     Entry
+	path  string
+	uname string
+}
+
+func (n *node) isDir() bool {
+	switch n.e.(type) {
+	case *Dir, *DynDir:
+		return true
+	}
+	return false
+}
+
+// perm returns the permissions of the entry.
+func (n *node) perm() uint32 {
+	var mode, def uint32
+	switch e := n.e.(type) {
+	case *StaticFile:
+		mode, def = e.Mode, 0o444
+	case *GenFile:
+		mode, def = e.Mode, 0o444
+	case *EventFile:
+		mode, def = e.Mode, 0o444
+	case *CtlFile:
+		mode, def = e.Mode, 0o200
+		if e.Read != nil {
+			def = 0o644
+		}
+	case *Dir:
+		mode, def = e.Mode, 0o555
+	case *DynDir:
+		mode, def = e.Mode, 0o555
+	}
+	if mode == 0 {
+		return def
+	}
+	return mode & 0o777
+}
+
+func (n *node) Stat(ctx context.Context) (ninep.Stat, error) {
+	h := fnv.New64a()
+	io.WriteString(h, n.path)
+	st := ninep.Stat{
+		QID:   ninep.QID{Path: h.Sum64()},
+		Mode:  n.perm(),
+		Atime: n.srv.start,
+		Mtime: n.srv.start,
+		Name:  n.e.entryName(),
+		UID:   n.uname,
+		GID:   n.uname,
+		MUID:  n.uname,
+	}
+	if n.path == "/" {
+		st.Name = "/"
+	}
+	if n.isDir() {
+		st.QID.Kind = ninep.QTDIR
+		st.Mode |= ninep.ModeDir
+	}
+	if f, ok := n.e.(*StaticFile); ok {
+		st.Length = uint64(len(f.Data))
+	}
+	return st, nil
+}
+
+// entries returns the entries of a directory.
+func (n *node) entries(ctx context.Context) ([]Entry, error) {
+	switch d := n.e.(type) {
+	case *Dir:
+		return d.Entries, nil
+	case *DynDir:
+		return d.List(ctx)
+	}
+	return nil, errors.New("not a directory")
+}
+
+func (n *node) child(e Entry) *node {
+	return &node{srv: n.srv, e: e, path: path.Join(n.path, e.entryName()), uname: n.uname}
+}
+
+func (n *node) Walk(ctx context.Context, name string) (ninep.Node, error) {
+	entries, err := n.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.entryName() == name {
+			return n.child(e), nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (n *node) Open(ctx context.Context, mode uint8) (ninep.Handle, error) {
+	write := mode&3 == ninep.OWrite || mode&3 == ninep.ORdWr || mode&ninep.OTrunc != 0
+	read := mode&3 != ninep.OWrite
+	var gen func(ctx context.Context) ([]byte, error)
+	switch e := n.e.(type) {
+	case *Dir, *DynDir:
+		return &dirHandle{n}, nil
+	case *StaticFile:
+		gen = func(context.Context) ([]byte, error) { return e.Data, nil }
+	case *GenFile:
+		gen = e.Gen
+	case *EventFile:
+		if write {
+			return nil, fs.ErrPermission
+		}
+		return e.Queue.subscribe(), nil
+	case *CtlFile:
+		if read && e.Read == nil {
+			return nil, fs.ErrPermission
+		}
+		h := &fileHandle{ctl: e}
+		if read {
+			data, err := e.Read(ctx)
+			if err != nil {
+				return nil, err
+			}
+			h.data = data
+		}
+		return h, nil
+	}
+	if write {
+		return nil, fs.ErrPermission
+	}
+	data, err := gen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &fileHandle{data: data}, nil
+}
+
+// fileHandle is an open file, with a snapshot of its contents.
+type fileHandle struct {
+	data []byte
+	ctl  *CtlFile // Set for control files.
+}
+
+func (h *fileHandle) Close() error { return nil }
+
+func (h *fileHandle) ReadAt(ctx context.Context, p []byte, off int64) (int, error) {
+	if off >= int64(len(h.data)) {
+		return 0, io.EOF
+	}
+	return copy(p, h.data[off:]), nil
+}
+
+// WriteAt runs the commands in p.  The offset is ignored.
+func (h *fileHandle) WriteAt(ctx context.Context, p []byte, off int64) (int, error) {
+	if h.ctl == nil {
+		return 0, fs.ErrPermission
+	}
+	for _, line := range strings.Split(string(p), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, ok := h.ctl.Commands[fields[0]]
+		if !ok {
+			return 0, fmt.Errorf("%w: %q", errUnknownCmd, fields[0])
+		}
+		if err := cmd(ctx, fields[1:]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+type dirHandle struct{ n *node }
+
+func (h *dirHandle) Close() error { return nil }
+
+func (h *dirHandle) ReadDir(ctx context.Context) ([]ninep.Stat, error) {
+	entries, err := h.n.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]ninep.Stat, 0, len(entries))
+	for _, e := range entries {
+		st, err := h.n.child(e).Stat(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
@@ -0,0 +1,259 @@
+package synthfs_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gnoack/ninep"
+	"github.com/gnoack/ninep/synthfs"
+)
+
+// mount serves root on a pipe and attaches to it.
+func mount(t *testing.T, root synthfs.Entry) *ninep.FS {
+	t.Helper()
+	sc, cc := net.Pipe()
+	go (&ninep.Server{Files: synthfs.New(root)}).ServeConn(sc)
+	c, err := ninep.NewClientConn(cc, ninep.DialOpts{})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	fsys, err := ninep.Attach(c, ninep.AttachOpts{Uname: "glenda"})
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	t.Cleanup(func() { fsys.Close() })
+	return fsys
+}
+
+// service is a toy service with connections, in the style of /net.
+type service struct {
+	mu      sync.Mutex
+	opens   int
+	clients []string
+}
+
+func (s *service) tree() *synthfs.Dir {
+	return &synthfs.Dir{Entries: []synthfs.Entry{
+		&synthfs.StaticFile{Name: "version", Data: []byte("1.0\n")},
+		&synthfs.GenFile{Name: "status", Gen: func(ctx context.Context) ([]byte, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.opens++
+			return []byte(fmt.Sprintf("open %d, %d clients\n", s.opens, len(s.clients))), nil
+		}},
+		&synthfs.CtlFile{Name: "ctl", Commands: synthfs.Commands{
+			"add": func(ctx context.Context, args []string) error {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				s.clients = append(s.clients, args...)
+				return nil
+			},
+			"fail": func(ctx context.Context, args []string) error {
+				return fmt.Errorf("failed: %v", strings.Join(args, " "))
+			},
+		}},
+		&synthfs.DynDir{Name: "clients", List: func(ctx context.Context) ([]synthfs.Entry, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			var entries []synthfs.Entry
+			for _, c := range s.clients {
+				entries = append(entries, &synthfs.Dir{Name: c, Entries: []synthfs.Entry{
+					&synthfs.StaticFile{Name: "name", Data: []byte(c)},
+				}})
+			}
+			return entries, nil
+		}},
+	}}
+}
+
+func ctl(t *testing.T, fsys *ninep.FS, cmd string) error {
+	t.Helper()
+	f, err := fsys.OpenFile("ctl", ninep.OWrite)
+	if err != nil {
+		t.Fatalf("open ctl: %v", err)
+	}
+	defer f.Close()
+	_, err = io.WriteString(f.(io.Writer), cmd)
+	return err
+}
+
+func TestSynthFS(t *testing.T) {
+	s := &service{}
+	fsys := mount(t, s.tree())
+
+	if got, err := fs.ReadFile(fsys, "version"); err != nil || string(got) != "1.0\n" {
+		t.Errorf("version = %q, %v", got, err)
+	}
+	if err := ctl(t, fsys, "add alice bob\nadd carol\n"); err != nil {
+		t.Fatalf("ctl: %v", err)
+	}
+	if err := ctl(t, fsys, "frobnicate"); err == nil {
+		t.Errorf("unknown command succeeded")
+	}
+	if err := ctl(t, fsys, "fail now"); err == nil || err.Error() != "failed: now" {
+		t.Errorf("failing command: got %v, want %q", err, "failed: now")
+	}
+	if _, err := fs.ReadFile(fsys, "ctl"); err == nil {
+		t.Errorf("reading write-only ctl succeeded")
+	}
+
+	entries, err := fs.ReadDir(fsys, "clients")
+	if err != nil {
+		t.Fatalf("ReadDir(clients): %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"alice", "bob", "carol"}; !slices.Equal(names, want) {
+		t.Errorf("clients = %q, want %q", names, want)
+	}
+	if got, err := fs.ReadFile(fsys, "clients/bob/name"); err != nil || string(got) != "bob" {
+		t.Errorf("clients/bob/name = %q, %v", got, err)
+	}
+}
+
+func TestStaticTree(t *testing.T) {
+	fsys := mount(t, &synthfs.Dir{Entries: []synthfs.Entry{
+		&synthfs.StaticFile{Name: "a", Data: []byte("hello")},
+		&synthfs.Dir{Name: "sub", Entries: []synthfs.Entry{
+			&synthfs.StaticFile{Name: "b", Data: []byte("world"), Mode: 0o400},
+		}},
+	}})
+	if err := fstest.TestFS(fsys, "a", "sub/b"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	s := &service{}
+	fsys := mount(t, s.tree())
+
+	f, err := fsys.Open("status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Reads at increasing offsets see the contents generated on open,
+	// even if the status changes in between.
+	buf := make([]byte, 4)
+	var got []byte
+	for {
+		n, err := f.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.mu.Lock()
+		s.clients = append(s.clients, "x")
+		s.mu.Unlock()
+	}
+	if want := "open 1, 0 clients\n"; string(got) != want {
+		t.Errorf("status = %q, want %q", got, want)
+	}
+	if got, _ := fs.ReadFile(fsys, "status"); !strings.HasPrefix(string(got), "open 2, ") {
+		t.Errorf("status after reopening = %q", got)
+	}
+}
+
+func TestEventFile(t *testing.T) {
+	q := &synthfs.EventQueue{Limit: 2}
+	q.Publish([]byte("nobody listens\n"))
+
+	sc, cc := net.Pipe()
+	go (&ninep.Server{Files: synthfs.New(&synthfs.Dir{Entries: []synthfs.Entry{
+		&synthfs.EventFile{Name: "events", Queue: q},
+	}})}).ServeConn(sc)
+	c, err := ninep.NewClientConn(cc, ninep.DialOpts{})
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if _, err := c.Attach(ctx, 0, ^uint32(0), "glenda", ""); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	for _, fid := range []uint32{1, 2} {
+		if _, err := c.Walk(ctx, 0, fid, []string{"events"}); err != nil {
+			t.Fatalf("Walk: %v", err)
+		}
+		if _, _, err := c.Open(ctx, fid, ninep.ORead); err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+	}
+	read := func(ctx context.Context, fid uint32, size int) (string, error) {
+		buf := make([]byte, size)
+		n, err := c.Read(ctx, fid, 0, buf)
+		return string(buf[:n]), err
+	}
+
+	// A blocked read returns once a message is published.
+	done := make(chan string)
+	go func() {
+		got, err := read(ctx, 1, 100)
+		if err != nil {
+			t.Errorf("blocked read: %v", err)
+		}
+		done <- got
+	}()
+	q.Publish([]byte("hello\n"))
+	if got := <-done; got != "hello\n" {
+		t.Errorf("fid 1 read %q, want %q", got, "hello\n")
+	}
+
+	// Every fid receives every message, and messages which do not fit
+	// are continued in the next read.
+	q.Publish([]byte("world\n"))
+	for _, want := range []string{"hel", "lo\n", "wor", "ld\n"} {
+		if got, err := read(ctx, 2, 3); err != nil || got != want {
+			t.Errorf("fid 2 read %q, %v; want %q", got, err, want)
+		}
+	}
+
+	// Canceling a blocked read flushes it, without losing messages.
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := read(cctx, 2, 100); err != context.DeadlineExceeded {
+		t.Errorf("canceled read: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got, err := read(ctx, 1, 100); err != nil || got != "world\n" {
+		t.Errorf("fid 1 read %q, %v; want %q", got, err, "world\n")
+	}
+
+	// Publish copies the message, so the caller may reuse the buffer.
+	buf := []byte("one\n")
+	q.Publish(buf)
+	copy(buf, "xxx\n")
+	if got, err := read(ctx, 1, 100); err != nil || got != "one\n" {
+		t.Errorf("fid 1 read %q, %v; want %q", got, err, "one\n")
+	}
+
+	// Fids which fall behind lose the oldest messages.
+	for _, msg := range []string{"a\n", "b\n", "c\n"} {
+		q.Publish([]byte(msg))
+	}
+	for _, want := range []string{"b\n", "c\n"} {
+		if got, err := read(ctx, 1, 100); err != nil || got != want {
+			t.Errorf("fid 1 read %q, %v; want %q", got, err, want)
+		}
+	}
+
+	if _, err := c.Walk(ctx, 0, 3, []string{"events"}); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if _, _, err := c.Open(ctx, 3, ninep.OWrite); err == nil {
+		t.Errorf("opening the event file for writing succeeded")
+	}
+}
@@ -0,0 +1,163 @@
+package ninep
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// TraceDir is the direction of a traced message.
+type TraceDir uint8
+
+const (
+	TraceSent     TraceDir = 0 // From client to server
+	TraceReceived TraceDir = 1 // From server to client
+)
+
+func (d TraceDir) String() string {
+	switch d {
+	case TraceSent:
+		return "sent"
+	case TraceReceived:
+		return "received"
+	}
+	return fmt.Sprintf("TraceDir(%d)", uint8(d))
+}
+
+// TraceRecord is a single message in a trace.
+type TraceRecord struct {
+	Time time.Time
+	Dir  TraceDir
+	// Data is the raw message, including its header.
+	Data []byte
+}
+
+// A TraceWriter writes a trace of 9P messages to a file.
+//
+// Each record in the trace file is encoded as
+//
+//	time[8] dir[1] size[4] data[size]
+//
+// where time is in nanoseconds since the Unix epoch.  All numbers are
+// little-endian, as in 9P itself.
+//
+// A TraceWriter is safe for concurrent use.
+type TraceWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewTraceWriter returns a TraceWriter which writes to w.
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{w: w}
+}
+
+// WriteRecord appends r to the trace.
+func (t *TraceWriter) WriteRecord(r TraceRecord) error {
+	buf := make([]byte, 13, 13+len(r.Data))
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(r.Time.UnixNano()))
+	buf[8] = byte(r.Dir)
+	binary.LittleEndian.PutUint32(buf[9:13], uint32(len(r.Data)))
+	buf = append(buf, r.Data...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.w.Write(buf)
+	return err
+}
+
+// A TraceReader reads a trace written by a TraceWriter.
+type TraceReader struct {
+	r io.Reader
+}
+
+// NewTraceReader returns a TraceReader which reads from r.
+func NewTraceReader(r io.Reader) *TraceReader {
+	return &TraceReader{r: r}
+}
+
+// Next returns the next record in the trace.
+// At the end of the trace, it returns io.EOF.
+func (t *TraceReader) Next() (TraceRecord, error) {
+	var hdr [13]byte
+	if _, err := io.ReadFull(t.r, hdr[:]); err != nil {
+		return TraceRecord{}, err
+	}
+	size := binary.LittleEndian.Uint32(hdr[9:13])
+	if size > MaxMsize {
+		return TraceRecord{}, errors.New("trace record exceeds maximum message size")
+	}
+	r := TraceRecord{
+		Time: time.Unix(0, int64(binary.LittleEndian.Uint64(hdr[0:8]))),
+		Dir:  TraceDir(hdr[8]),
+		Data: make([]byte, size),
+	}
+	if _, err := io.ReadFull(t.r, r.Data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return TraceRecord{}, err
+	}
+	return r, nil
+}
+
+// tracingConn is a transport which records all messages passing
+// through it to a trace.  Errors writing the trace are ignored.
+type tracingConn struct {
+	io.ReadWriteCloser
+	trace    *TraceWriter
+	sent     messageFramer
+	received messageFramer
+}
+
+func newTracingConn(conn io.ReadWriteCloser, trace *TraceWriter) *tracingConn {
+	return &tracingConn{
+		ReadWriteCloser: conn,
+		trace:           trace,
+		sent:            messageFramer{dir: TraceSent},
+		received:        messageFramer{dir: TraceReceived},
+	}
+}
+
+func (c *tracingConn) Read(p []byte) (n int, err error) {
+	n, err = c.ReadWriteCloser.Read(p)
+	c.received.add(c.trace, p[:n])
+	return n, err
+}
+
+func (c *tracingConn) Write(p []byte) (n int, err error) {
+	// Record before writing, so that the request is in the trace
+	// before the reply.
+	c.sent.add(c.trace, p)
+	return c.ReadWriteCloser.Write(p)
+}
+
+// messageFramer splits a byte stream into messages
+// and writes them to a trace.
+type messageFramer struct {
+	mu  sync.Mutex
+	dir TraceDir
+	buf []byte
+}
+
+func (f *messageFramer) add(trace *TraceWriter, p []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.buf = append(f.buf, p...)
+	for len(f.buf) >= 4 {
+		size := int(binary.LittleEndian.Uint32(f.buf))
+		if size < 7 || size > MaxMsize {
+			// Not a message; record the garbage as-is.
+			size = len(f.buf)
+		}
+		if len(f.buf) < size {
+			return
+		}
+		trace.WriteRecord(TraceRecord{Time: time.Now(), Dir: f.dir, Data: f.buf[:size:size]})
+		f.buf = f.buf[size:]
+	}
+}
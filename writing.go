@@ -11,7 +11,7 @@ func writeString(w io.Writer, s string) error {
 	if len(b) > 0xffff {
 		return errors.New("string to write is too long")
 	}
-	if e := binary.Write(w, binary.LittleEndian, int16(len(b))); e != nil {
+	if e := binary.Write(w, binary.LittleEndian, uint16(len(b))); e != nil {
 		return e
 	}
 	if e := binary.Write(w, binary.LittleEndian, b); e != nil {